@@ -12,6 +12,8 @@ import (
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/mullayam/go-tcp-chat/internal/client"
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
 )
 
 var (
@@ -20,6 +22,8 @@ var (
 	systemStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))   // Yellow
 	errorStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))   // Red
 	pmStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("208")) // Orange
+	replayStyle = lipgloss.NewStyle().Faint(true)
+	roomStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("6")) // Cyan
 
 	usernameStyles = []lipgloss.Style{
 		lipgloss.NewStyle().Foreground(lipgloss.Color("2")), // Green
@@ -39,15 +43,19 @@ type model struct {
 	textInput textinput.Model
 	messages  []string
 	conn      net.Conn
+	address   string
+	tokens    *client.TokenStore
 	msgChan   chan string
 	err       error
 	roomName  string
+	queryWith string            // partner of a /query conversation
+	topics    map[string]string // key: room
 	width     int
 	height    int
 	ready     bool
 }
 
-func initialModel(conn net.Conn) model {
+func initialModel(conn net.Conn, address string, tokens *client.TokenStore) model {
 	ti := textinput.New()
 	ti.Placeholder = "Type a message..."
 	ti.Focus()
@@ -75,8 +83,11 @@ func initialModel(conn net.Conn) model {
 		textInput: ti,
 		messages:  []string{},
 		conn:      conn,
+		address:   address,
+		tokens:    tokens,
 		msgChan:   msgChan,
 		roomName:  "#general",
+		topics:    make(map[string]string),
 	}
 }
 
@@ -126,6 +137,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if strings.TrimSpace(m.textInput.Value()) == "/quit" {
 				return m, tea.Quit
 			}
+			if strings.TrimSpace(m.textInput.Value()) == "/logout" {
+				if m.tokens != nil {
+					m.tokens.Clear(m.address)
+				}
+				return m, tea.Quit
+			}
 
 			// We don't append local message, we rely on server echo for history
 			m.textInput.SetValue("")
@@ -134,16 +151,46 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case serverMsg:
 		content := string(msg)
 
-		// Parse room name
-		if strings.Contains(content, "You joined") {
-			parts := strings.Split(content, "You joined ")
-			if len(parts) > 1 {
-				m.roomName = strings.Trim(parts[1], "* ")
-			}
+		// Handshake replies are protocol plumbing, not something to display
+		if strings.HasPrefix(content, "HELLO ") || strings.HasPrefix(content, "CAP ") {
+			return m, waitForServerMsg(m.msgChan)
+		}
+
+		// Remember resume tokens instead of displaying them
+		if m.tokens != nil && m.tokens.HandleTokenLine(m.address, content) {
+			return m, waitForServerMsg(m.msgChan)
 		}
 
-		// Parse colors and styling
-		styledContent := styleMessage(content)
+		var styledContent string
+		frame, err := decodeFrame(content)
+		if err == nil {
+			// Track the current room from our own join/leave/switch notices
+			if room, ok := client.CurrentRoom(frame); ok {
+				m.roomName = room
+				m.queryWith = ""
+			}
+			// ...and room topics from the join and topic change notices
+			if room, topic, ok := client.RoomTopic(frame); ok {
+				m.topics[room] = topic
+			}
+			// ...and the /query partner from the conversation notice
+			if frame.Type == protocol.MessageTypeSystem && frame.To != "" &&
+				strings.HasPrefix(frame.Content, "You are now talking to") {
+				m.queryWith = frame.To
+			}
+			styledContent = styleFrame(frame, m.roomName)
+		} else {
+			// Parse room name
+			if strings.Contains(content, "You joined") {
+				parts := strings.Split(content, "You joined ")
+				if len(parts) > 1 {
+					m.roomName = strings.Trim(parts[1], "* ")
+				}
+			}
+
+			// Parse colors and styling
+			styledContent = styleMessage(content)
+		}
 		m.messages = append(m.messages, styledContent)
 
 		// Truncate history if massive
@@ -183,7 +230,7 @@ func (m model) View() string {
 		BorderForeground(borderColor).
 		Width(m.width - 2).
 		Align(lipgloss.Center).
-		Render("Room: " + m.roomName)
+		Render(m.title())
 
 	// Footer (Input)
 	footer := lipgloss.NewStyle().
@@ -195,6 +242,25 @@ func (m model) View() string {
 	return fmt.Sprintf("%s\n%s\n%s", header, m.viewport.View(), footer)
 }
 
+// title returns the header text: the /query partner, or the current room
+// and its topic, cut to fit on one line
+func (m model) title() string {
+	if m.queryWith != "" {
+		return "Talking to: " + m.queryWith
+	}
+	title := "Room: " + m.roomName
+	if topic := m.topics[m.roomName]; topic != "" {
+		title += " - " + topic
+	}
+	if limit := m.width - 4; limit > 0 && lipgloss.Width(title) > limit {
+		runes := []rune(title)
+		if len(runes) > limit {
+			title = string(runes[:limit-1]) + "…"
+		}
+	}
+	return title
+}
+
 func waitForServerMsg(sub chan string) tea.Cmd {
 	return func() tea.Msg {
 		val, ok := <-sub
@@ -242,6 +308,40 @@ func styleMessage(line string) string {
 	return line // Default
 }
 
+// decodeFrame decodes a JSON frame, rejecting plain text lines
+func decodeFrame(line string) (*protocol.Message, error) {
+	if !strings.HasPrefix(line, "{") {
+		return nil, fmt.Errorf("not a JSON frame")
+	}
+	return protocol.Decode(line)
+}
+
+// styleFrame renders a decoded JSON frame, labelling lines from rooms other
+// than currentRoom
+func styleFrame(msg *protocol.Message, currentRoom string) string {
+	// Replayed history is dimmed and stamped with its time
+	if msg.Replay {
+		return replayStyle.Render(strings.TrimRight(msg.FormatFor(currentRoom), "\n"))
+	}
+
+	if msg.Room != "" && msg.Room != currentRoom {
+		return roomStyle.Render("["+msg.Room+"]") + " " + styleFrame(msg, msg.Room)
+	}
+
+	switch msg.Type {
+	case protocol.MessageTypeChat:
+		return getUsernameColorStyle(msg.From).Render("["+msg.From+"]:") + " " + msg.Content
+	case protocol.MessageTypePrivate:
+		return pmStyle.Render("[PM "+msg.From+"]:") + " " + msg.Content
+	case protocol.MessageTypeSystem:
+		return systemStyle.Render(msg.Content)
+	case protocol.MessageTypeError:
+		return errorStyle.Render("ERROR: " + msg.Content)
+	default:
+		return strings.Trim(msg.Content, "\n")
+	}
+}
+
 func getUsernameColorStyle(username string) lipgloss.Style {
 	hash := 0
 	for _, ch := range username {
@@ -253,6 +353,12 @@ func getUsernameColorStyle(username string) lipgloss.Style {
 func main() {
 	// Parse flags
 	urlFlag := flag.String("url", "", "Connection URL (e.g., enjoys://tcp-chat@127.0.0.1:8888)")
+	var opts client.DialOptions
+	flag.BoolVar(&opts.TLS, "tls", false, "Connect using TLS")
+	flag.BoolVar(&opts.Insecure, "insecure", false, "Skip verification of the server certificate")
+	flag.StringVar(&opts.CAFile, "ca", "", "PEM file with the CA used to verify the server certificate")
+	flag.StringVar(&opts.CertFile, "cert", "", "Client certificate (skips the email OTP step)")
+	flag.StringVar(&opts.KeyFile, "key", "", "Client certificate private key")
 	flag.Parse()
 
 	address := "localhost:8888"
@@ -266,14 +372,27 @@ func main() {
 		}
 	}
 
-	conn, err := net.Dial("tcp", address)
+	conn, err := client.Dial(address, opts)
 	if err != nil {
 		fmt.Println("Could not connect:", err)
 		os.Exit(1)
 	}
 	defer conn.Close()
 
-	if _, err := tea.NewProgram(initialModel(conn), tea.WithAltScreen()).Run(); err != nil {
+	// Resume tokens let a dropped connection skip the OTP step
+	tokens, err := client.NewTokenStore()
+	if err != nil {
+		fmt.Println("Session resume disabled:", err)
+	}
+	savedToken := ""
+	if tokens != nil {
+		savedToken = tokens.Load(address)
+	}
+
+	// Negotiate JSON-lines framing so messages don't have to be scraped
+	client.Handshake(conn, "chat-client-tui", savedToken)
+
+	if _, err := tea.NewProgram(initialModel(conn, address, tokens), tea.WithAltScreen()).Run(); err != nil {
 		fmt.Println("Error running program:", err)
 		os.Exit(1)
 	}
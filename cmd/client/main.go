@@ -5,11 +5,13 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"net"
 	"os"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/client"
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
 )
 
 // ANSI color codes
@@ -30,6 +32,12 @@ const (
 func main() {
 	// Parse flags
 	urlFlag := flag.String("url", "", "Connection URL (e.g., enjoys://tcp-chat@127.0.0.1:8888)")
+	var opts client.DialOptions
+	flag.BoolVar(&opts.TLS, "tls", false, "Connect using TLS")
+	flag.BoolVar(&opts.Insecure, "insecure", false, "Skip verification of the server certificate")
+	flag.StringVar(&opts.CAFile, "ca", "", "PEM file with the CA used to verify the server certificate")
+	flag.StringVar(&opts.CertFile, "cert", "", "Client certificate (skips the email OTP step)")
+	flag.StringVar(&opts.KeyFile, "key", "", "Client certificate private key")
 	flag.Parse()
 
 	address := "localhost:8888"
@@ -45,13 +53,26 @@ func main() {
 	}
 
 	// Connect to server
-	conn, err := net.Dial("tcp", address)
+	conn, err := client.Dial(address, opts)
 	if err != nil {
 		fmt.Printf("%sFailed to connect to %s: %v%s\n", ColorRed, address, err, ColorReset)
 		os.Exit(1)
 	}
 	defer conn.Close()
 
+	// Resume tokens let a dropped connection skip the OTP step
+	tokens, err := client.NewTokenStore()
+	if err != nil {
+		fmt.Printf("%sSession resume disabled: %v%s\n", ColorYellow, err, ColorReset)
+	}
+	savedToken := ""
+	if tokens != nil {
+		savedToken = tokens.Load(address)
+	}
+
+	// Negotiate JSON-lines framing so messages don't have to be scraped
+	client.Handshake(conn, "chat-client", savedToken)
+
 	fmt.Printf("%sConnected to TCP Chat Server at %s%s\n", ColorCyan, address, ColorReset)
 	fmt.Println(ColorCyan + "=====================================" + ColorReset)
 
@@ -73,6 +94,11 @@ func main() {
 				os.Exit(0)
 			}
 
+			// Remember resume tokens instead of displaying them
+			if tokens != nil && tokens.HandleTokenLine(address, strings.TrimSpace(line)) {
+				continue
+			}
+
 			// Process and display the line
 			printServerMessage(line)
 		}
@@ -108,6 +134,12 @@ func main() {
 		if strings.TrimSpace(line) == "/quit" {
 			break
 		}
+		if strings.TrimSpace(line) == "/logout" {
+			if tokens != nil {
+				tokens.Clear(address)
+			}
+			break
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -123,6 +155,19 @@ func printServerMessage(line string) {
 		return
 	}
 
+	// Handshake replies are protocol plumbing, not something to display
+	if strings.HasPrefix(line, "HELLO ") || strings.HasPrefix(line, "CAP ") {
+		return
+	}
+
+	// JSON frames (everything after the CAP negotiation)
+	if strings.HasPrefix(line, "{") {
+		if msg, err := protocol.Decode(line); err == nil {
+			printFrame(msg)
+			return
+		}
+	}
+
 	// Chat messages
 	// [username]: message
 	if strings.Contains(line, "]:") {
@@ -175,6 +220,43 @@ func printServerMessage(line string) {
 	}
 }
 
+// currentRoom is the room plain lines go to, tracked from the server's
+// notices so lines from other rooms can be labelled
+var currentRoom string
+
+// printFrame displays a decoded JSON frame
+func printFrame(msg *protocol.Message) {
+	if room, ok := client.CurrentRoom(msg); ok {
+		currentRoom = room
+	}
+
+	// Replayed history is dimmed and stamped with its time
+	if msg.Replay {
+		fmt.Printf("\r\033[K%s%s%s\n", ColorDim, strings.TrimRight(msg.FormatFor(currentRoom), "\n"), ColorReset)
+		return
+	}
+
+	// Label lines from the other joined rooms
+	tag := ""
+	if msg.Room != "" && msg.Room != currentRoom {
+		tag = fmt.Sprintf("%s[%s]%s ", ColorCyan, msg.Room, ColorReset)
+	}
+
+	switch msg.Type {
+	case protocol.MessageTypeChat:
+		userColor := getUsernameColor(msg.From)
+		fmt.Printf("\r\033[K%s%s[%s]:%s %s\n", tag, userColor+ColorBold, msg.From, ColorReset, msg.Content)
+	case protocol.MessageTypePrivate:
+		fmt.Printf("\r\033[K%s[PM %s]:%s %s\n", ColorOrange+ColorBold, msg.From, ColorReset, msg.Content)
+	case protocol.MessageTypeSystem:
+		fmt.Printf("\r\033[K%s%s%s%s\n", tag, ColorYellow+ColorBold, msg.Content, ColorReset)
+	case protocol.MessageTypeError:
+		fmt.Printf("\r\033[K%sERROR: %s%s\n", ColorRed+ColorBold, msg.Content, ColorReset)
+	default:
+		fmt.Printf("\r\033[K%s%s%s\n", ColorYellow, strings.Trim(msg.Content, "\n"), ColorReset)
+	}
+}
+
 func getUsernameColor(username string) string {
 	hash := 0
 	for _, ch := range username {
@@ -1,16 +1,21 @@
 package main
 
 import (
+	"crypto/tls"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/mullayam/go-tcp-chat/config"
+	"github.com/mullayam/go-tcp-chat/internal/account"
+	"github.com/mullayam/go-tcp-chat/internal/admin"
 	"github.com/mullayam/go-tcp-chat/internal/auth"
 	"github.com/mullayam/go-tcp-chat/internal/room"
 	"github.com/mullayam/go-tcp-chat/internal/server"
 	"github.com/mullayam/go-tcp-chat/internal/session"
+	"github.com/mullayam/go-tcp-chat/internal/storage"
 )
 
 func main() {
@@ -23,26 +28,139 @@ func main() {
 	log.Println("Starting TCP Chat Server...")
 	log.Printf("Configuration loaded:")
 	log.Printf("  - TCP Port: %s", cfg.TCPPort)
-	log.Printf("  - SMTP Host: %s:%d", cfg.SMTPHost, cfg.SMTPPort)
-	log.Printf("  - SMTP Email: %s", cfg.SMTPEmail)
+	log.Printf("  - TLS Enabled: %t", cfg.TLSEnabled())
+	if cfg.WSPort != "" {
+		log.Printf("  - WebSocket Port: %s (path %s)", cfg.WSPort, cfg.WSPath)
+	}
+	if cfg.IRCPort != "" {
+		log.Printf("  - IRC Port: %s", cfg.IRCPort)
+	}
+	if cfg.SSHPort != "" {
+		log.Printf("  - SSH Port: %s", cfg.SSHPort)
+	}
+	if cfg.StorageBackend == "bolt" {
+		log.Printf("  - Storage: bolt (%s)", cfg.StoragePath)
+	} else {
+		log.Printf("  - Storage: %s (lost on restart; set STORAGE_BACKEND=bolt to keep it)", cfg.StorageBackend)
+	}
+	log.Printf("  - History Retention: %s", cfg.HistoryRetention)
+	log.Printf("  - History Replay: %s", cfg.HistoryReplay)
+	log.Printf("  - Offline Inbox Limit: %d messages", cfg.InboxLimit)
+	log.Printf("  - Search Index Limit: %d messages per room", cfg.SearchIndexLimit)
+	log.Printf("  - Auth Provider: %s", cfg.AuthProvider)
+	if cfg.AuthProvider == "email" {
+		log.Printf("  - Mail Transport: %s", cfg.MailTransport)
+		if cfg.MailTransport == "smtp" {
+			log.Printf("  - SMTP Host: %s:%d (%s)", cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPSecurity)
+			log.Printf("  - SMTP Email: %s", cfg.SMTPEmail)
+		}
+	}
+	log.Printf("  - Resume Token TTL: %d hours", cfg.ResumeTokenTTLHours)
 	log.Printf("  - OTP Expiration: %d minutes", cfg.OTPExpirationMinutes)
 	log.Printf("  - OTP Max Retries: %d", cfg.OTPMaxRetries)
 	log.Printf("  - Username Length: %d-%d characters", cfg.UsernameMinLength, cfg.UsernameMaxLength)
+	log.Printf("  - Operators: %d", len(cfg.Operators))
 
 	// Initialize managers
 	sessionMgr := session.NewManager(cfg.UsernameMinLength, cfg.UsernameMaxLength)
-	roomMgr := room.NewManager()
-	otpService := auth.NewOTPService(cfg.OTPExpirationMinutes, cfg.OTPMaxRetries)
-	emailService := auth.NewEmailService(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPEmail, cfg.SMTPPassword)
+	store, err := storage.Open(cfg.StorageBackend, cfg.StoragePath)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	retention, err := storage.ParseRetention(cfg.HistoryRetention)
+	if err != nil {
+		log.Fatalf("Invalid HISTORY_RETENTION: %v", err)
+	}
+	replay, err := storage.ParseReplay(cfg.HistoryReplay)
+	if err != nil {
+		log.Fatalf("Invalid HISTORY_REPLAY: %v", err)
+	}
+	messages, err := storage.NewIndexedStore(store, cfg.SearchIndexLimit)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	roomMgr, err := room.NewManager(messages, retention, replay)
+	if err != nil {
+		log.Fatalf("Failed to load rooms: %v", err)
+	}
+	accounts := account.NewStore(store)
+	log.Printf("Loaded %d registered accounts", accounts.Count())
+	bans, err := admin.NewBanList(store)
+	if err != nil {
+		log.Fatalf("Failed to load server bans: %v", err)
+	}
+	authenticator, err := newAuthenticator(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create authenticator: %v", err)
+	}
+	tokens, err := auth.NewResumeTokenService(cfg.ResumeSecret, time.Duration(cfg.ResumeTokenTTLHours)*time.Hour, cfg.ResumeRevocationsFile)
+	if err != nil {
+		log.Fatalf("Failed to create resume token service: %v", err)
+	}
+
+	// Load TLS configuration
+	var tlsConfig *tls.Config
+	if cfg.TLSEnabled() {
+		tlsConfig, err = server.LoadTLSConfig(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSMinVersion, cfg.TLSClientCAFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS configuration: %v", err)
+		}
+	}
 
 	// Create TCP server
-	tcpServer := server.NewTCPServer(
-		cfg.TCPPort,
-		sessionMgr,
-		roomMgr,
-		otpService,
-		emailService,
-	)
+	tcpServer, err := server.NewTCPServer(cfg.TCPPort, sessionMgr, roomMgr, accounts, messages, authenticator, server.Options{
+		InboxLimit: cfg.InboxLimit,
+		Bans:       bans,
+		Operators:  cfg.Operators,
+		Tokens:     tokens,
+		TLSConfig:  tlsConfig,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create TCP server: %v", err)
+	}
+
+	// Create WebSocket gateway sharing the TCP server's managers and router
+	var wsGateway *server.WebSocketGateway
+	if cfg.WSPort != "" {
+		wsGateway, err = server.NewWebSocketGateway(cfg.WSPort, cfg.WSPath, cfg.WSAllowedOrigins, cfg.WSTrustedProxies, tlsConfig, tcpServer)
+		if err != nil {
+			log.Fatalf("Failed to create WebSocket gateway: %v", err)
+		}
+		go func() {
+			if err := wsGateway.Start(); err != nil {
+				log.Fatalf("WebSocket gateway error: %v", err)
+			}
+		}()
+	}
+
+	// Create IRC front-end sharing the TCP server's managers and router
+	var ircServer *server.IRCServer
+	if cfg.IRCPort != "" {
+		ircServer = server.NewIRCServer(cfg.IRCPort, cfg.IRCServerName, tlsConfig, tcpServer)
+		go func() {
+			if err := ircServer.Start(); err != nil {
+				log.Fatalf("IRC server error: %v", err)
+			}
+		}()
+	}
+
+	// Create SSH front-end sharing the TCP server's managers and router
+	var sshServer *server.SSHServer
+	if cfg.SSHPort != "" {
+		keyStore, err := auth.NewKeyStore(cfg.SSHKeysFile)
+		if err != nil {
+			log.Fatalf("Failed to load SSH key store: %v", err)
+		}
+		sshServer, err = server.NewSSHServer(cfg.SSHPort, cfg.SSHHostKeyFile, keyStore, tcpServer)
+		if err != nil {
+			log.Fatalf("Failed to create SSH server: %v", err)
+		}
+		go func() {
+			if err := sshServer.Start(); err != nil {
+				log.Fatalf("SSH server error: %v", err)
+			}
+		}()
+	}
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -54,6 +172,24 @@ func main() {
 		if err := tcpServer.Stop(); err != nil {
 			log.Printf("Error stopping server: %v", err)
 		}
+		if sshServer != nil {
+			if err := sshServer.Stop(); err != nil {
+				log.Printf("Error stopping SSH server: %v", err)
+			}
+		}
+		if ircServer != nil {
+			if err := ircServer.Stop(); err != nil {
+				log.Printf("Error stopping IRC server: %v", err)
+			}
+		}
+		if wsGateway != nil {
+			if err := wsGateway.Stop(); err != nil {
+				log.Printf("Error stopping WebSocket gateway: %v", err)
+			}
+		}
+		if err := store.Close(); err != nil {
+			log.Printf("Error closing storage: %v", err)
+		}
 		os.Exit(0)
 	}()
 
@@ -62,3 +198,41 @@ func main() {
 		log.Fatalf("Server error: %v", err)
 	}
 }
+
+// newAuthenticator creates the authentication provider selected by AUTH_PROVIDER
+func newAuthenticator(cfg *config.Config) (auth.Authenticator, error) {
+	switch cfg.AuthProvider {
+	case "password":
+		return auth.NewPasswordAuthenticator(cfg.AuthPasswordFile)
+	case "totp":
+		return auth.NewTOTPAuthenticator(cfg.AuthTOTPFile)
+	case "cert":
+		return auth.NewClientCertAuthenticator(), nil
+	case "none":
+		return auth.NewNoneAuthenticator(), nil
+	default:
+		mailer, err := newMailer(cfg)
+		if err != nil {
+			return nil, err
+		}
+		otpService := auth.NewOTPService(cfg.OTPExpirationMinutes, cfg.OTPMaxRetries)
+		templates, err := auth.LoadMailTemplates(cfg.MailTemplateDir)
+		if err != nil {
+			return nil, err
+		}
+		emailService := auth.NewEmailService(mailer, cfg.MailFrom, cfg.ServerName, templates)
+		return auth.NewEmailOTPAuthenticator(otpService, emailService), nil
+	}
+}
+
+// newMailer creates the mail transport selected by MAIL_TRANSPORT
+func newMailer(cfg *config.Config) (auth.Mailer, error) {
+	switch cfg.MailTransport {
+	case "file":
+		return auth.NewFileMailer(cfg.MailDir)
+	case "log":
+		return auth.NewLogMailer(), nil
+	default:
+		return auth.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPSecurity, cfg.SMTPEmail, cfg.SMTPPassword)
+	}
+}
@@ -14,9 +14,67 @@ type Config struct {
 	// TCP Server
 	TCPPort string
 
+	// TLS (enabled when both the certificate and key are set)
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSMinVersion   string
+	TLSClientCAFile string
+
+	// WebSocket gateway (disabled when the port is empty)
+	WSPort           string
+	WSPath           string
+	WSAllowedOrigins []string
+	// WSTrustedProxies lists the proxy IPs and CIDR ranges whose
+	// X-Forwarded-For header names the real client
+	WSTrustedProxies []string
+
+	// IRC front-end (disabled when the port is empty)
+	IRCPort       string
+	IRCServerName string
+
+	// SSH front-end (disabled when the port is empty)
+	SSHPort        string
+	SSHHostKeyFile string
+	SSHKeysFile    string
+
+	// Authentication provider: email, password, totp, cert or none
+	AuthProvider     string
+	AuthPasswordFile string
+	AuthTOTPFile     string
+
+	// Storage backend for accounts, rooms and history: memory or bolt
+	StorageBackend string
+	StoragePath    string
+
+	// HistoryRetention is the default room history retention policy
+	HistoryRetention string
+	// HistoryReplay is the default history replayed to members joining a room
+	HistoryReplay string
+	// InboxLimit caps the private messages queued for an offline user
+	// (0 disables offline delivery)
+	InboxLimit int
+	// SearchIndexLimit caps the messages of each room and conversation kept
+	// in the in-memory search index (0 indexes everything)
+	SearchIndexLimit int
+
+	// Resume tokens let clients reconnect without authenticating again
+	ResumeSecret          string
+	ResumeTokenTTLHours   int
+	ResumeRevocationsFile string
+
+	// Mail transport: smtp, file (maildir) or log
+	MailTransport   string
+	MailFrom        string
+	MailDir         string
+	MailTemplateDir string
+
+	// ServerName is the deployment name used in emails
+	ServerName string
+
 	// SMTP Configuration
 	SMTPHost     string
 	SMTPPort     int
+	SMTPSecurity string
 	SMTPEmail    string
 	SMTPPassword string
 
@@ -27,6 +85,9 @@ type Config struct {
 	// Username Validation
 	UsernameMinLength int
 	UsernameMaxLength int
+
+	// Operators are the lowercase emails of the users allowed to run /admin
+	Operators []string
 }
 
 // Load reads configuration from environment variables
@@ -35,28 +96,119 @@ func Load() (*Config, error) {
 	_ = godotenv.Load()
 
 	cfg := &Config{
-		TCPPort:              getEnv("TCP_PORT", "8888"),
-		SMTPHost:             getEnv("SMTP_HOST", "smtp.gmail.com"),
-		SMTPPort:             getEnvAsInt("SMTP_PORT", 587),
-		SMTPEmail:            getEnv("SMTP_EMAIL", ""),
-		SMTPPassword:         getEnv("SMTP_PASSWORD", ""),
-		OTPExpirationMinutes: getEnvAsInt("OTP_EXPIRATION_MINUTES", 5),
-		OTPMaxRetries:        getEnvAsInt("OTP_MAX_RETRIES", 3),
-		UsernameMinLength:    getEnvAsInt("USERNAME_MIN_LENGTH", 3),
-		UsernameMaxLength:    getEnvAsInt("USERNAME_MAX_LENGTH", 16),
+		TCPPort:               getEnv("TCP_PORT", "8888"),
+		TLSCertFile:           getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:            getEnv("TLS_KEY_FILE", ""),
+		TLSMinVersion:         getEnv("TLS_MIN_VERSION", "1.2"),
+		TLSClientCAFile:       getEnv("TLS_CLIENT_CA_FILE", ""),
+		WSPort:                getEnv("WS_PORT", ""),
+		WSPath:                getEnv("WS_PATH", "/ws"),
+		WSAllowedOrigins:      getEnvAsList("WS_ALLOWED_ORIGINS"),
+		WSTrustedProxies:      getEnvAsList("WS_TRUSTED_PROXIES"),
+		IRCPort:               getEnv("IRC_PORT", ""),
+		IRCServerName:         getEnv("IRC_SERVER_NAME", "tcp-chat"),
+		SSHPort:               getEnv("SSH_PORT", ""),
+		SSHHostKeyFile:        getEnv("SSH_HOST_KEY_FILE", "ssh_host_ed25519_key"),
+		SSHKeysFile:           getEnv("SSH_KEYS_FILE", "ssh_keys.json"),
+		AuthProvider:          strings.ToLower(getEnv("AUTH_PROVIDER", "email")),
+		AuthPasswordFile:      getEnv("AUTH_PASSWORD_FILE", "passwords.txt"),
+		AuthTOTPFile:          getEnv("AUTH_TOTP_FILE", "totp_secrets.txt"),
+		StorageBackend:        strings.ToLower(getEnv("STORAGE_BACKEND", "memory")),
+		StoragePath:           getEnv("STORAGE_PATH", "chat.db"),
+		HistoryRetention:      getEnv("HISTORY_RETENTION", "forever"),
+		HistoryReplay:         getEnv("HISTORY_REPLAY", "5m"),
+		InboxLimit:            getEnvAsInt("INBOX_LIMIT", 100),
+		SearchIndexLimit:      getEnvAsInt("SEARCH_INDEX_LIMIT", 10000),
+		ResumeSecret:          getEnv("RESUME_SECRET", ""),
+		ResumeTokenTTLHours:   getEnvAsInt("RESUME_TOKEN_TTL_HOURS", 24),
+		ResumeRevocationsFile: getEnv("RESUME_REVOCATIONS_FILE", "resume_revocations.json"),
+		MailTransport:         strings.ToLower(getEnv("MAIL_TRANSPORT", "smtp")),
+		MailDir:               getEnv("MAIL_DIR", "maildir"),
+		MailTemplateDir:       getEnv("MAIL_TEMPLATE_DIR", ""),
+		ServerName:            getEnv("SERVER_NAME", "TCP Chat Server"),
+		SMTPHost:              getEnv("SMTP_HOST", "smtp.gmail.com"),
+		SMTPPort:              getEnvAsInt("SMTP_PORT", 587),
+		SMTPSecurity:          strings.ToLower(getEnv("SMTP_SECURITY", "starttls")),
+		SMTPEmail:             getEnv("SMTP_EMAIL", ""),
+		SMTPPassword:          getEnv("SMTP_PASSWORD", ""),
+		OTPExpirationMinutes:  getEnvAsInt("OTP_EXPIRATION_MINUTES", 5),
+		OTPMaxRetries:         getEnvAsInt("OTP_MAX_RETRIES", 3),
+		UsernameMinLength:     getEnvAsInt("USERNAME_MIN_LENGTH", 3),
+		UsernameMaxLength:     getEnvAsInt("USERNAME_MAX_LENGTH", 16),
+		Operators:             getEnvAsList("OPERATORS"),
+	}
+	for i, email := range cfg.Operators {
+		cfg.Operators[i] = strings.ToLower(email)
 	}
 
 	// Validate required fields
-	if cfg.SMTPEmail == "" {
-		return nil, fmt.Errorf("SMTP_EMAIL is required")
+	switch cfg.AuthProvider {
+	case "email":
+		if err := cfg.validateMail(); err != nil {
+			return nil, err
+		}
+	case "password", "totp", "none":
+	case "cert":
+		if cfg.TLSClientCAFile == "" {
+			return nil, fmt.Errorf("AUTH_PROVIDER=cert requires TLS_CLIENT_CA_FILE")
+		}
+	default:
+		return nil, fmt.Errorf("unknown AUTH_PROVIDER '%s' (expected email, password, totp, cert or none)", cfg.AuthProvider)
 	}
-	if cfg.SMTPPassword == "" {
-		return nil, fmt.Errorf("SMTP_PASSWORD is required")
+
+	if cfg.StorageBackend != "memory" && cfg.StorageBackend != "bolt" {
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND '%s' (expected memory or bolt)", cfg.StorageBackend)
+	}
+
+	if cfg.ResumeTokenTTLHours <= 0 {
+		return nil, fmt.Errorf("RESUME_TOKEN_TTL_HOURS must be positive")
+	}
+
+	if cfg.InboxLimit < 0 {
+		return nil, fmt.Errorf("INBOX_LIMIT must not be negative")
+	}
+
+	if cfg.SearchIndexLimit < 0 {
+		return nil, fmt.Errorf("SEARCH_INDEX_LIMIT must not be negative")
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.TLSClientCAFile != "" && !cfg.TLSEnabled() {
+		return nil, fmt.Errorf("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+
+	cfg.MailFrom = getEnv("MAIL_FROM", cfg.SMTPEmail)
+	if cfg.MailFrom == "" {
+		cfg.MailFrom = "tcp-chat@localhost"
 	}
 
 	return cfg, nil
 }
 
+// validateMail validates the mail transport settings
+func (c *Config) validateMail() error {
+	switch c.MailTransport {
+	case "smtp":
+		if c.SMTPEmail == "" {
+			return fmt.Errorf("SMTP_EMAIL is required")
+		}
+		if c.SMTPPassword == "" && c.SMTPSecurity != "none" {
+			return fmt.Errorf("SMTP_PASSWORD is required")
+		}
+	case "file", "log":
+	default:
+		return fmt.Errorf("unknown MAIL_TRANSPORT '%s' (expected smtp, file or log)", c.MailTransport)
+	}
+	return nil
+}
+
+// TLSEnabled reports whether the server should listen with TLS
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
 // getEnv retrieves an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -78,3 +230,18 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return value
 }
+
+// getEnvAsList retrieves a comma separated environment variable as a list
+func getEnvAsList(key string) []string {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return nil
+	}
+	values := make([]string, 0)
+	for _, v := range strings.Split(valueStr, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,103 @@
+// Package account keeps registered user accounts, binding a verified email
+// address to a username that nobody else can claim.
+package account
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/storage"
+)
+
+// Profile field limits
+const (
+	MaxDisplayNameLength = 32
+	MaxBioLength         = 160
+)
+
+// Account is a registered user
+type Account = storage.Account
+
+// Store manages accounts on top of a storage backend. Emails and usernames
+// are matched case-insensitively.
+type Store struct {
+	backend storage.Store
+	mu      sync.Mutex // serialises read-modify-write updates
+}
+
+// NewStore creates an account store using the given backend
+func NewStore(backend storage.Store) *Store {
+	return &Store{backend: backend}
+}
+
+// GetByEmail returns the account registered to an email
+func (s *Store) GetByEmail(email string) (*Account, bool) {
+	return s.lookup(s.backend.GetAccount(email))
+}
+
+// GetByUsername returns the account owning a username
+func (s *Store) GetByUsername(username string) (*Account, bool) {
+	return s.lookup(s.backend.GetAccountByUsername(username))
+}
+
+// Create registers a username for an email. It fails if the email already
+// has an account or the username belongs to someone else.
+func (s *Store) Create(email, username string) (*Account, error) {
+	now := time.Now()
+	acct := &Account{
+		Username:  username,
+		Email:     email,
+		CreatedAt: now,
+		LastSeen:  now,
+	}
+
+	switch err := s.backend.CreateAccount(acct); {
+	case errors.Is(err, storage.ErrEmailTaken):
+		return nil, fmt.Errorf("an account already exists for %s", email)
+	case errors.Is(err, storage.ErrUsernameTaken):
+		return nil, fmt.Errorf("username '%s' is registered to another account", username)
+	case err != nil:
+		return nil, fmt.Errorf("failed to create account: %w", err)
+	}
+	return acct, nil
+}
+
+// Update applies fn to the account registered to an email and persists the
+// change. fn must not change the email or username.
+func (s *Store) Update(email string, fn func(*Account)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct, err := s.backend.GetAccount(email)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("no account for %s", email)
+	}
+	if err != nil {
+		return err
+	}
+	fn(acct)
+	return s.backend.UpdateAccount(acct)
+}
+
+// Count returns the number of registered accounts
+func (s *Store) Count() int {
+	count, err := s.backend.CountAccounts()
+	if err != nil {
+		log.Printf("Failed to count accounts: %v", err)
+	}
+	return count
+}
+
+// lookup converts a backend lookup result, logging unexpected errors
+func (s *Store) lookup(acct *Account, err error) (*Account, bool) {
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Failed to look up account: %v", err)
+		}
+		return nil, false
+	}
+	return acct, true
+}
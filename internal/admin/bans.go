@@ -0,0 +1,102 @@
+// Package admin holds the server-wide state managed by operators.
+package admin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/storage"
+)
+
+// BanList keeps banned users, emails and IP addresses off the server. Bans
+// are cached in memory and persisted to the store.
+type BanList struct {
+	store storage.Store
+	bans  map[string]*storage.Ban // key: lowercase target
+	mu    sync.RWMutex
+}
+
+// NewBanList creates a ban list, loading the bans kept in store
+func NewBanList(store storage.Store) (*BanList, error) {
+	saved, err := store.ListBans()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bans: %w", err)
+	}
+
+	b := &BanList{
+		store: store,
+		bans:  make(map[string]*storage.Ban, len(saved)),
+	}
+	for _, ban := range saved {
+		b.bans[strings.ToLower(ban.Target)] = ban
+	}
+	return b, nil
+}
+
+// Match returns the active ban matching a user, if any. Any of username,
+// email and ip may be empty.
+func (b *BanList) Match(username, email, ip string) (*storage.Ban, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := time.Now()
+	for _, ban := range b.bans {
+		if ban.Active(now) && ban.Matches(username, email, ip) {
+			return ban, true
+		}
+	}
+	return nil, false
+}
+
+// Add bans a target, replacing any earlier ban of it
+func (b *BanList) Add(ban *storage.Ban) error {
+	if err := b.store.SaveBan(ban); err != nil {
+		return fmt.Errorf("failed to save ban: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bans[strings.ToLower(ban.Target)] = ban
+	return nil
+}
+
+// Remove lifts the ban of a target. It reports whether the target was
+// banned.
+func (b *BanList) Remove(target string) (bool, error) {
+	key := strings.ToLower(target)
+
+	b.mu.RLock()
+	_, exists := b.bans[key]
+	b.mu.RUnlock()
+	if !exists {
+		return false, nil
+	}
+
+	if err := b.store.DeleteBan(target); err != nil {
+		return false, fmt.Errorf("failed to delete ban: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.bans, key)
+	return true, nil
+}
+
+// List returns the active bans, oldest first
+func (b *BanList) List() []*storage.Ban {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := time.Now()
+	bans := make([]*storage.Ban, 0, len(b.bans))
+	for _, ban := range b.bans {
+		if ban.Active(now) {
+			bans = append(bans, ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].At.Before(bans[j].At) })
+	return bans
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// emailRegex matches syntactically valid email addresses
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
+
+// IsValidEmail validates an email address
+func IsValidEmail(email string) bool {
+	return emailRegex.MatchString(email)
+}
+
+// Prompter lets an authenticator talk to the user over the session's transport
+type Prompter interface {
+	// Prompt shows a prompt and returns the user's (non-empty) answer
+	Prompt(text string) (string, error)
+	// Notify shows an informational message
+	Notify(text string) error
+}
+
+// Request describes a single authentication attempt
+type Request struct {
+	Prompter
+
+	// IP is the address the user is connecting from
+	IP string
+}
+
+// Authenticator verifies a user's identity and returns the verified email.
+// Implementations may run as many prompts as they need. Users whose transport
+// already proved their email (trusted TLS client certificate, bound SSH key)
+// are accepted by the server without consulting the authenticator.
+type Authenticator interface {
+	// Name returns the provider name used in configuration
+	Name() string
+	// Authenticate runs the provider's flow
+	Authenticate(req *Request) (string, error)
+}
+
+// promptEmail asks for an email address and validates it
+func promptEmail(req *Request) (string, error) {
+	email, err := req.Prompt("Enter your email address below")
+	if err != nil {
+		return "", err
+	}
+	email = strings.TrimSpace(email)
+	if !IsValidEmail(email) {
+		return "", fmt.Errorf("invalid email address")
+	}
+	return email, nil
+}
+
+// EmailOTPAuthenticator verifies an email address with a one-time password
+type EmailOTPAuthenticator struct {
+	otpService   *OTPService
+	emailService *EmailService
+}
+
+// NewEmailOTPAuthenticator creates an email OTP authenticator
+func NewEmailOTPAuthenticator(otpService *OTPService, emailService *EmailService) *EmailOTPAuthenticator {
+	return &EmailOTPAuthenticator{
+		otpService:   otpService,
+		emailService: emailService,
+	}
+}
+
+// Name returns the provider name
+func (a *EmailOTPAuthenticator) Name() string {
+	return "email"
+}
+
+// Authenticate sends an OTP to the user's email and validates it
+func (a *EmailOTPAuthenticator) Authenticate(req *Request) (string, error) {
+	email, err := promptEmail(req)
+	if err != nil {
+		return "", err
+	}
+	req.Notify("Please wait while we verify your email address...")
+
+	// Generate and send OTP
+	otp, err := a.otpService.Generate(email)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate OTP: %w", err)
+	}
+
+	err = a.emailService.SendOTP(email, &OTPMailData{
+		Code:          otp,
+		ExpiryMinutes: a.otpService.ExpirationMinutes(),
+		RequestIP:     req.IP,
+	})
+	if err != nil {
+		a.otpService.Clear(email)
+		return "", fmt.Errorf("failed to send OTP: %w", err)
+	}
+
+	req.Notify("OTP sent to your email. Please check your inbox.")
+
+	// Request OTP
+	otpCode, err := req.Prompt("Enter OTP code:")
+	if err != nil {
+		return "", err
+	}
+
+	// Validate OTP
+	if err := a.otpService.Validate(email, strings.TrimSpace(otpCode)); err != nil {
+		return "", err
+	}
+
+	req.Notify("OTP verified successfully!")
+	return email, nil
+}
+
+// ClientCertAuthenticator only admits users whose transport proved their
+// email, i.e. a trusted TLS client certificate (or a bound SSH key). Those
+// users never reach the authenticator, so everyone else is rejected.
+type ClientCertAuthenticator struct{}
+
+// NewClientCertAuthenticator creates a client certificate authenticator
+func NewClientCertAuthenticator() *ClientCertAuthenticator {
+	return &ClientCertAuthenticator{}
+}
+
+// Name returns the provider name
+func (a *ClientCertAuthenticator) Name() string {
+	return "cert"
+}
+
+// Authenticate rejects users without a trusted client certificate
+func (a *ClientCertAuthenticator) Authenticate(req *Request) (string, error) {
+	return "", fmt.Errorf("a trusted client certificate is required")
+}
+
+// NoneAuthenticator trusts whatever email the user enters.
+// It is meant for local development only.
+type NoneAuthenticator struct{}
+
+// NewNoneAuthenticator creates an authenticator that performs no verification
+func NewNoneAuthenticator() *NoneAuthenticator {
+	log.Println("WARNING: authentication is disabled (AUTH_PROVIDER=none); do not use in production")
+	return &NoneAuthenticator{}
+}
+
+// Name returns the provider name
+func (a *NoneAuthenticator) Name() string {
+	return "none"
+}
+
+// Authenticate accepts any syntactically valid email
+func (a *NoneAuthenticator) Authenticate(req *Request) (string, error) {
+	return promptEmail(req)
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// KeyStore binds SSH public key fingerprints to verified email addresses.
+// Bindings are persisted to a JSON file so they survive restarts.
+type KeyStore struct {
+	path     string
+	bindings map[string]string // key: fingerprint, value: email
+	mu       sync.RWMutex
+}
+
+// NewKeyStore creates a key store backed by the given file, loading any
+// existing bindings
+func NewKeyStore(path string) (*KeyStore, error) {
+	store := &KeyStore{
+		path:     path,
+		bindings: make(map[string]string),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, fmt.Errorf("failed to read key store: %w", err)
+	}
+	if err := json.Unmarshal(data, &store.bindings); err != nil {
+		return nil, fmt.Errorf("failed to parse key store: %w", err)
+	}
+	return store, nil
+}
+
+// Lookup returns the email bound to a key fingerprint
+func (k *KeyStore) Lookup(fingerprint string) (string, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	email, exists := k.bindings[fingerprint]
+	return email, exists
+}
+
+// Bind binds a key fingerprint to an email and persists the change
+func (k *KeyStore) Bind(fingerprint, email string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.bindings[fingerprint] = email
+	return k.save()
+}
+
+// save writes the bindings to disk. Caller must hold the lock
+func (k *KeyStore) save() error {
+	data, err := json.MarshalIndent(k.bindings, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn file
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write key store: %w", err)
+	}
+	return os.Rename(tmp, k.path)
+}
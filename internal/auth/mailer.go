@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mail is an outgoing email
+type Mail struct {
+	From      string
+	To        string
+	Subject   string
+	TextBody  string
+	HTMLBody  string
+	Date      time.Time
+	MessageID string
+}
+
+// Bytes renders the mail as an RFC 5322 message. When both bodies are set
+// the mail is sent as multipart/alternative with the plain-text part first.
+func (m *Mail) Bytes() []byte {
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	messageID := m.MessageID
+	if messageID == "" {
+		messageID = newMessageID(m.From)
+	}
+
+	var message bytes.Buffer
+	message.WriteString(fmt.Sprintf("From: %s\r\n", m.From))
+	message.WriteString(fmt.Sprintf("To: %s\r\n", m.To))
+	message.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", m.Subject)))
+	message.WriteString(fmt.Sprintf("Date: %s\r\n", date.Format(time.RFC1123Z)))
+	message.WriteString(fmt.Sprintf("Message-ID: %s\r\n", messageID))
+	message.WriteString("MIME-Version: 1.0\r\n")
+
+	switch {
+	case m.TextBody != "" && m.HTMLBody != "":
+		writer := multipart.NewWriter(&message)
+		message.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q\r\n\r\n", writer.Boundary()))
+		writePart(writer, "text/plain", m.TextBody)
+		writePart(writer, "text/html", m.HTMLBody)
+		writer.Close()
+	case m.HTMLBody != "":
+		writeBody(&message, "text/html", m.HTMLBody)
+	default:
+		writeBody(&message, "text/plain", m.TextBody)
+	}
+
+	return message.Bytes()
+}
+
+// writePart writes a quoted-printable part of a multipart message
+func writePart(writer *multipart.Writer, contentType, body string) {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType+"; charset=UTF-8")
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return
+	}
+	qp := quotedprintable.NewWriter(part)
+	qp.Write([]byte(body))
+	qp.Close()
+}
+
+// writeBody writes a single quoted-printable body with its headers
+func writeBody(message *bytes.Buffer, contentType, body string) {
+	message.WriteString(fmt.Sprintf("Content-Type: %s; charset=UTF-8\r\n", contentType))
+	message.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(message)
+	qp.Write([]byte(body))
+	qp.Close()
+}
+
+// newMessageID generates a unique Message-ID in the sender's domain
+func newMessageID(from string) string {
+	domain := "localhost"
+	if idx := strings.LastIndex(from, "@"); idx != -1 {
+		domain = strings.Trim(from[idx+1:], "> ")
+	}
+	random := make([]byte, 12)
+	rand.Read(random)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(random), domain)
+}
+
+// Mailer delivers emails
+type Mailer interface {
+	Send(mail *Mail) error
+}
+
+// MemoryMailer keeps sent mails in memory. It is meant for tests, which can
+// read the OTP codes back out of the captured mails.
+type MemoryMailer struct {
+	mails []*Mail
+	mu    sync.Mutex
+}
+
+// NewMemoryMailer creates an in-memory mailer
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send records the mail
+func (m *MemoryMailer) Send(mail *Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *mail
+	m.mails = append(m.mails, &copied)
+	return nil
+}
+
+// Mails returns every mail sent so far
+func (m *MemoryMailer) Mails() []*Mail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Mail(nil), m.mails...)
+}
+
+// LastTo returns the most recent mail sent to an address
+func (m *MemoryMailer) LastTo(to string) (*Mail, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.mails) - 1; i >= 0; i-- {
+		if m.mails[i].To == to {
+			return m.mails[i], true
+		}
+	}
+	return nil, false
+}
+
+// LogMailer writes mails to the server log instead of delivering them.
+// Useful for development and CI, where the OTP can be read from the output.
+type LogMailer struct{}
+
+// NewLogMailer creates a mailer that logs mails
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+// Send logs the mail
+func (m *LogMailer) Send(mail *Mail) error {
+	log.Printf("Mail to %s (not delivered, MAIL_TRANSPORT=log):\n%s", mail.To, mail.Bytes())
+	return nil
+}
+
+// FileMailer delivers mails into a Maildir (tmp/, new/, cur/), which most
+// mail clients and tools can read directly.
+type FileMailer struct {
+	dir string
+}
+
+// NewFileMailer creates a mailer writing to a Maildir, creating it if needed
+func NewFileMailer(dir string) (*FileMailer, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create maildir: %w", err)
+		}
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+// Send writes the mail to tmp/ and moves it into new/
+func (m *FileMailer) Send(mail *Mail) error {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	name := fmt.Sprintf("%d.%s.%s", time.Now().UnixNano(), hex.EncodeToString(suffix), host)
+
+	tmp := filepath.Join(m.dir, "tmp", name)
+	if err := os.WriteFile(tmp, mail.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write mail: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(m.dir, "new", name)); err != nil {
+		return fmt.Errorf("failed to deliver mail: %w", err)
+	}
+	return nil
+}
@@ -122,6 +122,11 @@ func (s *OTPService) cleanupExpired() {
 	}
 }
 
+// ExpirationMinutes returns how long generated OTPs stay valid
+func (s *OTPService) ExpirationMinutes() int {
+	return s.expirationMinutes
+}
+
 // HasPendingOTP checks if an email has a pending OTP
 func (s *OTPService) HasPendingOTP(email string) bool {
 	s.mu.RLock()
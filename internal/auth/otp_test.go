@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testEmail = "alice@example.com"
+
+// otpCodeRegex finds the code in the plain text OTP email
+var otpCodeRegex = regexp.MustCompile(`\b\d{6}\b`)
+
+// scriptedPrompter answers the email prompt with testEmail and the OTP
+// prompt with whatever answerOTP returns
+type scriptedPrompter struct {
+	answerOTP func() string
+	notices   []string
+}
+
+func (p *scriptedPrompter) Prompt(text string) (string, error) {
+	switch {
+	case strings.HasPrefix(text, "Enter your email"):
+		return testEmail, nil
+	case strings.HasPrefix(text, "Enter OTP"):
+		return p.answerOTP(), nil
+	}
+	return "", fmt.Errorf("unexpected prompt %q", text)
+}
+
+func (p *scriptedPrompter) Notify(text string) error {
+	p.notices = append(p.notices, text)
+	return nil
+}
+
+// newTestAuthenticator wires an email OTP authenticator to an in-memory mailer
+func newTestAuthenticator(t *testing.T, maxRetries int) (*EmailOTPAuthenticator, *OTPService, *MemoryMailer) {
+	t.Helper()
+	templates, err := LoadMailTemplates("")
+	if err != nil {
+		t.Fatalf("LoadMailTemplates: %v", err)
+	}
+	otpService := NewOTPService(5, maxRetries)
+	mailer := NewMemoryMailer()
+	emailService := NewEmailService(mailer, "chat@example.com", "Test Chat", templates)
+	return NewEmailOTPAuthenticator(otpService, emailService), otpService, mailer
+}
+
+// mailedCode returns the OTP code from the last email sent to testEmail
+func mailedCode(t *testing.T, mailer *MemoryMailer) string {
+	t.Helper()
+	mail, ok := mailer.LastTo(testEmail)
+	if !ok {
+		t.Fatalf("no email sent to %s", testEmail)
+	}
+	code := otpCodeRegex.FindString(mail.TextBody)
+	if code == "" {
+		t.Fatalf("no OTP code in email body:\n%s", mail.TextBody)
+	}
+	return code
+}
+
+// wrongCode returns a code that differs from code
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "000001"
+	}
+	return "000000"
+}
+
+func TestEmailOTPValidCode(t *testing.T) {
+	authenticator, otpService, mailer := newTestAuthenticator(t, 3)
+	prompter := &scriptedPrompter{answerOTP: func() string { return mailedCode(t, mailer) }}
+
+	email, err := authenticator.Authenticate(&Request{Prompter: prompter, IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if email != testEmail {
+		t.Errorf("Authenticate returned %q, want %q", email, testEmail)
+	}
+
+	mail, _ := mailer.LastTo(testEmail)
+	if !strings.Contains(mail.Subject, "Test Chat") {
+		t.Errorf("subject %q does not name the server", mail.Subject)
+	}
+	if !strings.Contains(mail.TextBody, "192.0.2.1") {
+		t.Errorf("email body does not mention the requesting IP:\n%s", mail.TextBody)
+	}
+	if otpService.HasPendingOTP(testEmail) {
+		t.Error("OTP is still pending after a successful login")
+	}
+}
+
+func TestEmailOTPWrongCode(t *testing.T) {
+	authenticator, otpService, mailer := newTestAuthenticator(t, 3)
+	prompter := &scriptedPrompter{answerOTP: func() string { return wrongCode(mailedCode(t, mailer)) }}
+
+	_, err := authenticator.Authenticate(&Request{Prompter: prompter})
+	if err == nil || err.Error() != "invalid OTP code" {
+		t.Fatalf("Authenticate error = %v, want invalid OTP code", err)
+	}
+	if !otpService.HasPendingOTP(testEmail) {
+		t.Error("a wrong code should leave the OTP pending for another try")
+	}
+}
+
+func TestEmailOTPExpired(t *testing.T) {
+	authenticator, otpService, mailer := newTestAuthenticator(t, 3)
+	prompter := &scriptedPrompter{answerOTP: func() string {
+		otpService.mu.Lock()
+		otpService.otps[testEmail].ExpiresAt = time.Now().Add(-time.Second)
+		otpService.mu.Unlock()
+		return mailedCode(t, mailer)
+	}}
+
+	_, err := authenticator.Authenticate(&Request{Prompter: prompter})
+	if err == nil || err.Error() != "OTP has expired" {
+		t.Fatalf("Authenticate error = %v, want OTP has expired", err)
+	}
+	if err := otpService.Validate(testEmail, mailedCode(t, mailer)); err == nil {
+		t.Error("an expired OTP was accepted on a later try")
+	}
+}
+
+func TestEmailOTPRetryLimit(t *testing.T) {
+	const maxRetries = 2
+	authenticator, otpService, mailer := newTestAuthenticator(t, maxRetries)
+	prompter := &scriptedPrompter{answerOTP: func() string { return wrongCode(mailedCode(t, mailer)) }}
+
+	// The login uses the first attempt; the rest are spent directly
+	if _, err := authenticator.Authenticate(&Request{Prompter: prompter}); err == nil {
+		t.Fatal("Authenticate accepted a wrong code")
+	}
+	code := mailedCode(t, mailer)
+	for i := 1; i < maxRetries; i++ {
+		if err := otpService.Validate(testEmail, wrongCode(code)); err == nil || err.Error() != "invalid OTP code" {
+			t.Fatalf("attempt %d: Validate error = %v, want invalid OTP code", i+1, err)
+		}
+	}
+
+	// Out of attempts, even the right code is refused and the OTP is gone
+	err := otpService.Validate(testEmail, code)
+	if err == nil || err.Error() != "maximum verification attempts exceeded" {
+		t.Fatalf("Validate error = %v, want maximum verification attempts exceeded", err)
+	}
+	if otpService.HasPendingOTP(testEmail) {
+		t.Error("OTP is still pending after the retry limit")
+	}
+}
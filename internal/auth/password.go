@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordAuthenticator verifies users against a static password file.
+// Each line holds "email:bcrypt-hash" (the format produced by
+// `htpasswd -nB`); blank lines and lines starting with '#' are ignored.
+type PasswordAuthenticator struct {
+	path   string
+	hashes map[string][]byte // key: email
+	mu     sync.RWMutex
+}
+
+// NewPasswordAuthenticator creates a password authenticator from a password file
+func NewPasswordAuthenticator(path string) (*PasswordAuthenticator, error) {
+	a := &PasswordAuthenticator{path: path}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Name returns the provider name
+func (a *PasswordAuthenticator) Name() string {
+	return "password"
+}
+
+// Reload re-reads the password file
+func (a *PasswordAuthenticator) Reload() error {
+	entries, err := readCredentialFile(a.path)
+	if err != nil {
+		return err
+	}
+
+	hashes := make(map[string][]byte, len(entries))
+	for email, hash := range entries {
+		hashes[email] = []byte(hash)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.hashes = hashes
+	return nil
+}
+
+// Authenticate prompts for an email and password and checks the bcrypt hash
+func (a *PasswordAuthenticator) Authenticate(req *Request) (string, error) {
+	email, err := promptEmail(req)
+	if err != nil {
+		return "", err
+	}
+
+	password, err := req.Prompt("Enter password:")
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.RLock()
+	hash, exists := a.hashes[strings.ToLower(email)]
+	a.mu.RUnlock()
+
+	if !exists {
+		// Compare anyway so unknown users take as long as wrong passwords
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return "", fmt.Errorf("invalid email or password")
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		return "", fmt.Errorf("invalid email or password")
+	}
+
+	req.Notify("Password verified successfully!")
+	return email, nil
+}
+
+// dummyHash is compared against for unknown users (bcrypt of a throwaway password)
+var dummyHash = []byte("$2a$10$vd24mHNmkh1yJQA3bFnBve/vgxkEj9kjiKxQI.c0UWU7BycELPDge")
+
+// readCredentialFile reads an "email:secret" file, lower-casing the emails
+func readCredentialFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open credential file: %w", err)
+	}
+	defer file.Close()
+
+	entries := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		email, secret, found := strings.Cut(line, ":")
+		if !found || email == "" || secret == "" {
+			return nil, fmt.Errorf("%s:%d: expected email:secret", path, lineNo)
+		}
+		entries[strings.ToLower(strings.TrimSpace(email))] = strings.TrimSpace(secret)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read credential file: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResumeClaims is the session state carried by a resume token
+type ResumeClaims struct {
+	Email    string `json:"email"`
+	Username string `json:"user"`
+	Room     string `json:"room"`
+	// Rooms lists every joined room in join order, including Room
+	Rooms []string `json:"rooms,omitempty"`
+	// IssuedAt is in unix nanoseconds so revocation can't race a new token
+	IssuedAt int64 `json:"iat"`
+	// ExpiresAt is in unix seconds
+	ExpiresAt int64 `json:"exp"`
+}
+
+// ResumeTokenService issues and verifies signed, expiring resume tokens that
+// let a reconnecting client restore its session without authenticating
+// again. Tokens are HMAC-SHA256 signed and carry their own state, so the
+// server only has to remember revocations.
+type ResumeTokenService struct {
+	secret  []byte
+	ttl     time.Duration
+	path    string
+	revoked map[string]int64 // key: email, value: tokens issued at or before are invalid
+	mu      sync.RWMutex
+}
+
+// NewResumeTokenService creates a token service. If secret is empty a random
+// one is generated, which means tokens don't survive a restart. Revocations
+// are persisted to revocationFile when it is set.
+func NewResumeTokenService(secret string, ttl time.Duration, revocationFile string) (*ResumeTokenService, error) {
+	s := &ResumeTokenService{
+		secret:  []byte(secret),
+		ttl:     ttl,
+		path:    revocationFile,
+		revoked: make(map[string]int64),
+	}
+
+	if secret == "" {
+		s.secret = make([]byte, 32)
+		if _, err := rand.Read(s.secret); err != nil {
+			return nil, fmt.Errorf("failed to generate resume secret: %w", err)
+		}
+		log.Printf("RESUME_SECRET not set; resume tokens will not survive a restart")
+	}
+
+	if revocationFile == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(revocationFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read resume revocations: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.revoked); err != nil {
+		return nil, fmt.Errorf("failed to parse resume revocations: %w", err)
+	}
+	return s, nil
+}
+
+// Issue creates a token restoring the given identity and rooms, with room
+// as the current one
+func (s *ResumeTokenService) Issue(email, username, room string, rooms []string) (string, error) {
+	now := time.Now()
+	payload, err := json.Marshal(&ResumeClaims{
+		Email:     email,
+		Username:  username,
+		Room:      room,
+		Rooms:     rooms,
+		IssuedAt:  now.UnixNano(),
+		ExpiresAt: now.Add(s.ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded)), nil
+}
+
+// Verify checks a token's signature, expiry and revocation and returns its claims
+func (s *ResumeTokenService) Verify(token string) (*ResumeClaims, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, fmt.Errorf("malformed token")
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, s.sign(encoded)) {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed token")
+	}
+	var claims ResumeClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("token has expired")
+	}
+
+	s.mu.RLock()
+	revokedAt := s.revoked[claims.Email]
+	s.mu.RUnlock()
+	if claims.IssuedAt <= revokedAt {
+		return nil, fmt.Errorf("token has been revoked")
+	}
+
+	return &claims, nil
+}
+
+// Revoke invalidates every token issued so far for an email
+func (s *ResumeTokenService) Revoke(email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revoked[email] = time.Now().UnixNano()
+	if s.path == "" {
+		return nil
+	}
+	return s.save()
+}
+
+// sign computes the token signature over the encoded payload
+func (s *ResumeTokenService) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// save writes the revocations to disk. Caller must hold the lock
+func (s *ResumeTokenService) save() error {
+	// Revocations older than the token lifetime no longer matter
+	cutoff := time.Now().Add(-s.ttl).UnixNano()
+	for email, revokedAt := range s.revoked {
+		if revokedAt < cutoff {
+			delete(s.revoked, email)
+		}
+	}
+
+	data, err := json.MarshalIndent(s.revoked, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a torn file
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write resume revocations: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
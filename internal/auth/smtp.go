@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// SMTP connection security modes
+const (
+	// SMTPSecurityStartTLS upgrades a plain connection with STARTTLS (usually port 587)
+	SMTPSecurityStartTLS = "starttls"
+	// SMTPSecurityTLS connects with implicit TLS (usually port 465)
+	SMTPSecurityTLS = "tls"
+	// SMTPSecurityNone sends in cleartext (local relays only)
+	SMTPSecurityNone = "none"
+)
+
+// SMTPMailer delivers mails through an SMTP server
+type SMTPMailer struct {
+	host     string
+	port     int
+	security string
+	auth     smtp.Auth
+}
+
+// NewSMTPMailer creates an SMTP mailer. Authentication is skipped when the
+// username is empty.
+func NewSMTPMailer(host string, port int, security, username, password string) (*SMTPMailer, error) {
+	security = strings.ToLower(security)
+	switch security {
+	case SMTPSecurityStartTLS, SMTPSecurityTLS, SMTPSecurityNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP security '%s' (expected starttls, tls or none)", security)
+	}
+
+	m := &SMTPMailer{
+		host:     host,
+		port:     port,
+		security: security,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m, nil
+}
+
+// Send delivers a mail
+func (m *SMTPMailer) Send(mail *Mail) error {
+	client, err := m.dial()
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	defer client.Close()
+
+	if err := m.deliver(client, mail); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return client.Quit()
+}
+
+// dial connects to the server and sets up the configured transport security
+func (m *SMTPMailer) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.host, fmt.Sprintf("%d", m.port))
+	tlsConfig := &tls.Config{ServerName: m.host}
+
+	if m.security == SMTPSecurityTLS {
+		conn, err := tls.Dial("tcp", addr, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return smtp.NewClient(conn, m.host)
+	}
+
+	client, err := smtp.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	if m.security == SMTPSecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// deliver runs the SMTP transaction for a mail
+func (m *SMTPMailer) deliver(client *smtp.Client, mail *Mail) error {
+	if m.auth != nil {
+		if err := client.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(mail.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(mail.To); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(mail.Bytes()); err != nil {
+		return err
+	}
+	return w.Close()
+}
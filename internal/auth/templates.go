@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates/*
+var defaultTemplates embed.FS
+
+// OTP template file names. A template directory may override any of them;
+// missing files fall back to the built-in defaults.
+const (
+	otpSubjectTemplate = "otp_subject.txt"
+	otpTextTemplate    = "otp.txt"
+	otpHTMLTemplate    = "otp.html"
+)
+
+// OTPMailData holds the variables available to the OTP email templates
+type OTPMailData struct {
+	Code          string
+	ExpiryMinutes int
+	ServerName    string
+	RequestIP     string
+	Username      string
+	Email         string
+}
+
+// MailTemplates renders the OTP emails
+type MailTemplates struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// LoadMailTemplates loads the OTP templates, preferring files in dir (if set)
+// over the built-in defaults
+func LoadMailTemplates(dir string) (*MailTemplates, error) {
+	subject, err := readTemplate(dir, otpSubjectTemplate)
+	if err != nil {
+		return nil, err
+	}
+	text, err := readTemplate(dir, otpTextTemplate)
+	if err != nil {
+		return nil, err
+	}
+	html, err := readTemplate(dir, otpHTMLTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &MailTemplates{}
+	if t.subject, err = texttemplate.New(otpSubjectTemplate).Parse(subject); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", otpSubjectTemplate, err)
+	}
+	if t.text, err = texttemplate.New(otpTextTemplate).Parse(text); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", otpTextTemplate, err)
+	}
+	if t.html, err = htmltemplate.New(otpHTMLTemplate).Parse(html); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", otpHTMLTemplate, err)
+	}
+	return t, nil
+}
+
+// readTemplate reads a template from dir, falling back to the embedded default
+func readTemplate(dir, name string) (string, error) {
+	if dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return string(data), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read template %s: %w", name, err)
+		}
+	}
+
+	data, err := defaultTemplates.ReadFile("templates/" + name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read default template %s: %w", name, err)
+	}
+	return string(data), nil
+}
+
+// RenderOTP renders the subject, plain-text and HTML bodies of an OTP email
+func (t *MailTemplates) RenderOTP(data *OTPMailData) (subject, text, html string, err error) {
+	var buf bytes.Buffer
+	if err = t.subject.Execute(&buf, data); err != nil {
+		return "", "", "", fmt.Errorf("failed to render subject: %w", err)
+	}
+	// Headers must stay on a single line
+	subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+	if err = t.text.Execute(&buf, data); err != nil {
+		return "", "", "", fmt.Errorf("failed to render text body: %w", err)
+	}
+	text = buf.String()
+
+	buf.Reset()
+	if err = t.html.Execute(&buf, data); err != nil {
+		return "", "", "", fmt.Errorf("failed to render HTML body: %w", err)
+	}
+	html = buf.String()
+
+	return subject, text, html, nil
+}
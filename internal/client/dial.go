@@ -0,0 +1,73 @@
+// Package client contains connection helpers shared by the bundled chat clients.
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+)
+
+// DialOptions controls how a client connects to the server
+type DialOptions struct {
+	// TLS enables TLS for the connection
+	TLS bool
+	// Insecure skips verification of the server certificate
+	Insecure bool
+	// CAFile is a PEM bundle used to verify the server certificate
+	CAFile string
+	// CertFile and KeyFile are an optional client certificate, which lets
+	// the server skip the email OTP step
+	CertFile string
+	KeyFile  string
+}
+
+// Dial connects to the chat server at address
+func Dial(address string, opts DialOptions) (net.Conn, error) {
+	if !opts.TLS {
+		return net.Dial("tcp", address)
+	}
+
+	cfg, err := opts.tlsConfig(address)
+	if err != nil {
+		return nil, err
+	}
+	return tls.Dial("tcp", address, cfg)
+}
+
+// tlsConfig builds the client TLS configuration
+func (o DialOptions) tlsConfig(address string) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+
+	cfg := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: o.Insecure,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
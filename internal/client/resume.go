@@ -0,0 +1,91 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+)
+
+// TokenStore keeps the resume token handed out by each server so a dropped
+// connection can be restored without another OTP round-trip
+type TokenStore struct {
+	dir string
+}
+
+// NewTokenStore creates a token store in the user's configuration directory
+func NewTokenStore() (*TokenStore, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate config directory: %w", err)
+	}
+	return &TokenStore{dir: filepath.Join(base, "tcp-chat")}, nil
+}
+
+// Load returns the saved token for a server address, or "" if there is none
+func (t *TokenStore) Load(address string) string {
+	data, err := os.ReadFile(t.path(address))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Save stores the token for a server address
+func (t *TokenStore) Save(address, token string) error {
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(t.path(address), []byte(token+"\n"), 0600)
+}
+
+// Clear forgets the token for a server address
+func (t *TokenStore) Clear(address string) error {
+	err := os.Remove(t.path(address))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// path returns the token file for a server address
+func (t *TokenStore) path(address string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return r
+		}
+		return '_'
+	}, address)
+	return filepath.Join(t.dir, "resume-"+name)
+}
+
+// Handshake negotiates JSON-lines framing and resume tokens, presenting the
+// saved token (if any) to restore the previous session
+func Handshake(w io.Writer, clientName, token string) error {
+	lines := fmt.Sprintf("HELLO %s/%d\nCAP REQ :%s %s\nCAP END\n", clientName, protocol.ProtocolVersion, protocol.CapJSON, protocol.CapResume)
+
+	// RESUME goes last: once it succeeds the connection is authenticated and
+	// further negotiation lines would be treated as chat
+	if token != "" {
+		lines += "RESUME " + token + "\n"
+	}
+	_, err := fmt.Fprint(w, lines)
+	return err
+}
+
+// HandleTokenLine updates the store from TOKEN and RESUME FAIL lines and
+// reports whether the line was one of them
+func (t *TokenStore) HandleTokenLine(address, line string) bool {
+	switch {
+	case strings.HasPrefix(line, "TOKEN "):
+		t.Save(address, strings.TrimSpace(strings.TrimPrefix(line, "TOKEN ")))
+		return true
+	case strings.HasPrefix(line, "RESUME "):
+		t.Clear(address)
+		return true
+	}
+	return false
+}
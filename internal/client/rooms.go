@@ -0,0 +1,49 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+)
+
+// roomNotices start the server notices that change the client's current
+// room; their Room field names the new current room
+var roomNotices = []string{"You joined", "You left", "You stopped talking", "Now talking in"}
+
+// CurrentRoom reports the room a frame made current, if it is one of the
+// server's join, leave or switch notices
+func CurrentRoom(msg *protocol.Message) (string, bool) {
+	if msg.Type != protocol.MessageTypeSystem || msg.Room == "" || msg.Replay {
+		return "", false
+	}
+	for _, prefix := range roomNotices {
+		if strings.HasPrefix(msg.Content, prefix) {
+			return msg.Room, true
+		}
+	}
+	return "", false
+}
+
+// RoomTopic reports the topic of a room announced by a frame: the topic
+// shown on joining it, or a member changing or clearing it
+func RoomTopic(msg *protocol.Message) (room, topic string, ok bool) {
+	if msg.Type != protocol.MessageTypeSystem || msg.Room == "" || msg.Replay {
+		return "", "", false
+	}
+	if topic, found := strings.CutPrefix(msg.Content, "Topic for "+msg.Room+": "); found {
+		return msg.Room, topic, true
+	}
+
+	// Usernames have no spaces, so the change notices start with one word
+	user, rest, _ := strings.Cut(msg.Content, " ")
+	if user == "" {
+		return "", "", false
+	}
+	if topic, found := strings.CutPrefix(rest, "changed the topic to: "); found {
+		return msg.Room, topic, true
+	}
+	if rest == "cleared the topic" {
+		return msg.Room, "", true
+	}
+	return "", "", false
+}
@@ -0,0 +1,207 @@
+package message
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+	"github.com/mullayam/go-tcp-chat/internal/room"
+	"github.com/mullayam/go-tcp-chat/internal/session"
+)
+
+// handleAccess shows or changes who may join the current room:
+// /access [invite on|off | key <key>|off | allow <user|email|@domain,...>|off | hidden on|off]
+func (h *Handler) handleAccess(sess *session.Session, parts []string) error {
+	usage := "Usage: /access [invite on|off | key <key>|off | allow <user|email|@domain,...>|off | hidden on|off]"
+
+	target, exists := h.roomMgr.GetRoom(sess.GetCurrentRoom())
+	if !exists {
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in any room."))
+	}
+	if target.Type == room.TypeGroup {
+		return sess.SendMessage(protocol.NewErrorMessage("Group conversations are limited to their participants; use /gdm add <user>."))
+	}
+
+	if len(parts) < 2 {
+		return sess.SendMessage(protocol.NewCommandMessage(accessDetails(target)))
+	}
+	if len(parts) < 3 {
+		return sess.SendMessage(protocol.NewErrorMessage(usage))
+	}
+
+	if !isOwner(sess, target) {
+		return sess.SendMessage(protocol.NewErrorMessage("Only the room's owner can change its access settings."))
+	}
+
+	setting, value := strings.ToLower(parts[1]), strings.Join(parts[2:], " ")
+	off := strings.EqualFold(value, "off")
+	var err error
+	var done string
+	switch setting {
+	case "invite":
+		on, ok := parseSwitch(value)
+		if !ok {
+			return sess.SendMessage(protocol.NewErrorMessage(usage))
+		}
+		err = h.roomMgr.SetInviteOnly(target, on)
+		done = fmt.Sprintf("%s is now open to everyone allowed in.", target.Name)
+		if on {
+			done = fmt.Sprintf("%s is now invite-only; use /invite <user> to let people in.", target.Name)
+		}
+	case "hidden":
+		on, ok := parseSwitch(value)
+		if !ok {
+			return sess.SendMessage(protocol.NewErrorMessage(usage))
+		}
+		err = h.roomMgr.SetHidden(target, on)
+		done = fmt.Sprintf("%s is listed in /rooms again.", target.Name)
+		if on {
+			done = fmt.Sprintf("%s is now hidden from /rooms for users who aren't in it.", target.Name)
+		}
+	case "key":
+		if off {
+			err = h.roomMgr.SetKey(target, "")
+			done = fmt.Sprintf("%s no longer needs a key.", target.Name)
+		} else {
+			if len(parts) > 3 {
+				return sess.SendMessage(protocol.NewErrorMessage("Room keys can't contain spaces."))
+			}
+			err = h.roomMgr.SetKey(target, value)
+			done = fmt.Sprintf("%s now needs a key: /join %s key=<key>.", target.Name, target.Name)
+		}
+	case "allow":
+		if off {
+			err = h.roomMgr.SetAllowList(target, nil)
+			done = fmt.Sprintf("%s no longer has an allow-list.", target.Name)
+		} else {
+			entries := strings.FieldsFunc(value, func(r rune) bool {
+				return r == ',' || r == ' '
+			})
+			err = h.roomMgr.SetAllowList(target, entries)
+			done = fmt.Sprintf("%s is now limited to: %s.", target.Name, strings.Join(entries, ", "))
+		}
+	default:
+		return sess.SendMessage(protocol.NewErrorMessage(usage))
+	}
+
+	if err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	return sess.SendMessage(protocol.NewSystemMessage(done))
+}
+
+// parseSwitch parses "on" or "off"
+func parseSwitch(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "on":
+		return true, true
+	case "off":
+		return false, true
+	}
+	return false, false
+}
+
+// accessDetails describes a room's access settings for /access
+func accessDetails(target *room.Room) string {
+	access := target.GetAccess()
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+
+	msg := fmt.Sprintf("Access to %s:\n", target.Name)
+	msg += fmt.Sprintf("  Invite-only: %s\n", yesNo(access.InviteOnly))
+	msg += fmt.Sprintf("  Key:         %s\n", yesNo(access.Keyed))
+	if len(access.AllowList) > 0 {
+		msg += fmt.Sprintf("  Allow-list:  %s\n", strings.Join(access.AllowList, ", "))
+	} else {
+		msg += "  Allow-list:  (everyone)\n"
+	}
+	msg += fmt.Sprintf("  Hidden:      %s\n", yesNo(access.Hidden))
+	if len(access.Invited) > 0 {
+		msg += fmt.Sprintf("  Invited:     %s\n", strings.Join(access.Invited, ", "))
+	}
+	return msg
+}
+
+// accessFlags lists a room's access restrictions for /rooms, e.g.
+// ", invite-only, key"
+func accessFlags(access room.Access) string {
+	flags := ""
+	if access.InviteOnly {
+		flags += ", invite-only"
+	}
+	if access.Keyed {
+		flags += ", key"
+	}
+	if len(access.AllowList) > 0 {
+		flags += ", allow-list"
+	}
+	if access.Hidden {
+		flags += ", hidden"
+	}
+	return flags
+}
+
+// handleInvite lets a registered user join a room regardless of its access
+// settings: /invite <user> [room]. Guests may not invite anyone, and only
+// moderators may invite to invite-only rooms.
+func (h *Handler) handleInvite(sess *session.Session, parts []string) error {
+	target, err := h.invitationRoom(sess, parts)
+	if err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot invite: %v.", err)))
+	}
+	if target.GetAccess().InviteOnly && !isModerator(sess, target) {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Only the room's moderators can invite people to %s.", target.Name)))
+	}
+
+	acct, registered := h.accounts.GetByUsername(parts[1])
+	if !registered {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("No registered user named '%s'.", parts[1])))
+	}
+	if err := h.roomMgr.Invite(target, acct.Username); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+
+	if invitee, online := h.sessionMgr.GetSessionByUsername(acct.Username); online {
+		invitee.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("%s invited you to %s. Type /join %s to join.",
+			sess.GetUsername(), target.Name, target.Name)))
+	}
+	return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Invited %s to %s.", acct.Username, target.Name)))
+}
+
+// handleUninvite withdraws an invitation: /uninvite <user> [room]
+func (h *Handler) handleUninvite(sess *session.Session, parts []string) error {
+	target, err := h.invitationRoom(sess, parts)
+	if err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot withdraw the invitation: %v.", err)))
+	}
+
+	found, err := h.roomMgr.Uninvite(target, parts[1])
+	if err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	if !found {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("%s is not invited to %s.", parts[1], target.Name)))
+	}
+	return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Withdrew the invitation of %s to %s.", parts[1], target.Name)))
+}
+
+// invitationRoom returns the room an /invite or /uninvite is about: the one
+// named after the user, or the current room. The user must be in it.
+func (h *Handler) invitationRoom(sess *session.Session, parts []string) (*room.Room, error) {
+	roomName := sess.GetCurrentRoom()
+	if len(parts) > 2 {
+		roomName = roomArgument(parts[2])
+	}
+	target, exists := h.roomMgr.GetRoom(roomName)
+	if !exists || !sess.InRoom(roomName) {
+		return nil, fmt.Errorf("you are not in %s", roomName)
+	}
+	if target.Type == room.TypeGroup {
+		return nil, fmt.Errorf("group conversations are limited to their participants; use /gdm add <user>")
+	}
+	return target, nil
+}
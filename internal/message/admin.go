@@ -0,0 +1,267 @@
+package message
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+	"github.com/mullayam/go-tcp-chat/internal/session"
+	"github.com/mullayam/go-tcp-chat/internal/storage"
+)
+
+// adminHelp lists the operator commands
+const adminHelp = `
+Operator Commands:
+  /admin sessions    - List every connection with its IP and state
+  /admin kill <user|ip> [reason] - Disconnect a session
+  /admin ban <user|email|ip> [duration] [reason] - Ban from the server and disconnect
+  /admin unban <user|email|ip> - Lift a server ban
+  /admin bans        - List the server bans
+  /admin broadcast <text> - Send a notice to everyone online
+  /admin destroy <room> - Move everyone out of a room and delete it with its history
+  /admin stats       - Show server statistics
+`
+
+// isOperator reports whether a user may run /admin commands
+func (h *Handler) isOperator(sess *session.Session) bool {
+	return sess.GetEmail() != "" && slices.Contains(h.operators, strings.ToLower(sess.GetEmail()))
+}
+
+// handleAdmin runs an operator command: /admin <command> [args]
+func (h *Handler) handleAdmin(sess *session.Session, parts []string) error {
+	if len(parts) < 2 {
+		return sess.SendMessage(protocol.NewCommandMessage(adminHelp))
+	}
+
+	args := parts[2:]
+	command := strings.ToLower(parts[1])
+	if h.bans == nil && (command == "ban" || command == "unban" || command == "bans") {
+		return sess.SendMessage(protocol.NewErrorMessage("Server bans are not enabled."))
+	}
+	switch command {
+	case "sessions":
+		return h.adminSessions(sess)
+	case "kill":
+		return h.adminKill(sess, args)
+	case "ban":
+		return h.adminBan(sess, args)
+	case "unban":
+		return h.adminUnban(sess, args)
+	case "bans":
+		return h.adminBans(sess)
+	case "broadcast":
+		return h.adminBroadcast(sess, args)
+	case "destroy":
+		return h.adminDestroy(sess, args)
+	case "stats":
+		return h.adminStats(sess)
+	default:
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Unknown admin command: %s. Type /admin for the list.", parts[1])))
+	}
+}
+
+// adminSessions lists every connection, authenticated or not
+func (h *Handler) adminSessions(sess *session.Session) error {
+	sessions := h.sessionMgr.GetAllSessions()
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].IP < sessions[j].IP })
+
+	msg := fmt.Sprintf("Sessions (%d):\n", len(sessions))
+	for _, s := range sessions {
+		line := fmt.Sprintf("  - %s %s", s.IP, s.GetState())
+		if username := s.GetUsername(); username != "" {
+			line += fmt.Sprintf(" %s <%s>", username, s.GetEmail())
+		}
+		if rooms := s.GetRooms(); len(rooms) > 0 {
+			line += fmt.Sprintf(" in %s (current %s)", strings.Join(rooms, ", "), s.GetCurrentRoom())
+		}
+		if partner := s.GetPrivateChat(); partner != "" {
+			line += fmt.Sprintf(" talking to %s", partner)
+		}
+		msg += line + "\n"
+	}
+	return sess.SendMessage(protocol.NewCommandMessage(msg))
+}
+
+// adminKill disconnects the session of a user or IP address:
+// /admin kill <user|ip> [reason]
+func (h *Handler) adminKill(sess *session.Session, args []string) error {
+	if len(args) < 1 {
+		return sess.SendMessage(protocol.NewErrorMessage("Usage: /admin kill <user|ip> [reason]"))
+	}
+
+	target, online := h.sessionMgr.GetSessionByUsername(args[0])
+	if !online {
+		target, online = h.sessionMgr.GetSessionByIP(args[0])
+	}
+	if !online {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("No session for '%s'.", args[0])))
+	}
+	if target == sess {
+		return sess.SendMessage(protocol.NewErrorMessage("You can't disconnect yourself; use /quit."))
+	}
+
+	reason := strings.Join(args[1:], " ")
+	log.Printf("Operator %s disconnected %s (%s)%s", sess.GetUsername(), target.GetUsername(), target.IP, withReason(reason))
+	disconnect(target, fmt.Sprintf("You were disconnected by an operator%s", withReason(reason)))
+	return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Disconnected %s.", args[0])))
+}
+
+// adminBan bans a user, email or IP address from the server and disconnects
+// the sessions it matches: /admin ban <user|email|ip> [duration] [reason]
+func (h *Handler) adminBan(sess *session.Session, args []string) error {
+	if len(args) < 1 {
+		return sess.SendMessage(protocol.NewErrorMessage("Usage: /admin ban <user|email|ip> [duration] [reason]"))
+	}
+
+	ban := &storage.Ban{Target: args[0], By: sess.GetUsername(), At: time.Now()}
+	switch {
+	case strings.Contains(ban.Target, "@"):
+		ban.Target = strings.ToLower(ban.Target)
+	case net.ParseIP(ban.Target) == nil:
+		acct, registered := h.accounts.GetByUsername(ban.Target)
+		if !registered {
+			return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("No registered user named '%s'.", ban.Target)))
+		}
+		ban.Target = acct.Username
+	}
+	if ban.Matches(sess.GetUsername(), sess.GetEmail(), sess.IP) {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot ban %s: the ban would match you.", ban.Target)))
+	}
+
+	args = args[1:]
+	if len(args) > 0 {
+		if duration, err := storage.ParseAge(args[0]); err == nil && duration > 0 {
+			ban.Until = ban.At.Add(duration)
+			args = args[1:]
+		}
+	}
+	ban.Reason = strings.Join(args, " ")
+
+	if err := h.bans.Add(ban); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	log.Printf("Operator %s banned %s from the server%s%s", sess.GetUsername(), ban.Target, untilText(ban.Until), withReason(ban.Reason))
+
+	disconnected := 0
+	for _, s := range h.sessionMgr.GetAllSessions() {
+		if ban.Matches(s.GetUsername(), s.GetEmail(), s.IP) {
+			disconnect(s, fmt.Sprintf("You were banned from this server%s%s", untilText(ban.Until), withReason(ban.Reason)))
+			disconnected++
+		}
+	}
+	return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Banned %s from the server%s; %d sessions disconnected.",
+		ban.Target, untilText(ban.Until), disconnected)))
+}
+
+// adminUnban lifts a server ban: /admin unban <user|email|ip>
+func (h *Handler) adminUnban(sess *session.Session, args []string) error {
+	if len(args) < 1 {
+		return sess.SendMessage(protocol.NewErrorMessage("Usage: /admin unban <user|email|ip>"))
+	}
+
+	found, err := h.bans.Remove(args[0])
+	if err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	if !found {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("%s is not banned from the server.", args[0])))
+	}
+	log.Printf("Operator %s lifted the server ban on %s", sess.GetUsername(), args[0])
+	return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Lifted the server ban on %s.", args[0])))
+}
+
+// adminBans lists the server bans
+func (h *Handler) adminBans(sess *session.Session) error {
+	bans := h.bans.List()
+	if len(bans) == 0 {
+		return sess.SendMessage(protocol.NewCommandMessage("Nobody is banned from the server."))
+	}
+
+	msg := fmt.Sprintf("Server bans (%d):\n", len(bans))
+	for _, ban := range bans {
+		msg += fmt.Sprintf("  - %s by %s on %s%s%s\n", ban.Target, ban.By,
+			ban.At.Local().Format("2006-01-02 15:04"), untilText(ban.Until), withReason(ban.Reason))
+	}
+	return sess.SendMessage(protocol.NewCommandMessage(msg))
+}
+
+// adminBroadcast sends a notice to every signed-in user, once each whatever
+// rooms they are in: /admin broadcast <text>
+func (h *Handler) adminBroadcast(sess *session.Session, args []string) error {
+	if len(args) < 1 {
+		return sess.SendMessage(protocol.NewErrorMessage("Usage: /admin broadcast <text>"))
+	}
+
+	text := strings.Join(args, " ")
+	sessions := h.sessionMgr.GetAuthenticatedSessions()
+	for _, s := range sessions {
+		s.SendMessage(protocol.NewSystemMessage("Server notice: " + text))
+	}
+	log.Printf("Operator %s broadcast: %s", sess.GetUsername(), text)
+	return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Notice sent to %d users.", len(sessions))))
+}
+
+// adminDestroy moves everyone out of a room and deletes it with its history:
+// /admin destroy <room>
+func (h *Handler) adminDestroy(sess *session.Session, args []string) error {
+	if len(args) < 1 {
+		return sess.SendMessage(protocol.NewErrorMessage("Usage: /admin destroy <room>"))
+	}
+
+	roomName := roomArgument(args[0])
+	target, exists := h.roomMgr.GetRoom(roomName)
+	if !exists {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Room '%s' does not exist.", roomName)))
+	}
+	if roomName == protocol.DefaultRoom {
+		return sess.SendMessage(protocol.NewErrorMessage("The default room can't be destroyed."))
+	}
+
+	members := target.GetMembers()
+	for _, member := range members {
+		h.removeFromRoom(member, target, sess.GetUsername(), "",
+			fmt.Sprintf("You were removed from %s: an operator closed the room", roomName))
+	}
+	// Leaving may already have deleted an empty private room
+	if _, exists := h.roomMgr.GetRoom(roomName); exists {
+		if err := h.roomMgr.DestroyRoom(roomName); err != nil {
+			return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+		}
+	}
+	log.Printf("Operator %s destroyed %s", sess.GetUsername(), roomName)
+	return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Destroyed %s; %d members moved out.", roomName, len(members))))
+}
+
+// adminStats shows server statistics
+func (h *Handler) adminStats(sess *session.Session) error {
+	rooms, groups := h.roomMgr.Count()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	msg := "Server statistics:\n"
+	msg += fmt.Sprintf("  Uptime:       %s\n", time.Since(h.started).Round(time.Second))
+	msg += fmt.Sprintf("  Connections:  %d (%d signed in)\n", h.sessionMgr.Count(), len(h.sessionMgr.GetAuthenticatedSessions()))
+	msg += fmt.Sprintf("  Rooms:        %d (+%d group conversations)\n", rooms, groups)
+	msg += fmt.Sprintf("  Accounts:     %d\n", h.accounts.Count())
+	if h.bans != nil {
+		msg += fmt.Sprintf("  Server bans:  %d\n", len(h.bans.List()))
+	}
+	msg += fmt.Sprintf("  Goroutines:   %d\n", runtime.NumGoroutine())
+	msg += fmt.Sprintf("  Memory:       %.1f MiB\n", float64(mem.Alloc)/(1<<20))
+	return sess.SendMessage(protocol.NewCommandMessage(msg))
+}
+
+// disconnect tells a user why and closes their connection; the server
+// cleans up their session when its read fails
+func disconnect(sess *session.Session, notice string) {
+	sess.SendMessage(protocol.NewSystemMessage(notice))
+	if err := sess.Close(); err != nil {
+		log.Printf("Failed to disconnect %s: %v", sess.IP, err)
+	}
+}
@@ -0,0 +1,98 @@
+package message
+
+import (
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+	"github.com/mullayam/go-tcp-chat/internal/session"
+)
+
+// builtinCommands returns the commands every handler starts with, in the
+// order /help lists them
+func builtinCommands() []Command {
+	return []Command{
+		{Name: "help", Usage: "[command]", Description: "Show the available commands, or how to use one",
+			Args: Args(0, 1), Run: (*Handler).handleHelp},
+		{Name: "users", Description: "List all online users",
+			Run: withoutArgs((*Handler).handleUsers)},
+		{Name: "rooms", Description: "List all available rooms",
+			Run: withoutArgs((*Handler).handleRooms)},
+		{Name: "join", Aliases: []string{"j"}, Usage: "<room> [key=<key>] [n]", Description: "Join or create a room and talk there, replaying n messages",
+			Args: Args(1, 3), Run: (*Handler).handleJoin},
+		{Name: "switch", Usage: "<room>", Description: "Talk in another room you have joined",
+			Args: Args(1, 1), Run: (*Handler).handleSwitch},
+		{Name: "leave", Aliases: []string{"part"}, Usage: "[room]", Description: "Leave a room (the current one by default)",
+			Args: Args(0, 1), Run: (*Handler).handleLeave},
+		{Name: "msg", Aliases: []string{"w"}, Usage: "<user> <msg>", Description: "Send a private message to a user (queued if offline)",
+			Args: Args(2, -1), Run: (*Handler).handlePrivateMessage},
+		{Name: "gdm", Usage: "[user,user,...|add <user>]", Description: "List or start group conversations, or add a user to the current one",
+			Run: (*Handler).handleGroup},
+		{Name: "query", Usage: "[user] [n]", Description: "Talk only to a user until /query, replaying n messages",
+			Args: Args(0, 2), Run: (*Handler).handleQuery},
+		{Name: "inbox", Description: "Show your messages still waiting for offline users",
+			Run: withoutArgs((*Handler).handleInbox)},
+		{Name: "access", Usage: "[setting value]", Description: "Show or set who may join the room (invite, key, allow, hidden)",
+			Run: (*Handler).handleAccess},
+		{Name: "invite", Usage: "<user> [room]", Description: "Let a user into the room", Role: RoleMember,
+			Args: RoomArgs(1, 2, 1), Run: (*Handler).handleInvite},
+		{Name: "uninvite", Usage: "<user> [room]", Description: "Withdraw an invitation", Role: RoleModerator,
+			Args: RoomArgs(1, 2, 1), Run: (*Handler).handleUninvite},
+		{Name: "members", Aliases: []string{"names"}, Usage: "[room]", Description: "List the members of a room and their roles",
+			Args: Args(0, 1), Run: (*Handler).handleMembers},
+		{Name: "op", Usage: "<user> [room]", Description: "Make a user a moderator", Role: RoleOwner,
+			Args: RoomArgs(1, 2, 1), Run: (*Handler).handleOp},
+		{Name: "deop", Usage: "<user> [room]", Description: "Make a moderator a regular member", Role: RoleOwner,
+			Args: RoomArgs(1, 2, 1), Run: (*Handler).handleDeop},
+		{Name: "role", Usage: "<user> [moderator|member|guest] [room]", Description: "Show or change a user's role",
+			Args: Args(1, 3), Run: (*Handler).handleRole},
+		{Name: "transfer", Usage: "<user> [room]", Description: "Hand the room over to another user", Role: RoleOwner,
+			Args: RoomArgs(1, 2, 1), Run: (*Handler).handleTransfer},
+		{Name: "kick", Usage: "<user> [reason]", Description: "Remove a user from the room", Role: RoleModerator,
+			Args: Args(1, -1), Run: (*Handler).handleKick},
+		{Name: "ban", Usage: "[<user|email|ip> [duration] [reason]]", Description: "List bans or ban from the room", Role: RoleModerator,
+			Run: (*Handler).handleBan},
+		{Name: "unban", Usage: "<user|email|ip>", Description: "Lift a ban", Role: RoleModerator,
+			Args: Args(1, 1), Run: (*Handler).handleUnban},
+		{Name: "mute", Usage: "<user> [duration]", Description: "Stop a user from talking in the room", Role: RoleModerator,
+			Args: Args(1, 2), Run: (*Handler).handleMute},
+		{Name: "unmute", Usage: "<user>", Description: "Let a muted user talk again", Role: RoleModerator,
+			Args: Args(1, 1), Run: (*Handler).handleUnmute},
+		{Name: "topic", Usage: "[text|-]", Description: "Show the room's topic and details, or set the topic",
+			Run: (*Handler).handleTopic},
+		{Name: "describe", Usage: "[text|-]", Description: "Show or set the room's description",
+			Run: (*Handler).handleDescribe},
+		{Name: "tags", Usage: "[tag,...|-]", Description: "Show or set the room's tags",
+			Run: (*Handler).handleTags},
+		{Name: "history", Usage: "[n] [before <id|time>]", Description: "Page back through the room's history",
+			Run: (*Handler).handleHistory},
+		{Name: "retention", Usage: "[policy]", Description: "Show or set the room's history retention",
+			Run: (*Handler).handleRetention},
+		{Name: "replay", Usage: "[policy]", Description: "Show or set the history replayed on join",
+			Run: (*Handler).handleReplay},
+		{Name: "search", Usage: "<words> [in #room|&group|@user] [from <user>] [since <when>]", Description: "Search messages",
+			Run: (*Handler).handleSearch},
+		{Name: "whois", Usage: "<user>", Description: "Show a user's profile",
+			Args: Args(1, 1), Run: (*Handler).handleWhois},
+		{Name: "profile", Usage: "[name|bio] [text]", Description: "Show or edit your profile",
+			Run: (*Handler).handleProfile},
+		{Name: "format", Usage: "<text|json>", Description: "Switch between text and JSON-lines output",
+			Run: withoutArgs(formatUnavailable)},
+		{Name: "admin", Usage: "[command]", Description: "Show or run the server administration commands", Role: RoleOperator,
+			Run: (*Handler).handleAdmin},
+		{Name: "quit", Aliases: []string{"exit"}, Description: "Disconnect from the server",
+			Run: withoutArgs((*Handler).handleQuit)},
+		{Name: "logout", Description: "Disconnect and forget saved sessions on all devices",
+			Run: withoutArgs((*Handler).handleLogout)},
+	}
+}
+
+// withoutArgs adapts a command that takes no arguments
+func withoutArgs(run func(h *Handler, sess *session.Session) error) RunFunc {
+	return func(h *Handler, sess *session.Session, _ []string) error {
+		return run(h, sess)
+	}
+}
+
+// formatUnavailable answers /format on connections whose wire format is
+// fixed; the TCP server switches formats before commands reach the handler
+func formatUnavailable(_ *Handler, sess *session.Session) error {
+	return sess.SendMessage(protocol.NewErrorMessage("This connection can't switch formats."))
+}
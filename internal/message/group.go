@@ -0,0 +1,96 @@
+package message
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+	"github.com/mullayam/go-tcp-chat/internal/room"
+	"github.com/mullayam/go-tcp-chat/internal/session"
+)
+
+// handleGroup lists, starts or extends group conversations:
+// /gdm, /gdm <user,user,...>, /gdm add <user>
+func (h *Handler) handleGroup(sess *session.Session, parts []string) error {
+	if len(parts) < 2 {
+		return h.listGroups(sess)
+	}
+	if strings.ToLower(parts[1]) == "add" {
+		if len(parts) < 3 {
+			return sess.SendMessage(protocol.NewErrorMessage("Usage: /gdm add <user>"))
+		}
+		return h.addToGroup(sess, parts[2])
+	}
+
+	// Accept "alice,bob" as well as "alice, bob" or "alice bob"
+	names := strings.FieldsFunc(strings.Join(parts[1:], " "), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	usernames := make([]string, 0, len(names))
+	for _, name := range names {
+		acct, registered := h.accounts.GetByUsername(name)
+		if !registered {
+			return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("No registered user named '%s'.", name)))
+		}
+		usernames = append(usernames, acct.Username)
+	}
+
+	group, created, err := h.roomMgr.CreateGroup(sess.GetUsername(), usernames)
+	if err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+
+	if created {
+		participants := strings.Join(group.GetParticipants(), ", ")
+		for _, username := range group.GetParticipants() {
+			if target, online := h.sessionMgr.GetSessionByUsername(username); online && target != sess {
+				target.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("%s started a group conversation %s with %s. Type /join %s to open it.",
+					sess.GetUsername(), group.Name, participants, group.Name)))
+			}
+		}
+	}
+
+	return h.handleJoin(sess, []string{"/join", group.Name})
+}
+
+// listGroups lists the group conversations the user participates in
+func (h *Handler) listGroups(sess *session.Session) error {
+	groups := h.roomMgr.GetGroups(sess.GetUsername())
+	if len(groups) == 0 {
+		return sess.SendMessage(protocol.NewCommandMessage("You have no group conversations. Start one with /gdm <user,user,...>."))
+	}
+
+	msg := fmt.Sprintf("Group Conversations (%d):\n", len(groups))
+	for _, group := range groups {
+		participants := strings.Join(group.GetParticipants(), ", ")
+		if group.Name == sess.GetCurrentRoom() {
+			msg += fmt.Sprintf("  - %s: %s (current)\n", group.Name, participants)
+		} else {
+			msg += fmt.Sprintf("  - %s: %s\n", group.Name, participants)
+		}
+	}
+	return sess.SendMessage(protocol.NewCommandMessage(msg))
+}
+
+// addToGroup adds a registered user to the current group conversation
+func (h *Handler) addToGroup(sess *session.Session, name string) error {
+	group, exists := h.roomMgr.GetRoom(sess.GetCurrentRoom())
+	if !exists || group.Type != room.TypeGroup {
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in a group conversation."))
+	}
+
+	acct, registered := h.accounts.GetByUsername(name)
+	if !registered {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("No registered user named '%s'.", name)))
+	}
+	if err := h.roomMgr.AddParticipant(group, acct.Username); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+
+	group.BroadcastToAll(protocol.NewSystemMessage(fmt.Sprintf("%s added %s to the conversation", sess.GetUsername(), acct.Username)))
+	if target, online := h.sessionMgr.GetSessionByUsername(acct.Username); online {
+		target.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("%s added you to the group conversation %s with %s. Type /join %s to open it.",
+			sess.GetUsername(), group.Name, strings.Join(group.GetParticipants(), ", "), group.Name)))
+	}
+	return nil
+}
@@ -1,26 +1,77 @@
 package message
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/mullayam/go-tcp-chat/internal/account"
+	"github.com/mullayam/go-tcp-chat/internal/admin"
 	"github.com/mullayam/go-tcp-chat/internal/protocol"
 	"github.com/mullayam/go-tcp-chat/internal/room"
 	"github.com/mullayam/go-tcp-chat/internal/session"
+	"github.com/mullayam/go-tcp-chat/internal/storage"
 )
 
 // Handler handles command processing
 type Handler struct {
 	sessionMgr *session.Manager
 	roomMgr    *room.Manager
+	accounts   *account.Store
+	messages   *storage.IndexedStore
+	inboxLimit int            // messages queued per offline user; 0 disables queueing
+	bans       *admin.BanList // nil disables server bans
+	operators  []string       // lowercase emails of the users allowed to run /admin
+	started    time.Time
+	commands   *Registry
+
+	// logout revokes the user's saved sessions on /logout (optional)
+	logout func(*session.Session) error
+}
+
+// HandlerOptions holds the optional settings of a Handler; the zero value
+// disables each of them
+type HandlerOptions struct {
+	// InboxLimit caps the private messages queued per offline user
+	InboxLimit int
+	// Bans is the server ban list managed with /admin
+	Bans *admin.BanList
+	// Operators are the lowercase emails of the users allowed to run /admin
+	Operators []string
 }
 
 // NewHandler creates a new command handler
-func NewHandler(sessionMgr *session.Manager, roomMgr *room.Manager) *Handler {
-	return &Handler{
+func NewHandler(sessionMgr *session.Manager, roomMgr *room.Manager, accounts *account.Store, messages *storage.IndexedStore, opts HandlerOptions) *Handler {
+	h := &Handler{
 		sessionMgr: sessionMgr,
 		roomMgr:    roomMgr,
+		accounts:   accounts,
+		messages:   messages,
+		inboxLimit: opts.InboxLimit,
+		bans:       opts.Bans,
+		operators:  opts.Operators,
+		started:    time.Now(),
+		commands:   NewRegistry(),
 	}
+	for _, cmd := range builtinCommands() {
+		h.commands.add(&cmd)
+	}
+	return h
+}
+
+// SetLogoutHandler sets the function /logout uses to revoke the user's saved
+// sessions
+func (h *Handler) SetLogoutHandler(fn func(*session.Session) error) {
+	h.logout = fn
+}
+
+// Commands returns the handler's command registry, to which embedding code
+// may add its own commands
+func (h *Handler) Commands() *Registry {
+	return h.commands
 }
 
 // HandleCommand processes a command from a user
@@ -30,52 +81,116 @@ func (h *Handler) HandleCommand(sess *session.Session, command string) error {
 		return nil
 	}
 
-	cmd := strings.ToLower(parts[0])
-
-	switch cmd {
-	case "/help":
-		return h.handleHelp(sess)
-	case "/users":
-		return h.handleUsers(sess)
-	case "/rooms":
-		return h.handleRooms(sess)
-	case "/join":
-		return h.handleJoin(sess, parts)
-	case "/leave":
-		return h.handleLeave(sess)
-	case "/msg":
-		return h.handlePrivateMessage(sess, parts)
-	case "/quit":
-		return h.handleQuit(sess)
-	default:
-		return sess.Send(protocol.NewErrorMessage(fmt.Sprintf("Unknown command: %s. Type /help for available commands.", cmd)).Format())
+	cmd, exists := h.commands.Lookup(parts[0])
+	// Operator commands look unknown to everyone else
+	if !exists || (cmd.Role == RoleOperator && !h.isOperator(sess)) {
+		return unknownCommand(sess, strings.ToLower(parts[0]))
+	}
+
+	roomName := ""
+	if cmd.Args != nil {
+		var err error
+		if roomName, err = cmd.Args(parts[1:]); err != nil {
+			if errors.Is(err, ErrUsage) {
+				return sess.SendMessage(protocol.NewErrorMessage("Usage: " + cmd.Syntax()))
+			}
+			return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("%v. Usage: %s", err, cmd.Syntax())))
+		}
 	}
+	if err := h.checkRole(sess, cmd, roomName); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot use /%s: %v.", cmd.Name, err)))
+	}
+	return cmd.Run(h, sess, parts)
 }
 
-// handleHelp shows available commands
-func (h *Handler) handleHelp(sess *session.Session) error {
-	help := `
-Available Commands:
-  /help              - Show this help message
-  /users             - List all online users
-  /rooms             - List all available rooms
-  /join <room>       - Join or create a room
-  /leave             - Leave current room and return to #general
-  /msg <user> <msg>  - Send a private message to a user
-  /quit              - Disconnect from the server
+// checkRole makes sure a user holds the role a command requires in the room
+// it acts on, the current room unless roomName is given
+func (h *Handler) checkRole(sess *session.Session, cmd *Command, roomName string) error {
+	if cmd.Role == RoleAnyone || cmd.Role == RoleOperator {
+		return nil
+	}
+
+	if roomName == "" {
+		roomName = sess.GetCurrentRoom()
+	}
+	target, exists := h.roomMgr.GetRoom(roomName)
+	if !exists || !sess.InRoom(roomName) {
+		if roomName == "" {
+			return fmt.Errorf("you are not in any room")
+		}
+		return fmt.Errorf("you are not in %s", roomName)
+	}
+
+	role := target.RoleOf(sess.GetUsername())
+	switch cmd.Role {
+	case RoleMember:
+		if role < room.RoleMember {
+			return fmt.Errorf("guests can't use it in %s", target.Name)
+		}
+	case RoleModerator:
+		if role < room.RoleModerator {
+			return fmt.Errorf("it is reserved for the moderators of %s", target.Name)
+		}
+	case RoleOwner:
+		if role < room.RoleOwner {
+			return fmt.Errorf("it is reserved for the owner of %s", target.Name)
+		}
+	}
+	return nil
+}
+
+// unknownCommand tells the user a command doesn't exist
+func unknownCommand(sess *session.Session, cmd string) error {
+	return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Unknown command: %s. Type /help for available commands.", cmd)))
+}
 
+// chatHelp ends the /help listing
+const chatHelp = `
 Chat:
   - Type any message to chat in your current room
   - Messages are only visible to users in the same room
+  - Messages from your other rooms are labelled with the room name
 `
-	return sess.Send(protocol.NewCommandMessage(help).Format())
+
+// handleHelp lists the commands the user can run, or shows how to use one:
+// /help [command]
+func (h *Handler) handleHelp(sess *session.Session, parts []string) error {
+	operator := h.isOperator(sess)
+	if len(parts) > 1 {
+		cmd, exists := h.commands.Lookup(parts[1])
+		if !exists || (cmd.Role == RoleOperator && !operator) {
+			return unknownCommand(sess, "/"+commandName(parts[1]))
+		}
+
+		msg := fmt.Sprintf("%s\n  %s\n", cmd.Syntax(), cmd.summary())
+		if len(cmd.Aliases) > 0 {
+			msg += fmt.Sprintf("  Also: /%s\n", strings.Join(cmd.Aliases, ", /"))
+		}
+		return sess.SendMessage(protocol.NewCommandMessage(msg))
+	}
+
+	help := "\nAvailable Commands:\n"
+	operators := ""
+	for _, cmd := range h.commands.Commands() {
+		switch {
+		case cmd.Role != RoleOperator:
+			help += cmd.helpLine()
+		case operator:
+			operators += cmd.helpLine()
+		}
+	}
+	help += chatHelp
+	if operators != "" {
+		help += "\nOperators:\n" + operators
+	}
+	return sess.SendMessage(protocol.NewCommandMessage(help))
 }
 
 // handleUsers lists all online users
 func (h *Handler) handleUsers(sess *session.Session) error {
 	usernames := h.sessionMgr.GetOnlineUsernames()
 	if len(usernames) == 0 {
-		return sess.Send(protocol.NewCommandMessage("No users online.").Format())
+		return sess.SendMessage(protocol.NewCommandMessage("No users online."))
 	}
 
 	msg := fmt.Sprintf("Online Users (%d):\n", len(usernames))
@@ -86,63 +201,112 @@ func (h *Handler) handleUsers(sess *session.Session) error {
 			msg += fmt.Sprintf("  - %s\n", username)
 		}
 	}
-	return sess.Send(protocol.NewCommandMessage(msg).Format())
+	return sess.SendMessage(protocol.NewCommandMessage(msg))
 }
 
 // handleRooms lists all available rooms
 func (h *Handler) handleRooms(sess *session.Session) error {
-	roomNames := h.roomMgr.GetAllRoomNames()
-	if len(roomNames) == 0 {
-		return sess.Send(protocol.NewCommandMessage("No rooms available.").Format())
+	rooms := make([]*room.Room, 0)
+	for _, roomName := range h.roomMgr.GetAllRoomNames() {
+		if r, exists := h.roomMgr.GetRoom(roomName); exists && r.VisibleTo(sess.GetUsername()) {
+			rooms = append(rooms, r)
+		}
+	}
+	if len(rooms) == 0 {
+		return sess.SendMessage(protocol.NewCommandMessage("No rooms available."))
 	}
 
-	msg := fmt.Sprintf("Available Rooms (%d):\n", len(roomNames))
-	for _, roomName := range roomNames {
-		roomType, memberCount, _ := h.roomMgr.GetRoomInfo(roomName)
-		currentRoom := sess.GetCurrentRoom()
-		if roomName == currentRoom {
-			msg += fmt.Sprintf("  - %s [%s] (%d members) (current)\n", roomName, roomType, memberCount)
-		} else {
-			msg += fmt.Sprintf("  - %s [%s] (%d members)\n", roomName, roomType, memberCount)
+	msg := fmt.Sprintf("Available Rooms (%d):\n", len(rooms))
+	for _, r := range rooms {
+		roomType, memberCount, _ := h.roomMgr.GetRoomInfo(r.Name)
+		line := fmt.Sprintf("  - %s [%s%s] (%d members)", r.Name, roomType, accessFlags(r.GetAccess()), memberCount)
+		switch {
+		case r.Name == sess.GetCurrentRoom():
+			line += " (current)"
+		case sess.InRoom(r.Name):
+			line += " (joined)"
+		}
+		if topic := r.GetTopic(); topic.Text != "" {
+			line += " - " + topic.Text
 		}
+		if tags := r.GetTags(); len(tags) > 0 {
+			line += fmt.Sprintf(" [tags: %s]", strings.Join(tags, ", "))
+		}
+		msg += line + "\n"
+	}
+	return sess.SendMessage(protocol.NewCommandMessage(msg))
+}
+
+// roomArgument turns a room argument into a room name, adding the # that
+// users may leave out
+func roomArgument(name string) string {
+	if !strings.HasPrefix(name, "#") && !strings.HasPrefix(name, room.GroupPrefix) {
+		return "#" + name
 	}
-	return sess.Send(protocol.NewCommandMessage(msg).Format())
+	return name
 }
 
-// handleJoin joins or creates a room
+// joinKeyPrefix marks the room key among the arguments of /join, so keys
+// are never mistaken for a replay count
+const joinKeyPrefix = "key="
+
+// handleJoin joins or creates a room and makes it the current room,
+// staying in the rooms already joined: /join <room> [key=<key>] [n]
 func (h *Handler) handleJoin(sess *session.Session, parts []string) error {
-	if len(parts) < 2 {
-		return sess.Send(protocol.NewErrorMessage("Usage: /join <room>").Format())
+	usage := "Usage: /join <room> [key=<key>] [number of messages to replay]"
+	roomName := roomArgument(parts[1])
+
+	// Joining a room already joined just switches to it
+	if sess.InRoom(roomName) {
+		return h.switchRoom(sess, roomName)
 	}
 
-	roomName := parts[1]
-	if !strings.HasPrefix(roomName, "#") {
-		roomName = "#" + roomName
+	target, exists := h.roomMgr.GetRoom(roomName)
+	if !exists && strings.HasPrefix(roomName, room.GroupPrefix) {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Group conversation '%s' does not exist.", roomName)))
 	}
 
-	// Leave current room
-	currentRoom := sess.GetCurrentRoom()
-	if currentRoom != "" {
-		h.roomMgr.LeaveRoom(sess)
-		if room, exists := h.roomMgr.GetRoom(currentRoom); exists {
-			room.Broadcast(protocol.NewSystemMessage(fmt.Sprintf("%s left the room", sess.GetUsername())), "")
+	// The key is named; an explicit count overrides the room's replay policy
+	key := ""
+	var replay *storage.Replay
+	for _, arg := range parts[2:] {
+		if value, found := strings.CutPrefix(arg, joinKeyPrefix); found && key == "" {
+			key = value
+			continue
 		}
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 || replay != nil {
+			if exists && target.GetAccess().Keyed {
+				return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("%s. Give the room key as /join %s key=<key>.", usage, roomName)))
+			}
+			return sess.SendMessage(protocol.NewErrorMessage(usage))
+		}
+		replay = &storage.Replay{MaxMessages: n}
 	}
 
 	// Create room if it doesn't exist
-	room, err := h.roomMgr.CreateRoom(roomName)
+	room, err := h.roomMgr.CreateRoom(roomName, sess.GetUsername())
 	if err != nil {
-		return sess.Send(protocol.NewErrorMessage(err.Error()).Format())
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
 	}
 
-	// Join the room
-	err = h.roomMgr.JoinRoom(roomName, sess)
+	// Join the room; JoinRoom checks the bans and access settings
+	err = h.roomMgr.JoinRoom(roomName, sess, key, replay)
 	if err != nil {
-		return sess.Send(protocol.NewErrorMessage(err.Error()).Format())
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot join %s: %v.", roomName, err)))
 	}
 
+	// Joining a room ends any /query conversation
+	sess.SetPrivateChat("")
+
 	// Notify user
-	sess.Send(protocol.NewSystemMessage(fmt.Sprintf("You joined %s", roomName)).Format())
+	joined := protocol.NewSystemMessage(fmt.Sprintf("You joined %s", roomName))
+	joined.Room = roomName
+	sess.SendMessage(joined)
+	h.SendTopic(sess, room)
+	if participants := room.GetParticipants(); len(participants) > 0 {
+		sess.SendMessage(protocol.NewSystemMessage("Participants: " + strings.Join(participants, ", ")))
+	}
 
 	// Notify room members
 	room.Broadcast(protocol.NewSystemMessage(fmt.Sprintf("%s joined the room", sess.GetUsername())), sess.GetUsername())
@@ -150,32 +314,71 @@ func (h *Handler) handleJoin(sess *session.Session, parts []string) error {
 	return nil
 }
 
-// handleLeave leaves the current room
-func (h *Handler) handleLeave(sess *session.Session) error {
-	currentRoom := sess.GetCurrentRoom()
-	if currentRoom == protocol.DefaultRoom {
-		return sess.Send(protocol.NewErrorMessage("You are already in the default room.").Format())
+// handleSwitch makes one of the joined rooms the current room
+func (h *Handler) handleSwitch(sess *session.Session, parts []string) error {
+	roomName := roomArgument(parts[1])
+	if !sess.InRoom(roomName) {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("You are not in %s. Use /join %s to join it.", roomName, roomName)))
+	}
+	return h.switchRoom(sess, roomName)
+}
+
+// switchRoom makes a joined room the current room, ending any /query
+// conversation
+func (h *Handler) switchRoom(sess *session.Session, roomName string) error {
+	sess.SetPrivateChat("")
+	sess.SetCurrentRoom(roomName)
+
+	notice := protocol.NewSystemMessage(fmt.Sprintf("Now talking in %s", roomName))
+	notice.Room = roomName
+	return sess.SendMessage(notice)
+}
+
+// handleLeave leaves the given room, or the current one. Users always stay
+// in at least one room, so leaving the last returns them to #general.
+func (h *Handler) handleLeave(sess *session.Session, parts []string) error {
+	roomName := sess.GetCurrentRoom()
+	if len(parts) > 1 {
+		roomName = roomArgument(parts[1])
 	}
 
-	if currentRoom == "" {
-		return sess.Send(protocol.NewErrorMessage("You are not in any room.").Format())
+	if roomName == "" {
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in any room."))
+	}
+	if !sess.InRoom(roomName) {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("You are not in %s.", roomName)))
+	}
+	rooms := sess.GetRooms()
+	if roomName == protocol.DefaultRoom && len(rooms) == 1 {
+		return sess.SendMessage(protocol.NewErrorMessage("You are already in the default room."))
 	}
 
-	// Notify room before leaving
-	if room, exists := h.roomMgr.GetRoom(currentRoom); exists {
+	// Leave the room and notify the members who stay
+	wasCurrent := roomName == sess.GetCurrentRoom()
+	h.roomMgr.LeaveRoom(sess, roomName)
+	if room, exists := h.roomMgr.GetRoom(roomName); exists {
 		room.Broadcast(protocol.NewSystemMessage(fmt.Sprintf("%s left the room", sess.GetUsername())), "")
 	}
 
-	// Leave current room
-	h.roomMgr.LeaveRoom(sess)
+	if len(rooms) > 1 {
+		left := protocol.NewSystemMessage(fmt.Sprintf("You left %s", roomName))
+		if wasCurrent {
+			left.Content = fmt.Sprintf("You left %s; now talking in %s", roomName, sess.GetCurrentRoom())
+		}
+		left.Room = sess.GetCurrentRoom()
+		return sess.SendMessage(left)
+	}
 
 	// Join default room
 	defaultRoom := h.roomMgr.GetDefaultRoom()
-	defaultRoom.AddMember(sess)
-	sess.SetCurrentRoom(protocol.DefaultRoom)
+	if err := h.roomMgr.JoinRoom(protocol.DefaultRoom, sess, "", nil); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
 
 	// Notify user
-	sess.Send(protocol.NewSystemMessage(fmt.Sprintf("You left %s and returned to %s", currentRoom, protocol.DefaultRoom)).Format())
+	left := protocol.NewSystemMessage(fmt.Sprintf("You left %s and returned to %s", roomName, protocol.DefaultRoom))
+	left.Room = protocol.DefaultRoom
+	sess.SendMessage(left)
 
 	// Notify default room
 	defaultRoom.Broadcast(protocol.NewSystemMessage(fmt.Sprintf("%s joined the room", sess.GetUsername())), sess.GetUsername())
@@ -185,30 +388,129 @@ func (h *Handler) handleLeave(sess *session.Session) error {
 
 // handlePrivateMessage sends a private message
 func (h *Handler) handlePrivateMessage(sess *session.Session, parts []string) error {
-	if len(parts) < 3 {
-		return sess.Send(protocol.NewErrorMessage("Usage: /msg <username> <message>").Format())
-	}
-
 	targetUsername := parts[1]
 	message := strings.Join(parts[2:], " ")
 
-	// Check if target user exists
+	if err := h.SendPrivateMessage(sess, targetUsername, message); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+
+	// Confirm to sender
+	sess.SendMessage(protocol.NewCommandMessage(fmt.Sprintf("[PM to %s]: %s", targetUsername, message)))
+
+	return nil
+}
+
+// SendPrivateMessage delivers a private message to an online user, or
+// queues it for a registered user who is offline
+func (h *Handler) SendPrivateMessage(sess *session.Session, targetUsername, message string) error {
+	// Check if target user is online
 	targetSession, exists := h.sessionMgr.GetSessionByUsername(targetUsername)
 	if !exists {
-		return sess.Send(protocol.NewErrorMessage(fmt.Sprintf("User '%s' is not online.", targetUsername)).Format())
+		return h.queuePrivateMessage(sess, targetUsername, message)
 	}
 
 	// Send to target
-	targetSession.Send(protocol.NewPrivateMessage(sess.GetUsername(), targetUsername, fmt.Sprintf("[PM] %s", message)).Format())
-
-	// Confirm to sender
-	sess.Send(protocol.NewCommandMessage(fmt.Sprintf("[PM to %s]: %s", targetUsername, message)).Format())
+	msg := protocol.NewPrivateMessage(sess.GetUsername(), targetSession.GetUsername(), message)
+	if err := targetSession.SendMessage(msg); err != nil {
+		return err
+	}
 
+	h.storePrivateMessage(msg)
 	return nil
 }
 
+// storePrivateMessage adds a private message to its conversation's history
+func (h *Handler) storePrivateMessage(msg *protocol.Message) {
+	stored := *msg
+	stored.Room = storage.ConversationKey(msg.From, msg.To)
+	if err := h.messages.AppendMessage(&stored); err != nil {
+		log.Printf("Failed to store private message: %v", err)
+	}
+}
+
+// handleWhois shows a registered user's public profile
+func (h *Handler) handleWhois(sess *session.Session, parts []string) error {
+	acct, exists := h.accounts.GetByUsername(parts[1])
+	if !exists {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("No registered user named '%s'.", parts[1])))
+	}
+
+	msg := acct.Username
+	if acct.DisplayName != "" {
+		msg += fmt.Sprintf(" (%s)", acct.DisplayName)
+	}
+	msg += "\n"
+	if acct.Bio != "" {
+		msg += fmt.Sprintf("  Bio: %s\n", acct.Bio)
+	}
+	msg += fmt.Sprintf("  Registered: %s\n", acct.CreatedAt.Format("2006-01-02"))
+	if _, online := h.sessionMgr.GetSessionByUsername(acct.Username); online {
+		msg += "  Status: online\n"
+	} else {
+		msg += fmt.Sprintf("  Last seen: %s\n", acct.LastSeen.Format("2006-01-02 15:04 MST"))
+	}
+	return sess.SendMessage(protocol.NewCommandMessage(msg))
+}
+
+// handleProfile shows or edits the user's own profile
+func (h *Handler) handleProfile(sess *session.Session, parts []string) error {
+	if len(parts) < 2 {
+		acct, exists := h.accounts.GetByEmail(sess.GetEmail())
+		if !exists {
+			return sess.SendMessage(protocol.NewErrorMessage("You don't have a registered account."))
+		}
+		msg := fmt.Sprintf("Your profile:\n  Username: %s\n  Email: %s\n  Name: %s\n  Bio: %s\n  Registered: %s\n",
+			acct.Username, acct.Email, acct.DisplayName, acct.Bio, acct.CreatedAt.Format("2006-01-02"))
+		return sess.SendMessage(protocol.NewCommandMessage(msg))
+	}
+
+	field := strings.ToLower(parts[1])
+	value := strings.Join(parts[2:], " ")
+
+	var limit int
+	switch field {
+	case "name":
+		limit = account.MaxDisplayNameLength
+	case "bio":
+		limit = account.MaxBioLength
+	default:
+		return sess.SendMessage(protocol.NewErrorMessage("Usage: /profile [name|bio] [text]"))
+	}
+	if len(value) > limit {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Your %s can be at most %d characters.", field, limit)))
+	}
+
+	err := h.accounts.Update(sess.GetEmail(), func(acct *account.Account) {
+		if field == "name" {
+			acct.DisplayName = value
+		} else {
+			acct.Bio = value
+		}
+	})
+	if err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+
+	if value == "" {
+		return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Your %s has been cleared.", field)))
+	}
+	return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Your %s has been updated.", field)))
+}
+
 // handleQuit disconnects the user
 func (h *Handler) handleQuit(sess *session.Session) error {
-	sess.Send(protocol.NewSystemMessage("Goodbye!").Format())
+	sess.SendMessage(protocol.NewSystemMessage("Goodbye!"))
+	return fmt.Errorf("user quit")
+}
+
+// handleLogout revokes the user's saved sessions and disconnects
+func (h *Handler) handleLogout(sess *session.Session) error {
+	if h.logout != nil {
+		if err := h.logout(sess); err != nil {
+			return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+		}
+	}
+	sess.SendMessage(protocol.NewSystemMessage("Logged out. Saved sessions on all devices have been revoked."))
 	return fmt.Errorf("user quit")
 }
@@ -0,0 +1,183 @@
+package message
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+	"github.com/mullayam/go-tcp-chat/internal/session"
+	"github.com/mullayam/go-tcp-chat/internal/storage"
+)
+
+// History paging limits
+const (
+	defaultHistoryPageSize = 20
+	maxHistoryPageSize     = 200
+)
+
+// historyTimeLayouts are the accepted date formats for /history and /search
+var historyTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// handleHistory pages backwards through the history of the current room, or
+// of the /query conversation: /history [n] [before <id|time>]
+func (h *Handler) handleHistory(sess *session.Session, parts []string) error {
+	usage := "Usage: /history [n] [before <message id|time>]"
+
+	key, name := sess.GetCurrentRoom(), sess.GetCurrentRoom()
+	if partner := sess.GetPrivateChat(); partner != "" {
+		key, name = storage.ConversationKey(sess.GetUsername(), partner), partner
+	} else if _, exists := h.roomMgr.GetRoom(key); !exists {
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in any room."))
+	}
+
+	args := parts[1:]
+	limit := defaultHistoryPageSize
+	if len(args) > 0 && strings.ToLower(args[0]) != "before" {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return sess.SendMessage(protocol.NewErrorMessage(usage))
+		}
+		limit = min(n, maxHistoryPageSize)
+		args = args[1:]
+	}
+
+	before := ""
+	if len(args) > 0 {
+		if strings.ToLower(args[0]) != "before" || len(args) < 2 {
+			return sess.SendMessage(protocol.NewErrorMessage(usage))
+		}
+		var err error
+		if before, err = parseHistoryBound(strings.Join(args[1:], " ")); err != nil {
+			return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+		}
+	}
+
+	messages, err := h.messages.MessagesBefore(key, before, limit)
+	if err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage("Failed to load history."))
+	}
+	if len(messages) == 0 {
+		return sess.SendMessage(protocol.NewCommandMessage("No earlier messages."))
+	}
+
+	sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("--- History of %s (%d messages) ---", name, len(messages))))
+	for _, msg := range messages {
+		sess.SendMessage(historyMessage(msg))
+	}
+	if len(messages) == limit {
+		return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("--- More: /history %d before %s ---", limit, messages[0].ID)))
+	}
+	return sess.SendMessage(protocol.NewSystemMessage("--- Start of history ---"))
+}
+
+// parseHistoryBound converts a message ID or a time into the message ID
+// bound used for paging
+func parseHistoryBound(value string) (string, error) {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return value, nil
+	}
+
+	t, err := parseTime(value)
+	if err != nil {
+		return "", fmt.Errorf("Invalid bound '%s'. Use a message ID, a date (YYYY-MM-DD [HH:MM]) or a time (HH:MM).", value)
+	}
+	return strconv.FormatInt(t.UnixMicro(), 10), nil
+}
+
+// parseTime parses a date or time in local time; a bare clock time means
+// today
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range historyTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	t, err := time.ParseInLocation("15:04", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.Local), nil
+}
+
+// handleRetention shows or changes the current room's history retention:
+// /retention [forever|<count>|<age>|<count>,<age>|default]
+func (h *Handler) handleRetention(sess *session.Session, parts []string) error {
+	room, exists := h.roomMgr.GetRoom(sess.GetCurrentRoom())
+	if !exists {
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in any room."))
+	}
+
+	if len(parts) < 2 {
+		source := "room setting"
+		if room.GetRetention() == nil {
+			source = "server default"
+		}
+		return sess.SendMessage(protocol.NewCommandMessage(fmt.Sprintf("History retention for %s: %s (%s)",
+			room.Name, h.roomMgr.EffectiveRetention(room), source)))
+	}
+
+	if !isOwner(sess, room) {
+		return sess.SendMessage(protocol.NewErrorMessage("Only the room's owner can change its retention."))
+	}
+
+	var retention *storage.Retention
+	if spec := strings.Join(parts[1:], ""); strings.ToLower(spec) != "default" {
+		parsed, err := storage.ParseRetention(spec)
+		if err != nil {
+			return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+		}
+		retention = &parsed
+	}
+
+	if err := h.roomMgr.SetRetention(room, retention); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("History retention for %s set to %s.",
+		room.Name, h.roomMgr.EffectiveRetention(room))))
+}
+
+// handleReplay shows or changes the history replayed to members joining the
+// current room: /replay [none|<count>|<age>|<count>,<age>|default]
+func (h *Handler) handleReplay(sess *session.Session, parts []string) error {
+	room, exists := h.roomMgr.GetRoom(sess.GetCurrentRoom())
+	if !exists {
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in any room."))
+	}
+
+	if len(parts) < 2 {
+		source := "room setting"
+		if room.GetReplay() == nil {
+			source = "server default"
+		}
+		return sess.SendMessage(protocol.NewCommandMessage(fmt.Sprintf("History replayed on joining %s: %s (%s)",
+			room.Name, h.roomMgr.EffectiveReplay(room), source)))
+	}
+
+	if !isOwner(sess, room) {
+		return sess.SendMessage(protocol.NewErrorMessage("Only the room's owner can change its replay policy."))
+	}
+
+	var replay *storage.Replay
+	if spec := strings.Join(parts[1:], ""); strings.ToLower(spec) != "default" {
+		parsed, err := storage.ParseReplay(spec)
+		if err != nil {
+			return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+		}
+		replay = &parsed
+	}
+
+	if err := h.roomMgr.SetReplay(room, replay); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("History replayed on joining %s set to %s.",
+		room.Name, h.roomMgr.EffectiveReplay(room))))
+}
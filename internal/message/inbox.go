@@ -0,0 +1,81 @@
+package message
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+	"github.com/mullayam/go-tcp-chat/internal/session"
+)
+
+// queuePrivateMessage queues a private message for a registered user who is
+// offline, to be delivered at their next login
+func (h *Handler) queuePrivateMessage(sess *session.Session, targetUsername, message string) error {
+	acct, registered := h.accounts.GetByUsername(targetUsername)
+	if !registered || h.inboxLimit <= 0 {
+		return fmt.Errorf("User '%s' is not online.", targetUsername)
+	}
+
+	inbox, err := h.messages.Inbox(acct.Username)
+	if err != nil {
+		log.Printf("Failed to load inbox of %s: %v", acct.Username, err)
+		return fmt.Errorf("Failed to queue message for %s.", acct.Username)
+	}
+	if len(inbox) >= h.inboxLimit {
+		return fmt.Errorf("%s is offline and their inbox is full.", acct.Username)
+	}
+
+	msg := protocol.NewPrivateMessage(sess.GetUsername(), acct.Username, message)
+	if err := h.messages.QueueMessage(msg); err != nil {
+		log.Printf("Failed to queue message for %s: %v", acct.Username, err)
+		return fmt.Errorf("Failed to queue message for %s.", acct.Username)
+	}
+	h.storePrivateMessage(msg)
+
+	return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("%s is offline; your message will be delivered when they next log in.", acct.Username)))
+}
+
+// DeliverInbox sends a user the private messages queued while they were
+// offline, with their original timestamps
+func (h *Handler) DeliverInbox(sess *session.Session) error {
+	username := sess.GetUsername()
+	inbox, err := h.messages.Inbox(username)
+	if err != nil {
+		return fmt.Errorf("failed to load inbox: %w", err)
+	}
+	if len(inbox) == 0 {
+		return nil
+	}
+
+	sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("--- %d messages arrived while you were away ---", len(inbox))))
+	for _, msg := range inbox {
+		sess.SendMessage(msg.Replayed())
+	}
+	sess.SendMessage(protocol.NewSystemMessage("--- End of messages ---"))
+
+	return h.messages.ClearInbox(username, inbox[len(inbox)-1].ID)
+}
+
+// handleInbox delivers any messages still queued for the user and lists the
+// user's own messages waiting for offline recipients
+func (h *Handler) handleInbox(sess *session.Session) error {
+	if err := h.DeliverInbox(sess); err != nil {
+		log.Printf("Failed to deliver inbox of %s: %v", sess.GetUsername(), err)
+		return sess.SendMessage(protocol.NewErrorMessage("Failed to load your inbox."))
+	}
+
+	queued, err := h.messages.QueuedBy(sess.GetUsername())
+	if err != nil {
+		log.Printf("Failed to load messages queued by %s: %v", sess.GetUsername(), err)
+		return sess.SendMessage(protocol.NewErrorMessage("Failed to load your inbox."))
+	}
+	if len(queued) == 0 {
+		return sess.SendMessage(protocol.NewCommandMessage("No messages waiting for delivery."))
+	}
+
+	msg := fmt.Sprintf("Waiting for delivery (%d):\n", len(queued))
+	for _, pending := range queued {
+		msg += fmt.Sprintf("  [%s] to %s: %s\n", pending.ShortTime(), pending.To, pending.Content)
+	}
+	return sess.SendMessage(protocol.NewCommandMessage(msg))
+}
@@ -0,0 +1,267 @@
+package message
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+	"github.com/mullayam/go-tcp-chat/internal/room"
+	"github.com/mullayam/go-tcp-chat/internal/session"
+	"github.com/mullayam/go-tcp-chat/internal/storage"
+)
+
+// handleKick removes a user from the current room: /kick <user> [reason]
+func (h *Handler) handleKick(sess *session.Session, parts []string) error {
+	target, exists := h.roomMgr.GetRoom(sess.GetCurrentRoom())
+	if !exists {
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in any room."))
+	}
+	if err := h.Kick(sess, target, parts[1], strings.Join(parts[2:], " ")); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot kick %s: %v.", parts[1], err)))
+	}
+	return nil
+}
+
+// Kick removes a user from a room on behalf of a moderator and announces it
+func (h *Handler) Kick(sess *session.Session, target *room.Room, username, reason string) error {
+	if err := checkModerator(sess, target, username); err != nil {
+		return err
+	}
+	member, online := h.sessionMgr.GetSessionByUsername(username)
+	if !online || !member.InRoom(target.Name) {
+		return fmt.Errorf("%s is not in %s", username, target.Name)
+	}
+
+	log.Printf("%s kicked %s from %s%s", sess.GetUsername(), member.GetUsername(), target.Name, withReason(reason))
+	h.removeFromRoom(member, target, sess.GetUsername(),
+		fmt.Sprintf("%s kicked %s%s", sess.GetUsername(), member.GetUsername(), withReason(reason)),
+		fmt.Sprintf("You were kicked from %s by %s%s", target.Name, sess.GetUsername(), withReason(reason)))
+	return nil
+}
+
+// handleBan lists the current room's bans or bans a user, email or IP
+// address from it: /ban [<user|email|ip> [duration] [reason]]
+func (h *Handler) handleBan(sess *session.Session, parts []string) error {
+	target, exists := h.roomMgr.GetRoom(sess.GetCurrentRoom())
+	if !exists {
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in any room."))
+	}
+	if len(parts) < 2 {
+		return sess.SendMessage(protocol.NewCommandMessage(banList(target)))
+	}
+
+	ban := storage.Ban{Target: parts[1], By: sess.GetUsername(), At: time.Now()}
+	isUser := !strings.Contains(ban.Target, "@") && net.ParseIP(ban.Target) == nil
+	if isUser {
+		acct, registered := h.accounts.GetByUsername(ban.Target)
+		if !registered {
+			return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("No registered user named '%s'.", ban.Target)))
+		}
+		ban.Target = acct.Username
+		if err := checkModerator(sess, target, ban.Target); err != nil {
+			return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot ban %s: %v.", ban.Target, err)))
+		}
+	} else if strings.Contains(ban.Target, "@") {
+		ban.Target = strings.ToLower(ban.Target)
+	}
+
+	args := parts[2:]
+	if len(args) > 0 {
+		if duration, err := storage.ParseAge(args[0]); err == nil && duration > 0 {
+			ban.Until = ban.At.Add(duration)
+			args = args[1:]
+		}
+	}
+	ban.Reason = strings.Join(args, " ")
+
+	// Everyone in the room the ban matches is removed, so moderators can't
+	// ban each other by email or address
+	banned := make([]*session.Session, 0)
+	for _, member := range target.GetMembers() {
+		if ban.Matches(member.GetUsername(), member.GetEmail(), member.IP) {
+			if err := checkModerator(sess, target, member.GetUsername()); err != nil {
+				return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot ban %s: %v.", ban.Target, err)))
+			}
+			banned = append(banned, member)
+		}
+	}
+
+	if err := h.roomMgr.Ban(target, ban); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	log.Printf("%s banned %s from %s%s%s", sess.GetUsername(), ban.Target, target.Name, untilText(ban.Until), withReason(ban.Reason))
+
+	// Email and IP bans are announced by the users they remove, keeping the
+	// addresses private
+	if isUser && len(banned) == 0 {
+		target.Broadcast(protocol.NewSystemMessage(fmt.Sprintf("%s banned %s%s%s",
+			sess.GetUsername(), ban.Target, untilText(ban.Until), withReason(ban.Reason))), "")
+	}
+	for _, member := range banned {
+		h.removeFromRoom(member, target, sess.GetUsername(),
+			fmt.Sprintf("%s banned %s%s%s", sess.GetUsername(), member.GetUsername(), untilText(ban.Until), withReason(ban.Reason)),
+			fmt.Sprintf("You were banned from %s by %s%s%s", target.Name, sess.GetUsername(), untilText(ban.Until), withReason(ban.Reason)))
+	}
+	if !isUser {
+		return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Banned %s from %s%s.", ban.Target, target.Name, untilText(ban.Until))))
+	}
+	return nil
+}
+
+// handleUnban lifts a ban from the current room: /unban <user|email|ip>
+func (h *Handler) handleUnban(sess *session.Session, parts []string) error {
+	target, exists := h.roomMgr.GetRoom(sess.GetCurrentRoom())
+	if !exists {
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in any room."))
+	}
+
+	found, err := h.roomMgr.Unban(target, parts[1])
+	if err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	if !found {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("%s is not banned from %s.", parts[1], target.Name)))
+	}
+	log.Printf("%s lifted the ban on %s from %s", sess.GetUsername(), parts[1], target.Name)
+	return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Lifted the ban on %s from %s.", parts[1], target.Name)))
+}
+
+// handleMute stops a user from talking in the current room:
+// /mute <user> [duration]
+func (h *Handler) handleMute(sess *session.Session, parts []string) error {
+	target, exists := h.roomMgr.GetRoom(sess.GetCurrentRoom())
+	if !exists {
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in any room."))
+	}
+	acct, registered := h.accounts.GetByUsername(parts[1])
+	if !registered {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("No registered user named '%s'.", parts[1])))
+	}
+	if err := checkModerator(sess, target, acct.Username); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot mute %s: %v.", acct.Username, err)))
+	}
+
+	mute := storage.RoomMute{Username: acct.Username, By: sess.GetUsername(), At: time.Now()}
+	if len(parts) > 2 {
+		duration, err := storage.ParseAge(parts[2])
+		if err != nil || duration <= 0 {
+			return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Invalid duration '%s'. Use e.g. 10m, 2h or 1d.", parts[2])))
+		}
+		mute.Until = mute.At.Add(duration)
+	}
+
+	if err := h.roomMgr.Mute(target, mute); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	log.Printf("%s muted %s in %s%s", sess.GetUsername(), mute.Username, target.Name, untilText(mute.Until))
+	target.BroadcastToAll(protocol.NewSystemMessage(fmt.Sprintf("%s muted %s%s", sess.GetUsername(), mute.Username, untilText(mute.Until))))
+	return nil
+}
+
+// handleUnmute lets a muted user talk in the current room again:
+// /unmute <user>
+func (h *Handler) handleUnmute(sess *session.Session, parts []string) error {
+	target, exists := h.roomMgr.GetRoom(sess.GetCurrentRoom())
+	if !exists {
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in any room."))
+	}
+
+	found, err := h.roomMgr.Unmute(target, parts[1])
+	if err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	if !found {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("%s is not muted in %s.", parts[1], target.Name)))
+	}
+	log.Printf("%s unmuted %s in %s", sess.GetUsername(), parts[1], target.Name)
+	target.BroadcastToAll(protocol.NewSystemMessage(fmt.Sprintf("%s unmuted %s", sess.GetUsername(), parts[1])))
+	return nil
+}
+
+// checkModerator returns why a user may not kick, ban or mute another in a
+// room, or nil if they may: moderators act on members and guests, the owner
+// on everyone else
+func checkModerator(sess *session.Session, target *room.Room, username string) error {
+	if !isModerator(sess, target) {
+		return fmt.Errorf("you are not a moderator of %s", target.Name)
+	}
+	if strings.EqualFold(username, sess.GetUsername()) {
+		return fmt.Errorf("you can't do that to yourself")
+	}
+	if role := target.RoleOf(username); role >= target.RoleOf(sess.GetUsername()) {
+		return fmt.Errorf("%s is %s of %s", username, withArticle(role), target.Name)
+	}
+	return nil
+}
+
+// removeFromRoom takes a user out of a room on a moderator's behalf,
+// announcing it to the members who stay (unless announcement is empty) and
+// telling the user. Users left in no room return to the default room.
+func (h *Handler) removeFromRoom(member *session.Session, target *room.Room, by, announcement, notice string) {
+	wasCurrent := member.GetCurrentRoom() == target.Name
+	h.roomMgr.LeaveRoom(member, target.Name)
+	if _, exists := h.roomMgr.GetRoom(target.Name); exists && announcement != "" {
+		target.Broadcast(protocol.NewSystemMessage(announcement), "")
+	}
+
+	removed := protocol.NewSystemMessage(notice)
+	removed.From = by
+	removed.Room = target.Name
+	removed.Removed = true
+	member.SendMessage(removed)
+
+	if len(member.GetRooms()) > 0 {
+		if wasCurrent {
+			switched := protocol.NewSystemMessage(fmt.Sprintf("Now talking in %s", member.GetCurrentRoom()))
+			switched.Room = member.GetCurrentRoom()
+			member.SendMessage(switched)
+		}
+		return
+	}
+
+	defaultRoom := h.roomMgr.GetDefaultRoom()
+	if err := h.roomMgr.JoinRoom(defaultRoom.Name, member, "", nil); err != nil {
+		member.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot join %s: %v.", defaultRoom.Name, err)))
+		return
+	}
+	joined := protocol.NewSystemMessage(fmt.Sprintf("You joined %s", defaultRoom.Name))
+	joined.Room = defaultRoom.Name
+	member.SendMessage(joined)
+	h.SendTopic(member, defaultRoom)
+	defaultRoom.Broadcast(protocol.NewSystemMessage(fmt.Sprintf("%s joined the room", member.GetUsername())), member.GetUsername())
+}
+
+// banList describes a room's bans for /ban
+func banList(target *room.Room) string {
+	bans := target.GetBans()
+	if len(bans) == 0 {
+		return fmt.Sprintf("Nobody is banned from %s.", target.Name)
+	}
+
+	msg := fmt.Sprintf("Bans in %s (%d):\n", target.Name, len(bans))
+	for _, ban := range bans {
+		msg += fmt.Sprintf("  - %s by %s on %s%s%s\n", ban.Target, ban.By,
+			ban.At.Local().Format("2006-01-02 15:04"), untilText(ban.Until), withReason(ban.Reason))
+	}
+	return msg
+}
+
+// untilText describes when a ban or mute ends, e.g. " until 2024-05-01
+// 14:30", or "" if it doesn't
+func untilText(until time.Time) string {
+	if until.IsZero() {
+		return ""
+	}
+	return " until " + until.Local().Format("2006-01-02 15:04")
+}
+
+// withReason appends a moderator's reason to a notice
+func withReason(reason string) string {
+	if reason == "" {
+		return ""
+	}
+	return ": " + reason
+}
@@ -0,0 +1,88 @@
+package message
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+	"github.com/mullayam/go-tcp-chat/internal/session"
+	"github.com/mullayam/go-tcp-chat/internal/storage"
+)
+
+// handleQuery starts or ends a conversation in which plain lines go to one
+// user: /query <user> [n] starts it, replaying n messages; /query ends it
+func (h *Handler) handleQuery(sess *session.Session, parts []string) error {
+	usage := "Usage: /query <user> [number of messages to replay], or /query to stop"
+
+	if len(parts) < 2 {
+		partner := sess.GetPrivateChat()
+		if partner == "" {
+			return sess.SendMessage(protocol.NewErrorMessage(usage))
+		}
+		sess.SetPrivateChat("")
+		notice := protocol.NewSystemMessage(fmt.Sprintf("You stopped talking to %s and returned to %s.", partner, sess.GetCurrentRoom()))
+		notice.Room = sess.GetCurrentRoom()
+		return sess.SendMessage(notice)
+	}
+
+	replay := h.roomMgr.DefaultReplay()
+	if len(parts) > 2 {
+		n, err := strconv.Atoi(parts[2])
+		if err != nil || n < 0 {
+			return sess.SendMessage(protocol.NewErrorMessage(usage))
+		}
+		replay = storage.Replay{MaxMessages: n}
+	}
+
+	// Use the partner's registered spelling, or the online user's if unregistered
+	partner := ""
+	if acct, registered := h.accounts.GetByUsername(parts[1]); registered {
+		partner = acct.Username
+	} else if target, online := h.sessionMgr.GetSessionByUsername(parts[1]); online {
+		partner = target.GetUsername()
+	}
+	if partner == "" {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("No user named '%s'.", parts[1])))
+	}
+	if strings.EqualFold(partner, sess.GetUsername()) {
+		return sess.SendMessage(protocol.NewErrorMessage("You can't talk to yourself."))
+	}
+
+	sess.SetPrivateChat(partner)
+	h.replayConversation(sess, partner, replay)
+
+	notice := protocol.NewSystemMessage(fmt.Sprintf("You are now talking to %s. Type /query to return to %s.", partner, sess.GetCurrentRoom()))
+	notice.To = partner
+	return sess.SendMessage(notice)
+}
+
+// replayConversation sends the history of the user's conversation with
+// partner selected by replay, marked as replayed
+func (h *Handler) replayConversation(sess *session.Session, partner string, replay storage.Replay) {
+	history, err := replay.Load(h.messages, storage.ConversationKey(sess.GetUsername(), partner))
+	if err != nil {
+		log.Printf("Failed to load conversation of %s and %s: %v", sess.GetUsername(), partner, err)
+		return
+	}
+	if len(history) == 0 {
+		return
+	}
+
+	sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("--- History with %s (%d messages) ---", partner, len(history))))
+	for _, msg := range history {
+		sess.SendMessage(historyMessage(msg))
+	}
+	sess.SendMessage(protocol.NewSystemMessage("--- End of history ---"))
+}
+
+// historyMessage returns a stored message as sent to clients: marked as
+// replayed, and without the internal key of private conversations
+func historyMessage(msg *protocol.Message) *protocol.Message {
+	replayed := msg.Replayed()
+	if _, _, ok := storage.ConversationMembers(replayed.Room); ok {
+		replayed.Room = ""
+	}
+	return replayed
+}
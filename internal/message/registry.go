@@ -0,0 +1,174 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mullayam/go-tcp-chat/internal/session"
+)
+
+// Role is who may run a command. Room roles are checked in the room the
+// command acts on.
+type Role int
+
+const (
+	RoleAnyone    Role = iota // any signed-in user
+	RoleMember                // members of the room, but not guests
+	RoleModerator             // moderators and the owner of the room
+	RoleOwner                 // the owner of the room
+	RoleOperator              // server operators; hidden from everyone else
+)
+
+// ErrUsage is returned by argument parsers when a command was given the wrong
+// number of arguments
+var ErrUsage = errors.New("wrong number of arguments")
+
+// ArgParser checks a command's arguments, the words after the command
+// itself. It returns the room the command acts on, or "" for the current
+// room.
+type ArgParser func(args []string) (string, error)
+
+// Args accepts between min and max arguments; a negative max means no limit
+func Args(min, max int) ArgParser {
+	return func(args []string) (string, error) {
+		if len(args) < min || (max >= 0 && len(args) > max) {
+			return "", ErrUsage
+		}
+		return "", nil
+	}
+}
+
+// RoomArgs is like Args for commands that act on the room named by the
+// argument at index, when it is given
+func RoomArgs(min, max, index int) ArgParser {
+	check := Args(min, max)
+	return func(args []string) (string, error) {
+		if _, err := check(args); err != nil {
+			return "", err
+		}
+		if index < len(args) {
+			return roomArgument(args[index]), nil
+		}
+		return "", nil
+	}
+}
+
+// RunFunc runs a command. parts holds the command as typed followed by its
+// arguments.
+type RunFunc func(h *Handler, sess *session.Session, parts []string) error
+
+// Command describes a slash command
+type Command struct {
+	Name        string    // without the slash, e.g. "join"
+	Aliases     []string  // other names, e.g. "j"
+	Usage       string    // the arguments, e.g. "<room> [n]"
+	Description string    // one line for /help
+	Role        Role      // who may run it
+	Args        ArgParser // checks the arguments before Run (optional)
+	Run         RunFunc
+}
+
+// Syntax returns how to type the command, e.g. "/join <room> [n]"
+func (c *Command) Syntax() string {
+	if c.Usage == "" {
+		return "/" + c.Name
+	}
+	return "/" + c.Name + " " + c.Usage
+}
+
+// summary returns the command's description with the role it requires
+func (c *Command) summary() string {
+	switch c.Role {
+	case RoleMember:
+		return c.Description + " (members)"
+	case RoleModerator:
+		return c.Description + " (moderators)"
+	case RoleOwner:
+		return c.Description + " (owner only)"
+	}
+	return c.Description
+}
+
+// helpLine returns the command's line in /help
+func (c *Command) helpLine() string {
+	return fmt.Sprintf("  %-18s - %s\n", c.Syntax(), c.summary())
+}
+
+// Registry holds the commands a handler understands
+type Registry struct {
+	commands []*Command          // in registration order, as /help lists them
+	byName   map[string]*Command // names and aliases
+	mu       sync.RWMutex
+}
+
+// NewRegistry creates an empty command registry
+func NewRegistry() *Registry {
+	return &Registry{
+		commands: make([]*Command, 0),
+		byName:   make(map[string]*Command),
+	}
+}
+
+// commandName normalizes a command name, dropping the slash
+func commandName(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, "/"))
+}
+
+// Register adds a command. Its name and aliases must not be taken.
+func (r *Registry) Register(cmd Command) error {
+	if cmd.Name == "" || strings.ContainsAny(cmd.Name, " \t") {
+		return fmt.Errorf("invalid command name '%s'", cmd.Name)
+	}
+	if cmd.Run == nil {
+		return fmt.Errorf("command /%s has nothing to run", cmd.Name)
+	}
+
+	cmd.Name = commandName(cmd.Name)
+	aliases := make([]string, len(cmd.Aliases))
+	for i, alias := range cmd.Aliases {
+		aliases[i] = commandName(alias)
+	}
+	cmd.Aliases = aliases
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+		if _, exists := r.byName[name]; exists {
+			return fmt.Errorf("command /%s is already registered", name)
+		}
+	}
+	r.add(&cmd)
+	return nil
+}
+
+// add adds a command without checking it; the caller holds the lock or owns
+// the registry
+func (r *Registry) add(cmd *Command) {
+	r.commands = append(r.commands, cmd)
+	r.byName[cmd.Name] = cmd
+	for _, alias := range cmd.Aliases {
+		r.byName[alias] = cmd
+	}
+}
+
+// Lookup finds a command by name or alias, with or without the slash
+func (r *Registry) Lookup(name string) (*Command, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cmd, exists := r.byName[commandName(name)]
+	return cmd, exists
+}
+
+// Commands returns the registered commands in registration order
+func (r *Registry) Commands() []*Command {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	commands := make([]*Command, len(r.commands))
+	copy(commands, r.commands)
+	return commands
+}
@@ -0,0 +1,219 @@
+package message
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/mullayam/go-tcp-chat/internal/account"
+	"github.com/mullayam/go-tcp-chat/internal/room"
+	"github.com/mullayam/go-tcp-chat/internal/session"
+	"github.com/mullayam/go-tcp-chat/internal/storage"
+)
+
+func TestArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		parser   ArgParser
+		args     []string
+		wantRoom string
+		wantErr  bool
+	}{
+		{name: "none allowed", parser: Args(0, 0)},
+		{name: "too many", parser: Args(0, 0), args: []string{"x"}, wantErr: true},
+		{name: "too few", parser: Args(1, 2), wantErr: true},
+		{name: "in range", parser: Args(1, 2), args: []string{"a", "b"}},
+		{name: "unbounded", parser: Args(1, -1), args: []string{"a", "b", "c", "d"}},
+		{name: "room given", parser: RoomArgs(0, 2, 0), args: []string{"ops", "x"}, wantRoom: "#ops"},
+		{name: "room with hash", parser: RoomArgs(1, 2, 1), args: []string{"x", "#ops"}, wantRoom: "#ops"},
+		{name: "group", parser: RoomArgs(1, 1, 0), args: []string{room.GroupPrefix + "7"}, wantRoom: room.GroupPrefix + "7"},
+		{name: "room left out", parser: RoomArgs(1, 2, 1), args: []string{"x"}},
+		{name: "room args checked", parser: RoomArgs(1, 1, 0), args: []string{"a", "b"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roomName, err := tt.parser(tt.args)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUsage) {
+					t.Errorf("parser(%q) error = %v, want ErrUsage", tt.args, err)
+				}
+				return
+			}
+			if err != nil || roomName != tt.wantRoom {
+				t.Errorf("parser(%q) = %q, %v, want %q", tt.args, roomName, err, tt.wantRoom)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	run := func(*Handler, *session.Session, []string) error { return nil }
+	r := NewRegistry()
+	if err := r.Register(Command{Name: "/Deploy", Aliases: []string{"D"}, Run: run}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cmd  Command
+	}{
+		{name: "empty name", cmd: Command{Run: run}},
+		{name: "name with a space", cmd: Command{Name: "de ploy", Run: run}},
+		{name: "nothing to run", cmd: Command{Name: "ship"}},
+		{name: "name taken", cmd: Command{Name: "deploy", Run: run}},
+		{name: "alias taken", cmd: Command{Name: "ship", Aliases: []string{"/d"}, Run: run}},
+		{name: "name is an alias", cmd: Command{Name: "d", Run: run}},
+	}
+	for _, tt := range tests {
+		if err := r.Register(tt.cmd); err == nil {
+			t.Errorf("%s: Register accepted %+v", tt.name, tt.cmd)
+		}
+	}
+
+	for _, name := range []string{"deploy", "/DEPLOY", "d"} {
+		if cmd, ok := r.Lookup(name); !ok || cmd.Name != "deploy" {
+			t.Errorf("Lookup(%q) = %v, %v, want /deploy", name, cmd, ok)
+		}
+	}
+	if _, ok := r.Lookup("ship"); ok {
+		t.Error("a rejected command was registered")
+	}
+}
+
+// newTestHandler returns a handler whose room #r is owned by alice, with bob
+// as moderator and gus as guest
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	store := storage.NewMemoryStore()
+	messages, err := storage.NewIndexedStore(store, 0)
+	if err != nil {
+		t.Fatalf("NewIndexedStore: %v", err)
+	}
+	roomMgr, err := room.NewManager(messages, storage.Retention{}, storage.Replay{})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	r, err := roomMgr.CreateRoom("#r", "alice")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	if err := roomMgr.SetRole(r, "bob", room.RoleModerator); err != nil {
+		t.Fatalf("SetRole: %v", err)
+	}
+	if err := roomMgr.SetRole(r, "gus", room.RoleGuest); err != nil {
+		t.Fatalf("SetRole: %v", err)
+	}
+	return NewHandler(session.NewManager(3, 20), roomMgr, account.NewStore(store), messages, HandlerOptions{
+		Operators: []string{"op@example.com"},
+	})
+}
+
+// newTestSession returns a session for a user in the given rooms. Whatever
+// the server sends it is discarded.
+func newTestSession(t *testing.T, h *Handler, username, email string, rooms ...string) *session.Session {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { server.Close(); client.Close() })
+	go io.Copy(io.Discard, client)
+
+	sess := session.NewSession(server, "192.0.2.1")
+	sess.SetUsername(username)
+	sess.SetEmail(email)
+	for _, name := range rooms {
+		if err := h.roomMgr.JoinRoom(name, sess, "", nil); err != nil {
+			t.Fatalf("JoinRoom(%s): %v", name, err)
+		}
+	}
+	return sess
+}
+
+func TestCheckRole(t *testing.T) {
+	h := newTestHandler(t)
+
+	tests := []struct {
+		name     string
+		username string
+		rooms    []string
+		role     Role
+		roomName string
+		wantErr  string
+	}{
+		{name: "anyone outside rooms", username: "dave", role: RoleAnyone},
+		{name: "operator command", username: "dave", role: RoleOperator},
+		{name: "no room", username: "dave", role: RoleMember, wantErr: "you are not in any room"},
+		{name: "other room", username: "dave", rooms: []string{"#r"}, role: RoleMember, roomName: "#general", wantErr: "you are not in #general"},
+		{name: "missing room", username: "dave", rooms: []string{"#r"}, role: RoleMember, roomName: "#nope", wantErr: "you are not in #nope"},
+		{name: "member", username: "dave", rooms: []string{"#r"}, role: RoleMember},
+		{name: "guest as member", username: "gus", rooms: []string{"#r"}, role: RoleMember, wantErr: "guests can't use it in #r"},
+		{name: "guest for anyone", username: "gus", rooms: []string{"#r"}, role: RoleAnyone},
+		{name: "member as moderator", username: "dave", rooms: []string{"#r"}, role: RoleModerator, wantErr: "it is reserved for the moderators of #r"},
+		{name: "moderator", username: "bob", rooms: []string{"#r"}, role: RoleModerator},
+		{name: "moderator as owner", username: "bob", rooms: []string{"#r"}, role: RoleOwner, wantErr: "it is reserved for the owner of #r"},
+		{name: "owner", username: "alice", rooms: []string{"#r"}, role: RoleOwner},
+		{name: "owner as moderator", username: "alice", rooms: []string{"#r"}, role: RoleModerator},
+		// The role that counts is the one in the named room, not the current one
+		{name: "owner acting from another room", username: "alice", rooms: []string{"#r", "#general"}, role: RoleOwner, roomName: "#r"},
+		{name: "owner elsewhere", username: "alice", rooms: []string{"#r", "#general"}, role: RoleOwner, wantErr: "it is reserved for the owner of #general"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess := newTestSession(t, h, tt.username, "", tt.rooms...)
+			err := h.checkRole(sess, &Command{Name: "test", Role: tt.role}, tt.roomName)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("checkRole = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Errorf("checkRole = %v, want %s", err, tt.wantErr)
+			}
+			for _, name := range tt.rooms {
+				h.roomMgr.LeaveRoom(sess, name)
+			}
+		})
+	}
+}
+
+func TestHandleCommandEnforcesRoles(t *testing.T) {
+	h := newTestHandler(t)
+	ran := false
+	for _, cmd := range []Command{
+		{Name: "modonly", Role: RoleModerator, Args: RoomArgs(0, 1, 0)},
+		{Name: "oponly", Role: RoleOperator},
+	} {
+		cmd.Run = func(*Handler, *session.Session, []string) error {
+			ran = true
+			return nil
+		}
+		if err := h.Commands().Register(cmd); err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+	}
+
+	tests := []struct {
+		username string
+		email    string
+		command  string
+		wantRun  bool
+	}{
+		{username: "bob", command: "/modonly", wantRun: true},
+		{username: "dave", command: "/modonly"},
+		{username: "gus", command: "/modonly r"},
+		{username: "bob", command: "/modonly r too many"},
+		{username: "dave", email: "dave@example.com", command: "/oponly"},
+		{username: "eve", email: "OP@example.com", command: "/oponly", wantRun: true},
+	}
+
+	for _, tt := range tests {
+		sess := newTestSession(t, h, tt.username, tt.email, "#r")
+		ran = false
+		if err := h.HandleCommand(sess, tt.command); err != nil {
+			t.Fatalf("HandleCommand(%q): %v", tt.command, err)
+		}
+		if ran != tt.wantRun {
+			t.Errorf("%s ran %q = %v, want %v", tt.username, tt.command, ran, tt.wantRun)
+		}
+		h.roomMgr.LeaveRoom(sess, "#r")
+	}
+}
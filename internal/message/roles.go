@@ -0,0 +1,203 @@
+package message
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+	"github.com/mullayam/go-tcp-chat/internal/room"
+	"github.com/mullayam/go-tcp-chat/internal/session"
+)
+
+// isOwner reports whether a user owns a room
+func isOwner(sess *session.Session, target *room.Room) bool {
+	return target.RoleOf(sess.GetUsername()) == room.RoleOwner
+}
+
+// isModerator reports whether a user moderates or owns a room
+func isModerator(sess *session.Session, target *room.Room) bool {
+	return target.RoleOf(sess.GetUsername()) >= room.RoleModerator
+}
+
+// roomModerators returns the sorted usernames of a room's moderators, leaving
+// out its owner
+func roomModerators(target *room.Room) []string {
+	moderators := make([]string, 0)
+	for username, role := range target.GetRoles() {
+		if role == room.RoleModerator {
+			moderators = append(moderators, username)
+		}
+	}
+	sort.Strings(moderators)
+	return moderators
+}
+
+// handleOp makes a user a moderator of a room: /op <user> [room]
+func (h *Handler) handleOp(sess *session.Session, parts []string) error {
+	return h.changeRole(sess, parts[1], room.RoleModerator, parts[2:])
+}
+
+// handleDeop makes a moderator a regular member again: /deop <user> [room]
+func (h *Handler) handleDeop(sess *session.Session, parts []string) error {
+	return h.changeRole(sess, parts[1], room.RoleMember, parts[2:])
+}
+
+// handleRole shows a user's role or gives them one:
+// /role <user> [moderator|member|guest] [room]
+func (h *Handler) handleRole(sess *session.Session, parts []string) error {
+	if len(parts) < 3 || strings.HasPrefix(parts[2], "#") || strings.HasPrefix(parts[2], room.GroupPrefix) {
+		target, err := h.roleRoom(sess, parts[2:])
+		if err != nil {
+			return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot show the role: %v.", err)))
+		}
+		return sess.SendMessage(protocol.NewCommandMessage(fmt.Sprintf("%s is %s of %s.",
+			parts[1], withArticle(target.RoleOf(parts[1])), target.Name)))
+	}
+
+	role, err := room.ParseRole(parts[2])
+	if err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot change the role: %v.", err)))
+	}
+	return h.changeRole(sess, parts[1], role, parts[3:])
+}
+
+// changeRole gives a user a role in the room named in args, or the current
+// room, and announces it. The owner may give any role; moderators may only
+// switch users below them between member and guest.
+func (h *Handler) changeRole(sess *session.Session, username string, role room.Role, args []string) error {
+	target, err := h.roleRoom(sess, args)
+	if err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot change the role: %v.", err)))
+	}
+
+	acct, registered := h.accounts.GetByUsername(username)
+	if !registered {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("No registered user named '%s'.", username)))
+	}
+	if strings.EqualFold(acct.Username, sess.GetUsername()) {
+		return sess.SendMessage(protocol.NewErrorMessage("You can't change your own role."))
+	}
+
+	current := target.RoleOf(acct.Username)
+	if role >= room.RoleModerator || current >= room.RoleModerator {
+		if !isOwner(sess, target) {
+			return sess.SendMessage(protocol.NewErrorMessage("Only the room's owner can appoint or remove moderators."))
+		}
+	} else if !isModerator(sess, target) {
+		return sess.SendMessage(protocol.NewErrorMessage("Only the room's moderators can change roles."))
+	}
+	if current == role {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("%s is already %s of %s.", acct.Username, withArticle(role), target.Name)))
+	}
+
+	if err := h.roomMgr.SetRole(target, acct.Username, role); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	target.BroadcastToAll(protocol.NewSystemMessage(fmt.Sprintf("%s made %s %s", sess.GetUsername(), acct.Username, withArticle(role))))
+	h.notifyRole(sess, acct.Username, target)
+	return nil
+}
+
+// handleTransfer hands a room over to another user: /transfer <user> [room].
+// The previous owner stays on as a moderator.
+func (h *Handler) handleTransfer(sess *session.Session, parts []string) error {
+	target, err := h.roleRoom(sess, parts[2:])
+	if err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot transfer the room: %v.", err)))
+	}
+
+	acct, registered := h.accounts.GetByUsername(parts[1])
+	if !registered {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("No registered user named '%s'.", parts[1])))
+	}
+	if strings.EqualFold(acct.Username, sess.GetUsername()) {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("You already own %s.", target.Name)))
+	}
+
+	if err := h.roomMgr.TransferOwnership(target, acct.Username); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	target.BroadcastToAll(protocol.NewSystemMessage(fmt.Sprintf("%s transferred ownership of the room to %s", sess.GetUsername(), acct.Username)))
+	h.notifyRole(sess, acct.Username, target)
+	return nil
+}
+
+// notifyRole tells a user who is online but not in a room about their new
+// role there; members learn of it from the room's announcement
+func (h *Handler) notifyRole(sess *session.Session, username string, target *room.Room) {
+	if target.HasMember(username) {
+		return
+	}
+	if user, online := h.sessionMgr.GetSessionByUsername(username); online {
+		user.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("%s made you %s of %s.",
+			sess.GetUsername(), withArticle(target.RoleOf(username)), target.Name)))
+	}
+}
+
+// handleMembers lists the members of a room with their roles:
+// /members [room]
+func (h *Handler) handleMembers(sess *session.Session, parts []string) error {
+	target, err := h.roleRoom(sess, parts[1:])
+	if err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot list the members: %v.", err)))
+	}
+
+	type member struct {
+		name string
+		role room.Role
+	}
+	members := make([]member, 0)
+	for _, username := range target.GetMemberNames() {
+		members = append(members, member{username, target.RoleOf(username)})
+	}
+	// Owner first, then moderators, members and guests, each by name
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].role != members[j].role {
+			return members[i].role > members[j].role
+		}
+		return members[i].name < members[j].name
+	})
+
+	msg := fmt.Sprintf("Members of %s (%d):\n", target.Name, len(members))
+	for _, m := range members {
+		line := "  - " + m.name
+		if m.role != room.RoleMember {
+			line += fmt.Sprintf(" (%s)", m.role)
+		}
+		if _, muted := target.MutedUntil(m.name); muted {
+			line += " (muted)"
+		}
+		if m.name == sess.GetUsername() {
+			line += " (you)"
+		}
+		msg += line + "\n"
+	}
+	if owner := target.GetOwner(); owner != "" && !target.HasMember(owner) {
+		msg += fmt.Sprintf("  Owner %s is not here.\n", owner)
+	}
+	return sess.SendMessage(protocol.NewCommandMessage(msg))
+}
+
+// roleRoom returns the room a role command is about: the one named in args,
+// or the current room. The user must be in it.
+func (h *Handler) roleRoom(sess *session.Session, args []string) (*room.Room, error) {
+	roomName := sess.GetCurrentRoom()
+	if len(args) > 0 {
+		roomName = roomArgument(args[0])
+	}
+	target, exists := h.roomMgr.GetRoom(roomName)
+	if !exists || !sess.InRoom(roomName) {
+		return nil, fmt.Errorf("you are not in %s", roomName)
+	}
+	return target, nil
+}
+
+// withArticle returns a role's name with its article, e.g. "a moderator" or
+// "the owner"
+func withArticle(role room.Role) string {
+	if role == room.RoleOwner {
+		return "the owner"
+	}
+	return "a " + role.String()
+}
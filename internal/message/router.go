@@ -1,6 +1,8 @@
 package message
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/mullayam/go-tcp-chat/internal/protocol"
@@ -42,26 +44,55 @@ func (r *Router) Route(sess *session.Session, message string) error {
 func (r *Router) routeChatMessage(sess *session.Session, content string) error {
 	// Validate message length
 	if len(content) > protocol.MaxMessageLength {
-		return sess.Send(protocol.NewErrorMessage("Message too long. Maximum length is 1024 characters.").Format())
+		return sess.SendMessage(protocol.NewErrorMessage("Message too long. Maximum length is 1024 characters."))
 	}
 
-	// Check if user is in a private chat
-	privateChatWith := sess.GetPrivateChat()
-	if privateChatWith != "" {
-		// This would be for persistent private chat mode
-		// For now, we only support /msg command for private messages
-		sess.SetPrivateChat("")
+	// In a /query conversation, plain lines go to the partner
+	if partner := sess.GetPrivateChat(); partner != "" {
+		if err := r.handler.SendPrivateMessage(sess, partner, content); err != nil {
+			return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+		}
+		return sess.SendMessage(protocol.NewCommandMessage(fmt.Sprintf("[PM to %s]: %s", partner, content)))
 	}
 
 	// Route to current room
 	currentRoom := sess.GetCurrentRoom()
 	if currentRoom == "" {
-		return sess.Send(protocol.NewErrorMessage("You are not in any room.").Format())
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in any room."))
 	}
+	return r.RouteChatToRoom(sess, currentRoom, content)
+}
+
+// RouteChatToRoom sends a chat message to one of the rooms the user has
+// joined, whichever room is current, telling the user if it can't
+func (r *Router) RouteChatToRoom(sess *session.Session, roomName, content string) error {
+	if err := r.DeliverToRoom(sess, roomName, content); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	return nil
+}
 
-	room, exists := r.roomMgr.GetRoom(currentRoom)
+// DeliverToRoom sends a chat message to one of the rooms the user has joined
+// and returns why it couldn't, without telling the user. Front-ends use it
+// for messages that must never be answered automatically, such as IRC
+// NOTICEs.
+func (r *Router) DeliverToRoom(sess *session.Session, roomName, content string) error {
+	if len(content) > protocol.MaxMessageLength {
+		return errors.New("Message too long. Maximum length is 1024 characters.")
+	}
+	if !sess.InRoom(roomName) {
+		return fmt.Errorf("You are not in %s.", roomName)
+	}
+
+	room, exists := r.roomMgr.GetRoom(roomName)
 	if !exists {
-		return sess.Send(protocol.NewErrorMessage("Current room no longer exists.").Format())
+		return fmt.Errorf("Room %s no longer exists.", roomName)
+	}
+	if until, muted := room.MutedUntil(sess.GetUsername()); muted {
+		if until.IsZero() {
+			return fmt.Errorf("You are muted in %s.", roomName)
+		}
+		return fmt.Errorf("You are muted in %s until %s.", roomName, until.Local().Format("15:04"))
 	}
 
 	// Create and broadcast the message
@@ -0,0 +1,127 @@
+package message
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+	"github.com/mullayam/go-tcp-chat/internal/room"
+	"github.com/mullayam/go-tcp-chat/internal/session"
+	"github.com/mullayam/go-tcp-chat/internal/storage"
+)
+
+// maxSearchResults caps the number of /search results shown
+const maxSearchResults = 20
+
+// handleSearch searches the history the user can read:
+// /search <words> [in #room|&group|@user] [from <user>] [since <when>]
+func (h *Handler) handleSearch(sess *session.Session, parts []string) error {
+	usage := "Usage: /search <words> [in #room|@user] [from <user>] [since <date|time|today|yesterday|2d>]"
+
+	query := storage.SearchQuery{Limit: maxSearchResults}
+	scope := ""
+	words := make([]string, 0, len(parts))
+	args := parts[1:]
+	for i := 0; i < len(args); i++ {
+		if i+1 < len(args) {
+			value := args[i+1]
+			switch strings.ToLower(args[i]) {
+			case "in":
+				// "in" only filters when followed by a room or user, so it
+				// can still be searched for
+				if strings.HasPrefix(value, "#") || strings.HasPrefix(value, "@") || strings.HasPrefix(value, room.GroupPrefix) {
+					scope = value
+					i++
+					continue
+				}
+			case "from":
+				query.From = strings.TrimPrefix(value, "@")
+				i++
+				continue
+			case "since":
+				since, err := parseSince(value)
+				if err != nil {
+					return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Invalid date '%s'. %s", value, usage)))
+				}
+				query.Since = since
+				i++
+				continue
+			}
+		}
+		words = append(words, args[i])
+	}
+	if len(words) == 0 {
+		return sess.SendMessage(protocol.NewErrorMessage(usage))
+	}
+	query.Text = strings.Join(words, " ")
+
+	username := sess.GetUsername()
+	query.Allowed = func(key string) bool {
+		return h.canReadHistory(sess, key)
+	}
+	if scope != "" {
+		key := scope
+		if user, ok := strings.CutPrefix(scope, "@"); ok {
+			key = storage.ConversationKey(username, user)
+		}
+		if !h.canReadHistory(sess, key) {
+			return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Room '%s' does not exist.", scope)))
+		}
+		query.Allowed = func(k string) bool {
+			return k == key
+		}
+	}
+
+	results := h.messages.Search(query)
+	if len(results) == 0 {
+		return sess.SendMessage(protocol.NewCommandMessage(fmt.Sprintf("No messages match \"%s\".", query.Text)))
+	}
+
+	msg := fmt.Sprintf("Search results for \"%s\" (%d, newest first):\n", query.Text, len(results))
+	for _, result := range results {
+		where := result.Room
+		if a, b, ok := storage.ConversationMembers(result.Room); ok {
+			where = "@" + a
+			if strings.EqualFold(a, username) {
+				where = "@" + b
+			}
+		}
+		msg += fmt.Sprintf("  [%s] %s <%s> %s\n", result.Timestamp.Local().Format("2006-01-02 15:04"), where, result.From, result.Content)
+	}
+	if len(results) == maxSearchResults {
+		msg += fmt.Sprintf("  Only the newest %d results are shown; narrow the search with in, from or since.\n", maxSearchResults)
+	}
+	return sess.SendMessage(protocol.NewCommandMessage(msg))
+}
+
+// canReadHistory reports whether a user may read the history of a room or
+// direct conversation. Rooms are open to their members and everyone who can
+// join them without a key and isn't banned; direct conversations only to
+// their two participants.
+func (h *Handler) canReadHistory(sess *session.Session, key string) bool {
+	username := sess.GetUsername()
+	if a, b, ok := storage.ConversationMembers(key); ok {
+		return strings.EqualFold(a, username) || strings.EqualFold(b, username)
+	}
+	room, exists := h.roomMgr.GetRoom(key)
+	return exists && (sess.InRoom(key) || room.CanJoin(username, sess.GetEmail(), sess.IP))
+}
+
+// parseSince parses the start of a /search: a date or time, "today",
+// "yesterday" or an age such as "2d" or "12h"
+func parseSince(value string) (time.Time, error) {
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	switch strings.ToLower(value) {
+	case "today":
+		return midnight, nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), nil
+	}
+	if age, err := storage.ParseAge(value); err == nil && age > 0 {
+		return now.Add(-age), nil
+	}
+	return parseTime(value)
+}
@@ -0,0 +1,210 @@
+package message
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+	"github.com/mullayam/go-tcp-chat/internal/room"
+	"github.com/mullayam/go-tcp-chat/internal/session"
+)
+
+const (
+	// maxTopicLength caps room topics and descriptions
+	maxTopicLength = 300
+	// maxTags caps the number of tags on a room
+	maxTags = 10
+	// maxTagLength caps the length of a single tag
+	maxTagLength = 24
+)
+
+// handleTopic shows the current room's topic and details, or sets the topic:
+// /topic [text|-]
+func (h *Handler) handleTopic(sess *session.Session, parts []string) error {
+	room, exists := h.roomMgr.GetRoom(sess.GetCurrentRoom())
+	if !exists {
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in any room."))
+	}
+
+	if len(parts) < 2 {
+		return sess.SendMessage(protocol.NewCommandMessage(roomDetails(room)))
+	}
+
+	text := strings.Join(parts[1:], " ")
+	if text == "-" {
+		text = ""
+	}
+	if err := h.ChangeTopic(sess, room, text); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Cannot change the topic: %v.", err)))
+	}
+	return nil
+}
+
+// ChangeTopic sets a room's topic on behalf of a moderator (empty text
+// clears it) and announces the change to the room, recording it in its
+// history
+func (h *Handler) ChangeTopic(sess *session.Session, room *room.Room, text string) error {
+	if !isModerator(sess, room) {
+		return fmt.Errorf("it is reserved for the room's moderators")
+	}
+	if len(text) > maxTopicLength {
+		return fmt.Errorf("it is too long (maximum %d characters)", maxTopicLength)
+	}
+	if err := h.roomMgr.SetTopic(room, text, sess.GetUsername()); err != nil {
+		return err
+	}
+
+	notice := fmt.Sprintf("%s changed the topic to: %s", sess.GetUsername(), text)
+	if text == "" {
+		notice = fmt.Sprintf("%s cleared the topic", sess.GetUsername())
+	}
+	room.Broadcast(protocol.NewSystemMessage(notice), "")
+	return nil
+}
+
+// handleDescribe shows or changes the current room's description:
+// /describe [text|-]
+func (h *Handler) handleDescribe(sess *session.Session, parts []string) error {
+	room, exists := h.roomMgr.GetRoom(sess.GetCurrentRoom())
+	if !exists {
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in any room."))
+	}
+
+	if len(parts) < 2 {
+		description := room.GetDescription()
+		if description == "" {
+			description = "(none)"
+		}
+		return sess.SendMessage(protocol.NewCommandMessage(fmt.Sprintf("Description of %s: %s", room.Name, description)))
+	}
+
+	if !isOwner(sess, room) {
+		return sess.SendMessage(protocol.NewErrorMessage("Only the room's owner can change its description."))
+	}
+
+	description := strings.Join(parts[1:], " ")
+	if description == "-" {
+		description = ""
+	}
+	if len(description) > maxTopicLength {
+		return sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Description too long. Maximum length is %d characters.", maxTopicLength)))
+	}
+
+	if err := h.roomMgr.SetDescription(room, description); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	if description == "" {
+		return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Description of %s cleared.", room.Name)))
+	}
+	return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Description of %s updated.", room.Name)))
+}
+
+// handleTags shows or changes the current room's tags:
+// /tags [tag,tag,...|-]
+func (h *Handler) handleTags(sess *session.Session, parts []string) error {
+	room, exists := h.roomMgr.GetRoom(sess.GetCurrentRoom())
+	if !exists {
+		return sess.SendMessage(protocol.NewErrorMessage("You are not in any room."))
+	}
+
+	if len(parts) < 2 {
+		tags := strings.Join(room.GetTags(), ", ")
+		if tags == "" {
+			tags = "(none)"
+		}
+		return sess.SendMessage(protocol.NewCommandMessage(fmt.Sprintf("Tags of %s: %s", room.Name, tags)))
+	}
+
+	if !isOwner(sess, room) {
+		return sess.SendMessage(protocol.NewErrorMessage("Only the room's owner can change its tags."))
+	}
+
+	var tags []string
+	if spec := strings.Join(parts[1:], " "); spec != "-" {
+		parsed, err := parseTags(spec)
+		if err != nil {
+			return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+		}
+		tags = parsed
+	}
+
+	if err := h.roomMgr.SetTags(room, tags); err != nil {
+		return sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+	}
+	if len(tags) == 0 {
+		return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Tags of %s cleared.", room.Name)))
+	}
+	return sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Tags of %s set to %s.", room.Name, strings.Join(tags, ", "))))
+}
+
+// parseTags parses a comma or space separated list of tags into unique
+// lowercase words of letters, digits, '-' and '_'
+func parseTags(spec string) ([]string, error) {
+	fields := strings.FieldsFunc(strings.ToLower(spec), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+
+	tags := make([]string, 0, len(fields))
+	for _, tag := range fields {
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag '%s' is too long (maximum %d characters)", tag, maxTagLength)
+		}
+		for _, r := range tag {
+			if !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9') && r != '-' && r != '_' {
+				return nil, fmt.Errorf("tag '%s' may only contain letters, digits, '-' and '_'", tag)
+			}
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("a room can have at most %d tags", maxTags)
+	}
+	return tags, nil
+}
+
+// SendTopic tells a user who just joined a room its topic, if it has one
+func (h *Handler) SendTopic(sess *session.Session, room *room.Room) {
+	topic := room.GetTopic()
+	if topic.Text == "" {
+		return
+	}
+
+	notice := protocol.NewSystemMessage(fmt.Sprintf("Topic for %s: %s", room.Name, topic.Text))
+	notice.Room = room.Name
+	sess.SendMessage(notice)
+	setBy := protocol.NewSystemMessage(fmt.Sprintf("Topic set by %s on %s", topic.SetBy, topic.SetAt.Local().Format("2006-01-02 15:04")))
+	setBy.Room = room.Name
+	sess.SendMessage(setBy)
+}
+
+// roomDetails describes a room's topic and metadata for /topic
+func roomDetails(room *room.Room) string {
+	msg := fmt.Sprintf("%s\n", room.Name)
+	if topic := room.GetTopic(); topic.Text != "" {
+		msg += fmt.Sprintf("  Topic:       %s\n", topic.Text)
+		msg += fmt.Sprintf("               set by %s on %s\n", topic.SetBy, topic.SetAt.Local().Format("2006-01-02 15:04"))
+	} else {
+		msg += "  Topic:       (none)\n"
+	}
+	if description := room.GetDescription(); description != "" {
+		msg += fmt.Sprintf("  Description: %s\n", description)
+	}
+	if room.CreatedBy != "" {
+		msg += fmt.Sprintf("  Created:     %s by %s\n", room.CreatedAt.Local().Format("2006-01-02 15:04"), room.CreatedBy)
+	} else {
+		msg += fmt.Sprintf("  Created:     %s\n", room.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	if owner := room.GetOwner(); owner != "" {
+		msg += fmt.Sprintf("  Owner:       %s\n", owner)
+	}
+	if moderators := roomModerators(room); len(moderators) > 0 {
+		msg += fmt.Sprintf("  Moderators:  %s\n", strings.Join(moderators, ", "))
+	}
+	if tags := room.GetTags(); len(tags) > 0 {
+		msg += fmt.Sprintf("  Tags:        %s\n", strings.Join(tags, ", "))
+	}
+	return msg
+}
@@ -0,0 +1,94 @@
+package protocol
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Protocol handshake constants
+const (
+	// ProtocolName identifies the server in HELLO replies
+	ProtocolName = "tcp-chat"
+
+	// ProtocolVersion is the version of the wire protocol spoken by the server
+	ProtocolVersion = 1
+)
+
+// Capability names that can be negotiated with CAP REQ
+const (
+	// CapJSON switches framing to one JSON object per line
+	CapJSON = "json"
+	// CapServerTime tags text frames with the server timestamp
+	CapServerTime = "server-time"
+	// CapMessageID tags text frames with the message ID
+	CapMessageID = "msgid"
+	// CapDeflate compresses both directions of the stream with DEFLATE
+	CapDeflate = "deflate"
+	// CapResume makes the server hand out resume tokens (see FormatToken)
+	CapResume = "resume"
+)
+
+// SupportedCapabilities lists every capability the server can enable
+var SupportedCapabilities = []string{CapJSON, CapServerTime, CapMessageID, CapDeflate, CapResume}
+
+// Capabilities returns the capabilities a connection can enable. deflate
+// compresses the raw byte stream, so it is only offered on stream transports
+// (plain TCP and TLS), not on message-framed ones such as WebSocket.
+func Capabilities(stream bool) []string {
+	caps := make([]string, 0, len(SupportedCapabilities))
+	for _, c := range SupportedCapabilities {
+		if c != CapDeflate || stream {
+			caps = append(caps, c)
+		}
+	}
+	return caps
+}
+
+// ParseCapabilityList parses a space separated capability list. A leading
+// ':' (IRCv3 style trailing parameter) is ignored.
+func ParseCapabilityList(list string) []string {
+	return strings.Fields(strings.TrimPrefix(strings.TrimSpace(list), ":"))
+}
+
+// FormatCapabilityReply formats a CAP reply line, e.g. "CAP * ACK :json msgid"
+func FormatCapabilityReply(subcommand string, caps []string) string {
+	sorted := append([]string(nil), caps...)
+	sort.Strings(sorted)
+	return fmt.Sprintf("CAP * %s :%s\n", subcommand, strings.Join(sorted, " "))
+}
+
+// FormatHello formats the server's HELLO reply listing the capabilities the
+// connection can enable
+func FormatHello(caps []string) string {
+	return fmt.Sprintf("HELLO %s %d :%s\n", ProtocolName, ProtocolVersion, strings.Join(caps, " "))
+}
+
+// FormatToken formats a TOKEN line handing the client a resume token. Clients
+// present it again with "RESUME <token>" before authenticating to restore
+// their session.
+func FormatToken(token string) string {
+	return fmt.Sprintf("TOKEN %s\n", token)
+}
+
+// FormatResumeFailure formats the reply to a RESUME that could not be honoured
+func FormatResumeFailure(reason string) string {
+	return fmt.Sprintf("RESUME FAIL :%s\n", reason)
+}
+
+// FormatTagged formats a text message prefixed with IRCv3 style message tags
+// for the enabled capabilities, e.g. "@time=...;msgid=123 [alice]: hi".
+// Messages from rooms other than currentRoom are labelled as by FormatFor.
+func (m *Message) FormatTagged(currentRoom string, serverTime, msgID bool) string {
+	tags := make([]string, 0, 2)
+	if serverTime {
+		tags = append(tags, "time="+m.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z"))
+	}
+	if msgID {
+		tags = append(tags, "msgid="+m.ID)
+	}
+	if len(tags) == 0 {
+		return m.FormatFor(currentRoom)
+	}
+	return "@" + strings.Join(tags, ";") + " " + m.FormatFor(currentRoom)
+}
@@ -1,6 +1,13 @@
 package protocol
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
 
 // MessageType represents the type of message
 type MessageType int
@@ -14,18 +21,156 @@ const (
 	MessageTypeError
 	// MessageTypeCommand represents command responses
 	MessageTypeCommand
+	// MessageTypePrivate represents private messages between two users
+	MessageTypePrivate
+)
+
+// messageTypeNames maps message types to their wire names
+var messageTypeNames = map[MessageType]string{
+	MessageTypeSystem:  "system",
+	MessageTypeChat:    "chat",
+	MessageTypeError:   "error",
+	MessageTypeCommand: "command",
+	MessageTypePrivate: "private",
+}
+
+// String returns the wire name of the message type
+func (t MessageType) String() string {
+	if name, ok := messageTypeNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the message type as its wire name
+func (t MessageType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a message type from its wire name
+func (t *MessageType) UnmarshalText(text []byte) error {
+	for mt, name := range messageTypeNames {
+		if name == string(text) {
+			*t = mt
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown message type %q", text)
+}
+
+// Encoding represents how messages are framed on the wire
+type Encoding int
+
+const (
+	// EncodingText is the human readable format used by telnet/nc users
+	EncodingText Encoding = iota
+	// EncodingJSON frames each message as a single JSON object per line
+	EncodingJSON
 )
 
+// ParseEncoding parses an encoding name ("text" or "json")
+func ParseEncoding(name string) (Encoding, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "text":
+		return EncodingText, nil
+	case "json":
+		return EncodingJSON, nil
+	default:
+		return EncodingText, fmt.Errorf("unknown format '%s' (expected text or json)", name)
+	}
+}
+
+// String returns the name of the encoding
+func (e Encoding) String() string {
+	if e == EncodingJSON {
+		return "json"
+	}
+	return "text"
+}
+
 // Message represents a formatted message
 type Message struct {
-	Type    MessageType
-	From    string
-	Content string
-	To      string // For private messages
+	ID        string      `json:"id"`
+	Type      MessageType `json:"type"`
+	From      string      `json:"from,omitempty"`
+	To        string      `json:"to,omitempty"` // For private messages
+	Room      string      `json:"room,omitempty"`
+	Content   string      `json:"content"`
+	Timestamp time.Time   `json:"ts"`
+	// Replay marks messages sent from history rather than live
+	Replay bool `json:"replay,omitempty"`
+	// Removed marks the notice telling a user that From took them out of
+	// Room (a kick, a ban or the room being closed)
+	Removed bool `json:"removed,omitempty"`
+}
+
+// lastID holds the most recently issued message ID
+var lastID atomic.Int64
+
+// NextID returns a new unique, monotonically increasing message ID
+func NextID() string {
+	for {
+		last := lastID.Load()
+		next := time.Now().UnixMicro()
+		if next <= last {
+			next = last + 1
+		}
+		if lastID.CompareAndSwap(last, next) {
+			return strconv.FormatInt(next, 10)
+		}
+	}
 }
 
-// Format formats a message for display to the client
+// newMessage creates a message stamped with an ID and server timestamp
+func newMessage(msgType MessageType, from, to, content string) *Message {
+	return &Message{
+		ID:        NextID(),
+		Type:      msgType,
+		From:      from,
+		To:        to,
+		Content:   content,
+		Timestamp: time.Now(),
+	}
+}
+
+// Replayed returns a copy of the message marked as replayed history
+func (m *Message) Replayed() *Message {
+	replayed := *m
+	replayed.Replay = true
+	return &replayed
+}
+
+// ShortTime formats the message's timestamp for display next to replayed
+// history: "15:04" for today, "Jan 02 15:04" otherwise
+func (m *Message) ShortTime() string {
+	ts := m.Timestamp.Local()
+	if y, mo, d := time.Now().Date(); ts.Year() == y && ts.Month() == mo && ts.Day() == d {
+		return ts.Format("15:04")
+	}
+	return ts.Format("Jan 02 15:04")
+}
+
+// Format formats a message for display to the client. Replayed history is
+// prefixed with its time.
 func (m *Message) Format() string {
+	if m.Replay {
+		return fmt.Sprintf("[%s] %s", m.ShortTime(), m.format())
+	}
+	return m.format()
+}
+
+// FormatFor formats a message for a client whose current room is
+// currentRoom. Messages from its other rooms are prefixed with the room
+// name, e.g. "[#ops] [alice]: hi".
+func (m *Message) FormatFor(currentRoom string) string {
+	if m.Room != "" && m.Room != currentRoom {
+		return fmt.Sprintf("[%s] %s", m.Room, m.Format())
+	}
+	return m.Format()
+}
+
+// format formats a message without the replay prefix
+func (m *Message) format() string {
 	switch m.Type {
 	case MessageTypeSystem:
 		return fmt.Sprintf("*** %s ***\n", m.Content)
@@ -34,6 +179,8 @@ func (m *Message) Format() string {
 			return fmt.Sprintf("[%s]: %s\n", m.From, m.Content)
 		}
 		return fmt.Sprintf("%s\n", m.Content)
+	case MessageTypePrivate:
+		return fmt.Sprintf("[%s]: [PM] %s\n", m.From, m.Content)
 	case MessageTypeError:
 		return fmt.Sprintf("ERROR: %s\n", m.Content)
 	case MessageTypeCommand:
@@ -43,47 +190,56 @@ func (m *Message) Format() string {
 	}
 }
 
+// FormatJSON formats a message as a single line JSON frame
+func (m *Message) FormatJSON() string {
+	data, err := json.Marshal(m)
+	if err != nil {
+		// Message only contains plain fields, so this should never happen
+		return fmt.Sprintf("{\"type\":\"error\",\"content\":%q}\n", err.Error())
+	}
+	return string(data) + "\n"
+}
+
+// Encode formats a message using the given wire encoding
+func (m *Message) Encode(enc Encoding) string {
+	if enc == EncodingJSON {
+		return m.FormatJSON()
+	}
+	return m.Format()
+}
+
+// Decode parses a JSON frame produced by FormatJSON
+func Decode(line string) (*Message, error) {
+	var msg Message
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &msg); err != nil {
+		return nil, fmt.Errorf("invalid frame: %w", err)
+	}
+	return &msg, nil
+}
+
 // NewSystemMessage creates a new system message
 func NewSystemMessage(content string) *Message {
-	return &Message{
-		Type:    MessageTypeSystem,
-		Content: content,
-	}
+	return newMessage(MessageTypeSystem, "", "", content)
 }
 
 // NewChatMessage creates a new chat message
 func NewChatMessage(from, content string) *Message {
-	return &Message{
-		Type:    MessageTypeChat,
-		From:    from,
-		Content: content,
-	}
+	return newMessage(MessageTypeChat, from, "", content)
 }
 
 // NewPrivateMessage creates a new private message
 func NewPrivateMessage(from, to, content string) *Message {
-	return &Message{
-		Type:    MessageTypeChat,
-		From:    from,
-		To:      to,
-		Content: content,
-	}
+	return newMessage(MessageTypePrivate, from, to, content)
 }
 
 // NewErrorMessage creates a new error message
 func NewErrorMessage(content string) *Message {
-	return &Message{
-		Type:    MessageTypeError,
-		Content: content,
-	}
+	return newMessage(MessageTypeError, "", "", content)
 }
 
 // NewCommandMessage creates a new command response message
 func NewCommandMessage(content string) *Message {
-	return &Message{
-		Type:    MessageTypeCommand,
-		Content: content,
-	}
+	return newMessage(MessageTypeCommand, "", "", content)
 }
 
 // Protocol constants
@@ -0,0 +1,143 @@
+package room
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// accessSettings restricts who may join a room. The room's owner,
+// moderators and invited users may always join.
+type accessSettings struct {
+	inviteOnly bool
+	hidden     bool     // left out of room lists for users who aren't in it
+	keyHash    string   // bcrypt hash of the room key, empty for none
+	allowList  []string // usernames, emails or @domains; empty allows everyone
+	invited    []string
+}
+
+// Access describes a room's access settings for display
+type Access struct {
+	InviteOnly bool
+	Hidden     bool
+	Keyed      bool
+	AllowList  []string
+	Invited    []string
+}
+
+// GetAccess returns the room's access settings
+func (r *Room) GetAccess() Access {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return Access{
+		InviteOnly: r.access.inviteOnly,
+		Hidden:     r.access.hidden,
+		Keyed:      r.access.keyHash != "",
+		AllowList:  append([]string(nil), r.access.allowList...),
+		Invited:    append([]string(nil), r.access.invited...),
+	}
+}
+
+// CheckAccess returns why a user may not join the room, or nil if they may.
+// key is the room key the user supplied, if any. Group conversations are
+// limited to their participants; in other rooms moderators, the owner and
+// invited users skip every check.
+func (r *Room) CheckAccess(username, email, key string) error {
+	r.mu.RLock()
+	if r.Type == TypeGroup {
+		defer r.mu.RUnlock()
+		if !r.isParticipant(username) {
+			return fmt.Errorf("you are not a participant")
+		}
+		return nil
+	}
+	if r.roleOf(username) >= RoleModerator || r.isInvited(username) {
+		r.mu.RUnlock()
+		return nil
+	}
+	settings := r.access
+	r.mu.RUnlock()
+
+	if settings.inviteOnly {
+		return fmt.Errorf("it is invite-only")
+	}
+	if len(settings.allowList) > 0 && !allowListed(settings.allowList, username, email) {
+		return fmt.Errorf("it is restricted to an allow-list")
+	}
+	if settings.keyHash != "" {
+		if key == "" {
+			return fmt.Errorf("it requires a key")
+		}
+		// Compare outside the lock; bcrypt is slow on purpose
+		if bcrypt.CompareHashAndPassword([]byte(settings.keyHash), []byte(key)) != nil {
+			return fmt.Errorf("wrong key")
+		}
+	}
+	return nil
+}
+
+// CanJoin reports whether a user, connecting from ip, may join the room
+// without a key: they are not banned from it and its access settings let
+// them in
+func (r *Room) CanJoin(username, email, ip string) bool {
+	if _, banned := r.BanFor(username, email, ip); banned {
+		return false
+	}
+	return r.CheckAccess(username, email, "") == nil
+}
+
+// VisibleTo reports whether a room shows up in a user's room lists. Hidden
+// rooms are only listed to their moderators, owner, invited users and
+// members.
+func (r *Room) VisibleTo(username string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if !r.access.hidden || r.roleOf(username) >= RoleModerator || r.isInvited(username) {
+		return true
+	}
+	_, member := r.members[username]
+	return member
+}
+
+// isInvited reports whether a user was invited to the room. The caller must
+// hold the lock.
+func (r *Room) isInvited(username string) bool {
+	return slices.ContainsFunc(r.access.invited, func(invited string) bool {
+		return strings.EqualFold(invited, username)
+	})
+}
+
+// allowListed reports whether a user matches an allow-list entry: their
+// username, their email, or their email's @domain
+func allowListed(allowList []string, username, email string) bool {
+	_, domain, _ := strings.Cut(email, "@")
+	for _, entry := range allowList {
+		switch {
+		case strings.HasPrefix(entry, "@"):
+			if domain != "" && strings.EqualFold(entry[1:], domain) {
+				return true
+			}
+		case strings.Contains(entry, "@"):
+			if email != "" && strings.EqualFold(entry, email) {
+				return true
+			}
+		default:
+			if strings.EqualFold(entry, username) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HashKey hashes a room key for storage
+func HashKey(key string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(key), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash room key: %w", err)
+	}
+	return string(hash), nil
+}
@@ -0,0 +1,124 @@
+package room
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/storage"
+)
+
+// newTestRoom returns a private room owned by alice, with bob as moderator
+// and carol invited
+func newTestRoom(t *testing.T, access accessSettings) *Room {
+	t.Helper()
+	r := NewRoom("#r", TypePrivate, storage.NewMemoryStore())
+	r.owner = "alice"
+	r.roles["bob"] = RoleModerator
+	r.roles["gus"] = RoleGuest
+	access.invited = append(access.invited, "Carol")
+	r.access = access
+	return r
+}
+
+func TestCheckAccess(t *testing.T) {
+	keyHash, err := HashKey("sesame")
+	if err != nil {
+		t.Fatalf("HashKey: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		access   accessSettings
+		username string
+		email    string
+		key      string
+		wantErr  string
+	}{
+		{name: "open room", username: "dave"},
+		{name: "guest in open room", username: "gus"},
+		{name: "invite-only", access: accessSettings{inviteOnly: true}, username: "dave", wantErr: "it is invite-only"},
+		{name: "invite-only guest", access: accessSettings{inviteOnly: true}, username: "gus", wantErr: "it is invite-only"},
+		{name: "invite-only owner", access: accessSettings{inviteOnly: true}, username: "ALICE"},
+		{name: "invite-only moderator", access: accessSettings{inviteOnly: true}, username: "bob"},
+		{name: "invite-only invited", access: accessSettings{inviteOnly: true}, username: "carol"},
+		{name: "allow-list username", access: accessSettings{allowList: []string{"Dave"}}, username: "dave"},
+		{name: "allow-list email", access: accessSettings{allowList: []string{"dave@example.com"}}, username: "dave", email: "Dave@Example.com"},
+		{name: "allow-list domain", access: accessSettings{allowList: []string{"@example.com"}}, username: "dave", email: "dave@example.com"},
+		{name: "allow-list other domain", access: accessSettings{allowList: []string{"@example.com"}}, username: "dave", email: "dave@example.org", wantErr: "it is restricted to an allow-list"},
+		{name: "allow-list domain without email", access: accessSettings{allowList: []string{"@example.com"}}, username: "dave", wantErr: "it is restricted to an allow-list"},
+		{name: "allow-list email is not a username", access: accessSettings{allowList: []string{"dave@example.com"}}, username: "dave", email: "eve@example.com", wantErr: "it is restricted to an allow-list"},
+		{name: "allow-list moderator", access: accessSettings{allowList: []string{"eve"}}, username: "bob"},
+		{name: "key missing", access: accessSettings{keyHash: keyHash}, username: "dave", wantErr: "it requires a key"},
+		{name: "key wrong", access: accessSettings{keyHash: keyHash}, username: "dave", key: "open", wantErr: "wrong key"},
+		{name: "key right", access: accessSettings{keyHash: keyHash}, username: "dave", key: "sesame"},
+		{name: "key invited", access: accessSettings{keyHash: keyHash}, username: "carol"},
+		{name: "allow-list before key", access: accessSettings{keyHash: keyHash, allowList: []string{"eve"}}, username: "dave", key: "sesame", wantErr: "it is restricted to an allow-list"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRoom(t, tt.access)
+			err := r.CheckAccess(tt.username, tt.email, tt.key)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("CheckAccess(%q) = %v, want nil", tt.username, err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Errorf("CheckAccess(%q) = %v, want %s", tt.username, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckAccessGroup(t *testing.T) {
+	r := NewRoom(GroupPrefix+"1", TypeGroup, storage.NewMemoryStore())
+	r.participants = []string{"alice", "bob"}
+
+	tests := []struct {
+		username string
+		allowed  bool
+	}{
+		{"alice", true},
+		{"BOB", true},
+		{"carol", false},
+	}
+
+	for _, tt := range tests {
+		err := r.CheckAccess(tt.username, "", "")
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("CheckAccess(%q) = %v, want allowed %v", tt.username, err, tt.allowed)
+		}
+	}
+}
+
+func TestCanJoin(t *testing.T) {
+	tests := []struct {
+		name     string
+		access   accessSettings
+		ban      *storage.Ban
+		username string
+		email    string
+		ip       string
+		want     bool
+	}{
+		{name: "open room", username: "dave", want: true},
+		{name: "invite-only", access: accessSettings{inviteOnly: true}, username: "dave"},
+		{name: "keyed", access: accessSettings{keyHash: "x"}, username: "dave"},
+		{name: "banned", ban: &storage.Ban{Target: "dave"}, username: "dave"},
+		{name: "banned by email", ban: &storage.Ban{Target: "dave@example.com"}, username: "dave", email: "dave@example.com"},
+		{name: "banned by IP", ban: &storage.Ban{Target: "192.0.2.7"}, username: "dave", ip: "192.0.2.7"},
+		{name: "banned invited user", ban: &storage.Ban{Target: "carol"}, username: "carol"},
+		{name: "expired ban", ban: &storage.Ban{Target: "dave", Until: time.Now().Add(-time.Minute)}, username: "dave", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRoom(t, tt.access)
+			if tt.ban != nil {
+				r.moderation.bans = []storage.Ban{*tt.ban}
+			}
+			if got := r.CanJoin(tt.username, tt.email, tt.ip); got != tt.want {
+				t.Errorf("CanJoin(%q, %q, %q) = %v, want %v", tt.username, tt.email, tt.ip, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,29 +1,66 @@
 package room
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/mullayam/go-tcp-chat/internal/protocol"
 	"github.com/mullayam/go-tcp-chat/internal/session"
+	"github.com/mullayam/go-tcp-chat/internal/storage"
 )
 
+// retentionInterval is how often history retention is enforced
+const retentionInterval = 10 * time.Minute
+
 // Manager manages all chat rooms
 type Manager struct {
-	rooms map[string]*Room
-	mu    sync.RWMutex
+	rooms            map[string]*Room
+	store            storage.Store
+	defaultRetention storage.Retention
+	defaultReplay    storage.Replay
+	mu               sync.RWMutex
 }
 
-// NewManager creates a new room manager
-func NewManager() *Manager {
+// NewManager creates a new room manager, restoring the rooms kept in store.
+// Rooms without their own retention or replay policy use defaultRetention
+// and defaultReplay.
+func NewManager(store storage.Store, defaultRetention storage.Retention, defaultReplay storage.Replay) (*Manager, error) {
 	m := &Manager{
-		rooms: make(map[string]*Room),
+		rooms:            make(map[string]*Room),
+		store:            store,
+		defaultRetention: defaultRetention,
+		defaultReplay:    defaultReplay,
+	}
+
+	saved, err := store.ListRooms()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rooms: %w", err)
+	}
+	for _, info := range saved {
+		m.rooms[info.Name] = newRoomFromInfo(info, store)
 	}
 
 	// Create default public room
-	m.rooms[protocol.DefaultRoom] = NewRoom(protocol.DefaultRoom, TypePublic)
+	if _, exists := m.rooms[protocol.DefaultRoom]; !exists {
+		room := NewRoom(protocol.DefaultRoom, TypePublic, store)
+		if err := store.SaveRoom(room.Info()); err != nil {
+			return nil, fmt.Errorf("failed to create default room: %w", err)
+		}
+		m.rooms[protocol.DefaultRoom] = room
+	}
 
-	return m
+	// Start retention goroutine
+	go m.enforceRetention()
+
+	return m, nil
 }
 
 // GetRoom retrieves a room by name
@@ -34,53 +71,538 @@ func (m *Manager) GetRoom(name string) (*Room, bool) {
 	return room, exists
 }
 
-// CreateRoom creates a new private room
-func (m *Manager) CreateRoom(name string) (*Room, error) {
+// CreateRoom creates a new private room, or returns the existing one. Group
+// conversations are only created by CreateGroup.
+func (m *Manager) CreateRoom(name, creator string) (*Room, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if _, exists := m.rooms[name]; exists {
 		return m.rooms[name], nil
 	}
+	if strings.HasPrefix(name, GroupPrefix) {
+		return nil, fmt.Errorf("group conversation '%s' does not exist", name)
+	}
+
+	room := NewRoom(name, TypePrivate, m.store)
+	room.CreatedBy = creator
+	room.owner = creator
+	if err := m.store.SaveRoom(room.Info()); err != nil {
+		return nil, fmt.Errorf("failed to create room: %w", err)
+	}
 
-	room := NewRoom(name, TypePrivate)
 	m.rooms[name] = room
 	return room, nil
 }
 
-// JoinRoom adds a user to a room
-func (m *Manager) JoinRoom(roomName string, session *session.Session) error {
-	room, exists := m.GetRoom(roomName)
-	if !exists {
-		return fmt.Errorf("room '%s' does not exist", roomName)
+// CreateGroup creates a group conversation between the creator and the given
+// users, or returns the existing group with exactly those participants. It
+// reports whether the group is new.
+func (m *Manager) CreateGroup(creator string, usernames []string) (*Room, bool, error) {
+	participants := []string{creator}
+	for _, username := range usernames {
+		if !slices.ContainsFunc(participants, func(p string) bool { return strings.EqualFold(p, username) }) {
+			participants = append(participants, username)
+		}
+	}
+	if len(participants) < 2 {
+		return nil, false, fmt.Errorf("a group conversation needs at least one other participant")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, room := range m.rooms {
+		if room.Type == TypeGroup && sameParticipants(room.GetParticipants(), participants) {
+			return room, false, nil
+		}
+	}
+
+	name, err := m.newGroupName()
+	if err != nil {
+		return nil, false, err
+	}
+	room := NewRoom(name, TypeGroup, m.store)
+	room.CreatedBy = creator
+	room.owner = creator
+	room.participants = participants
+	if err := m.store.SaveRoom(room.Info()); err != nil {
+		return nil, false, fmt.Errorf("failed to create group conversation: %w", err)
+	}
+
+	m.rooms[name] = room
+	return room, true, nil
+}
+
+// AddParticipant adds a user to a group conversation
+func (m *Manager) AddParticipant(room *Room, username string) error {
+	room.mu.Lock()
+	if room.isParticipant(username) {
+		room.mu.Unlock()
+		return fmt.Errorf("%s is already in this conversation", username)
+	}
+	previous := room.participants
+	room.participants = append(slices.Clip(previous), username)
+	room.mu.Unlock()
+
+	if err := m.store.SaveRoom(room.Info()); err != nil {
+		room.mu.Lock()
+		room.participants = previous
+		room.mu.Unlock()
+		return fmt.Errorf("failed to save room: %w", err)
+	}
+	return nil
+}
+
+// GetGroups returns the group conversations a user participates in, sorted
+// by name
+func (m *Manager) GetGroups(username string) []*Room {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	groups := make([]*Room, 0)
+	for _, room := range m.rooms {
+		if room.Type == TypeGroup && room.IsParticipant(username) {
+			groups = append(groups, room)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// newGroupName returns an unused random group conversation name such as
+// "&3fa9c1". The caller must hold the lock.
+func (m *Manager) newGroupName() (string, error) {
+	for {
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", fmt.Errorf("failed to generate group name: %w", err)
+		}
+		name := GroupPrefix + hex.EncodeToString(suffix)
+		if _, exists := m.rooms[name]; !exists {
+			return name, nil
+		}
+	}
+}
+
+// sameParticipants reports whether two participant lists hold the same users
+func sameParticipants(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, username := range a {
+		if !slices.ContainsFunc(b, func(p string) bool { return strings.EqualFold(p, username) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetRetention sets a room's history retention policy (nil restores the
+// server default) and applies it right away
+func (m *Manager) SetRetention(room *Room, retention *storage.Retention) error {
+	room.mu.Lock()
+	previous := room.retention
+	room.retention = retention
+	room.mu.Unlock()
+
+	if err := m.store.SaveRoom(room.Info()); err != nil {
+		room.mu.Lock()
+		room.retention = previous
+		room.mu.Unlock()
+		return fmt.Errorf("failed to save room: %w", err)
+	}
+
+	m.pruneRoom(room)
+	return nil
+}
+
+// SetReplay sets the history replayed to members joining a room (nil
+// restores the server default)
+func (m *Manager) SetReplay(room *Room, replay *storage.Replay) error {
+	room.mu.Lock()
+	previous := room.replay
+	room.replay = replay
+	room.mu.Unlock()
+
+	if err := m.store.SaveRoom(room.Info()); err != nil {
+		room.mu.Lock()
+		room.replay = previous
+		room.mu.Unlock()
+		return fmt.Errorf("failed to save room: %w", err)
+	}
+	return nil
+}
+
+// SetTopic sets a room's topic (empty text clears it)
+func (m *Manager) SetTopic(room *Room, text, setBy string) error {
+	room.mu.Lock()
+	previous := room.topic
+	room.topic = Topic{Text: text, SetBy: setBy, SetAt: time.Now()}
+	if text == "" {
+		room.topic = Topic{}
+	}
+	room.mu.Unlock()
+
+	if err := m.store.SaveRoom(room.Info()); err != nil {
+		room.mu.Lock()
+		room.topic = previous
+		room.mu.Unlock()
+		return fmt.Errorf("failed to save room: %w", err)
+	}
+	return nil
+}
+
+// SetDescription sets a room's description (empty text clears it)
+func (m *Manager) SetDescription(room *Room, description string) error {
+	room.mu.Lock()
+	previous := room.description
+	room.description = description
+	room.mu.Unlock()
+
+	if err := m.store.SaveRoom(room.Info()); err != nil {
+		room.mu.Lock()
+		room.description = previous
+		room.mu.Unlock()
+		return fmt.Errorf("failed to save room: %w", err)
+	}
+	return nil
+}
+
+// SetTags sets a room's tags (nil clears them)
+func (m *Manager) SetTags(room *Room, tags []string) error {
+	room.mu.Lock()
+	previous := room.tags
+	room.tags = tags
+	room.mu.Unlock()
+
+	if err := m.store.SaveRoom(room.Info()); err != nil {
+		room.mu.Lock()
+		room.tags = previous
+		room.mu.Unlock()
+		return fmt.Errorf("failed to save room: %w", err)
+	}
+	return nil
+}
+
+// SetRole gives a user a role other than owner in a room
+func (m *Manager) SetRole(room *Room, username string, role Role) error {
+	if role == RoleOwner {
+		return fmt.Errorf("ownership can only be transferred")
+	}
+
+	room.mu.Lock()
+	if strings.EqualFold(room.owner, username) {
+		room.mu.Unlock()
+		return fmt.Errorf("%s owns %s; transfer the ownership first", username, room.Name)
+	}
+	key := strings.ToLower(username)
+	previous, had := room.roles[key]
+	if role == RoleMember {
+		delete(room.roles, key)
+	} else {
+		room.roles[key] = role
 	}
+	room.mu.Unlock()
 
-	room.AddMember(session)
-	session.SetCurrentRoom(roomName)
+	if err := m.store.SaveRoom(room.Info()); err != nil {
+		room.mu.Lock()
+		if had {
+			room.roles[key] = previous
+		} else {
+			delete(room.roles, key)
+		}
+		room.mu.Unlock()
+		return fmt.Errorf("failed to save room: %w", err)
+	}
 	return nil
 }
 
-// LeaveRoom removes a user from a room
-func (m *Manager) LeaveRoom(session *session.Session) {
-	currentRoom := session.GetCurrentRoom()
-	if currentRoom == "" {
+// TransferOwnership makes another user the owner of a room. The previous
+// owner stays on as a moderator.
+func (m *Manager) TransferOwnership(room *Room, username string) error {
+	room.mu.Lock()
+	previousOwner := room.owner
+	previousRoles := maps.Clone(room.roles)
+	room.owner = username
+	delete(room.roles, strings.ToLower(username))
+	if previousOwner != "" {
+		room.roles[strings.ToLower(previousOwner)] = RoleModerator
+	}
+	room.mu.Unlock()
+
+	if err := m.store.SaveRoom(room.Info()); err != nil {
+		room.mu.Lock()
+		room.owner = previousOwner
+		room.roles = previousRoles
+		room.mu.Unlock()
+		return fmt.Errorf("failed to save room: %w", err)
+	}
+	return nil
+}
+
+// updateAccess changes a room's access settings and saves them, restoring
+// the previous settings if they can't be saved
+func (m *Manager) updateAccess(room *Room, update func(settings *accessSettings)) error {
+	room.mu.Lock()
+	previous := room.access
+	update(&room.access)
+	room.mu.Unlock()
+
+	if err := m.store.SaveRoom(room.Info()); err != nil {
+		room.mu.Lock()
+		room.access = previous
+		room.mu.Unlock()
+		return fmt.Errorf("failed to save room: %w", err)
+	}
+	return nil
+}
+
+// SetInviteOnly limits a room to its owner, moderators and invited users
+func (m *Manager) SetInviteOnly(room *Room, inviteOnly bool) error {
+	return m.updateAccess(room, func(settings *accessSettings) {
+		settings.inviteOnly = inviteOnly
+	})
+}
+
+// SetHidden leaves a room out of the room lists of users who aren't in it
+func (m *Manager) SetHidden(room *Room, hidden bool) error {
+	return m.updateAccess(room, func(settings *accessSettings) {
+		settings.hidden = hidden
+	})
+}
+
+// SetKey sets the key users must give to join a room (empty removes it)
+func (m *Manager) SetKey(room *Room, key string) error {
+	hash := ""
+	if key != "" {
+		var err error
+		if hash, err = HashKey(key); err != nil {
+			return err
+		}
+	}
+	return m.updateAccess(room, func(settings *accessSettings) {
+		settings.keyHash = hash
+	})
+}
+
+// SetAllowList limits a room to the users matching an entry: a username,
+// an email or an @domain (nil allows everyone)
+func (m *Manager) SetAllowList(room *Room, allowList []string) error {
+	return m.updateAccess(room, func(settings *accessSettings) {
+		settings.allowList = allowList
+	})
+}
+
+// Invite lets a user join a room regardless of its other access settings
+func (m *Manager) Invite(room *Room, username string) error {
+	return m.updateAccess(room, func(settings *accessSettings) {
+		if !slices.ContainsFunc(settings.invited, func(invited string) bool { return strings.EqualFold(invited, username) }) {
+			settings.invited = append(slices.Clone(settings.invited), username)
+		}
+	})
+}
+
+// Uninvite withdraws a user's invitation to a room. It reports whether the
+// user was invited.
+func (m *Manager) Uninvite(room *Room, username string) (bool, error) {
+	found := false
+	err := m.updateAccess(room, func(settings *accessSettings) {
+		settings.invited = slices.DeleteFunc(slices.Clone(settings.invited), func(invited string) bool {
+			if strings.EqualFold(invited, username) {
+				found = true
+				return true
+			}
+			return false
+		})
+	})
+	return found, err
+}
+
+// DefaultReplay returns the server's default replay policy
+func (m *Manager) DefaultReplay() storage.Replay {
+	return m.defaultReplay
+}
+
+// EffectiveReplay returns the replay policy that applies to a room
+func (m *Manager) EffectiveReplay(room *Room) storage.Replay {
+	if replay := room.GetReplay(); replay != nil {
+		return *replay
+	}
+	return m.defaultReplay
+}
+
+// EffectiveRetention returns the retention policy that applies to a room
+func (m *Manager) EffectiveRetention(room *Room) storage.Retention {
+	if retention := room.GetRetention(); retention != nil {
+		return *retention
+	}
+	return m.defaultRetention
+}
+
+// enforceRetention periodically prunes history according to each room's
+// retention policy
+func (m *Manager) enforceRetention() {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		m.mu.RLock()
+		rooms := make([]*Room, 0, len(m.rooms))
+		for _, room := range m.rooms {
+			rooms = append(rooms, room)
+		}
+		m.mu.RUnlock()
+
+		for _, room := range rooms {
+			m.pruneRoom(room)
+		}
+		<-ticker.C
+	}
+}
+
+// pruneRoom deletes history that falls outside a room's retention policy
+func (m *Manager) pruneRoom(room *Room) {
+	retention := m.EffectiveRetention(room)
+	if retention.Forever() {
 		return
 	}
 
-	room, exists := m.GetRoom(currentRoom)
+	var olderThan time.Time
+	if retention.MaxAge > 0 {
+		olderThan = time.Now().Add(-retention.MaxAge)
+	}
+	deleted, err := m.store.PruneMessages(room.Name, retention.MaxMessages, olderThan)
+	if err != nil {
+		log.Printf("Failed to prune history of %s: %v", room.Name, err)
+	} else if deleted > 0 {
+		log.Printf("Pruned %d messages from %s (retention: %s)", deleted, room.Name, retention)
+	}
+}
+
+// JoinRoom adds a user to a room and makes it the session's current room,
+// enforcing the room's bans and access settings. key is the room key the
+// user gave, if any; replay overrides the room's replay policy when non-nil.
+func (m *Manager) JoinRoom(roomName string, session *session.Session, key string, replay *storage.Replay) error {
+	room, err := m.Admit(roomName, session, key)
+	if err != nil {
+		return err
+	}
+	return m.Enter(room, session, replay)
+}
+
+// Admit returns the room a user asked to join, or why they may not: the room
+// does not exist, they are banned from it or its access settings keep them
+// out. key is the room key the user gave, if any. Front-ends that must
+// announce the join before history is replayed call Admit and then Enter;
+// everyone else uses JoinRoom.
+func (m *Manager) Admit(roomName string, session *session.Session, key string) (*Room, error) {
+	room, exists := m.GetRoom(roomName)
+	if !exists {
+		return nil, fmt.Errorf("room '%s' does not exist", roomName)
+	}
+	if ban, banned := room.BanFor(session.GetUsername(), session.GetEmail(), session.IP); banned {
+		if ban.Until.IsZero() {
+			return nil, fmt.Errorf("you are banned from it")
+		}
+		return nil, fmt.Errorf("you are banned from it until %s", ban.Until.Local().Format("2006-01-02 15:04"))
+	}
+	if err := room.CheckAccess(session.GetUsername(), session.GetEmail(), key); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// Enter adds a user admitted by Admit to the room, makes it the session's
+// current room and replays history to it; replay overrides the room's replay
+// policy when non-nil
+func (m *Manager) Enter(room *Room, session *session.Session, replay *storage.Replay) error {
+	if replay == nil {
+		effective := m.EffectiveReplay(room)
+		replay = &effective
+	}
+
+	// Switch first so replayed history isn't labelled as another room's
+	previous := session.GetCurrentRoom()
+	session.AddRoom(room.Name)
+	session.SetCurrentRoom(room.Name)
+	if err := room.AddMember(session, *replay); err != nil {
+		session.RemoveRoom(room.Name)
+		session.SetCurrentRoom(previous)
+		return err
+	}
+	return nil
+}
+
+// LeaveRoom removes a user from one of its rooms. If it was the current
+// room, the most recently joined remaining room becomes current.
+func (m *Manager) LeaveRoom(session *session.Session, roomName string) {
+	session.RemoveRoom(roomName)
+
+	room, exists := m.GetRoom(roomName)
 	if !exists {
 		return
 	}
 
 	room.RemoveMember(session.GetUsername())
-	session.SetCurrentRoom("")
 
-	// Clean up empty private rooms (but not the default room)
-	if room.Type == TypePrivate && room.GetMemberCount() == 0 {
-		m.mu.Lock()
-		delete(m.rooms, currentRoom)
-		m.mu.Unlock()
+	// Clean up empty private rooms (but not the default room) unless the
+	// store keeps them across restarts. Rooms with bans, roles or settings
+	// stay, or anyone could take over a banned room once it emptied.
+	if room.Type != TypePrivate || m.store.Persistent() {
+		return
+	}
+	m.mu.Lock()
+	closed := m.rooms[roomName] == room && room.closeIfUnused()
+	if closed {
+		delete(m.rooms, roomName)
+	}
+	m.mu.Unlock()
+
+	if closed {
+		if err := m.store.DeleteRoom(roomName); err != nil {
+			log.Printf("Failed to delete room %s: %v", roomName, err)
+		}
+	}
+}
+
+// DestroyRoom deletes a room and its history. Its members should have been
+// removed first.
+func (m *Manager) DestroyRoom(name string) error {
+	if name == protocol.DefaultRoom {
+		return fmt.Errorf("the default room can't be destroyed")
+	}
+
+	m.mu.Lock()
+	room, exists := m.rooms[name]
+	if exists {
+		room.close()
+		delete(m.rooms, name)
+	}
+	m.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("room '%s' does not exist", name)
+	}
+
+	if err := m.store.DeleteRoom(name); err != nil {
+		return fmt.Errorf("failed to delete room: %w", err)
+	}
+	return nil
+}
+
+// Count returns the number of rooms and of group conversations
+func (m *Manager) Count() (rooms, groups int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, room := range m.rooms {
+		if room.Type == TypeGroup {
+			groups++
+		} else {
+			rooms++
+		}
 	}
+	return rooms, groups
 }
 
 // GetDefaultRoom returns the default public room
@@ -89,14 +611,17 @@ func (m *Manager) GetDefaultRoom() *Room {
 	return room
 }
 
-// GetAllRoomNames returns a list of all room names
+// GetAllRoomNames returns a list of all room names, leaving out group
+// conversations
 func (m *Manager) GetAllRoomNames() []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	names := make([]string, 0, len(m.rooms))
-	for name := range m.rooms {
-		names = append(names, name)
+	for name, room := range m.rooms {
+		if room.Type != TypeGroup {
+			names = append(names, name)
+		}
 	}
 	return names
 }
@@ -120,8 +645,11 @@ func (m *Manager) GetRoomInfo(roomName string) (string, int, bool) {
 	}
 
 	roomType := "public"
-	if room.Type == TypePrivate {
+	switch room.Type {
+	case TypePrivate:
 		roomType = "private"
+	case TypeGroup:
+		roomType = "group"
 	}
 
 	return roomType, room.GetMemberCount(), true
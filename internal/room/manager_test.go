@@ -0,0 +1,122 @@
+package room
+
+import (
+	"testing"
+
+	"github.com/mullayam/go-tcp-chat/internal/session"
+	"github.com/mullayam/go-tcp-chat/internal/storage"
+)
+
+// newTestManager returns a manager over an in-memory store that replays no
+// history, so sessions without a connection can join rooms
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m, err := NewManager(storage.NewMemoryStore(), storage.Retention{}, storage.Replay{})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return m
+}
+
+// newTestSession returns an authenticated session that is never written to
+func newTestSession(username, email, ip string) *session.Session {
+	sess := session.NewSession(nil, ip)
+	sess.SetUsername(username)
+	sess.SetEmail(email)
+	return sess
+}
+
+func TestJoinRoomEnforcesBansAndAccess(t *testing.T) {
+	m := newTestManager(t)
+	r, err := m.CreateRoom("#r", "alice")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+	if err := m.SetKey(r, "sesame"); err != nil {
+		t.Fatalf("SetKey: %v", err)
+	}
+	if err := m.Ban(r, storage.Ban{Target: "192.0.2.7", By: "alice"}); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		room    string
+		sess    *session.Session
+		key     string
+		wantErr string
+	}{
+		{name: "missing room", room: "#nope", sess: newTestSession("dave", "", ""), wantErr: "room '#nope' does not exist"},
+		{name: "no key", room: "#r", sess: newTestSession("dave", "", ""), wantErr: "it requires a key"},
+		{name: "right key", room: "#r", sess: newTestSession("dave", "", ""), key: "sesame"},
+		{name: "owner without key", room: "#r", sess: newTestSession("alice", "", "")},
+		{name: "banned IP with key", room: "#r", sess: newTestSession("eve", "", "192.0.2.7"), key: "sesame", wantErr: "you are banned from it"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := m.JoinRoom(tt.room, tt.sess, tt.key, nil)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("JoinRoom = %v, want %s", err, tt.wantErr)
+				}
+				if r.HasMember(tt.sess.GetUsername()) || tt.sess.GetCurrentRoom() == tt.room {
+					t.Error("a refused user was added to the room")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("JoinRoom = %v, want nil", err)
+			}
+			if !r.HasMember(tt.sess.GetUsername()) || tt.sess.GetCurrentRoom() != tt.room {
+				t.Error("the user was not added to the room")
+			}
+		})
+	}
+}
+
+func TestLeaveRoomKeepsRoomsWorthKeeping(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(m *Manager, r *Room) error
+		wantKept bool
+	}{
+		{name: "blank room", setup: func(m *Manager, r *Room) error { return nil }},
+		{name: "banned user", setup: func(m *Manager, r *Room) error {
+			return m.Ban(r, storage.Ban{Target: "mallory", By: "alice"})
+		}, wantKept: true},
+		{name: "invite-only", setup: func(m *Manager, r *Room) error {
+			return m.SetInviteOnly(r, true)
+		}, wantKept: true},
+		{name: "moderator", setup: func(m *Manager, r *Room) error {
+			return m.SetRole(r, "bob", RoleModerator)
+		}, wantKept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			r, err := m.CreateRoom("#r", "alice")
+			if err != nil {
+				t.Fatalf("CreateRoom: %v", err)
+			}
+			sess := newTestSession("alice", "", "")
+			if err := m.JoinRoom("#r", sess, "", nil); err != nil {
+				t.Fatalf("JoinRoom: %v", err)
+			}
+			if err := tt.setup(m, r); err != nil {
+				t.Fatalf("setup: %v", err)
+			}
+
+			m.LeaveRoom(sess, "#r")
+			if _, kept := m.GetRoom("#r"); kept != tt.wantKept {
+				t.Errorf("room kept = %v, want %v", kept, tt.wantKept)
+			}
+			if !tt.wantKept {
+				if err := r.AddMember(sess, storage.Replay{}); err == nil {
+					t.Error("AddMember succeeded on a deleted room")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package room
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/storage"
+)
+
+// moderation holds a room's bans and mutes
+type moderation struct {
+	bans  []storage.Ban
+	mutes []storage.RoomMute
+}
+
+// BanFor returns the active ban that keeps a user out of the room, if any
+func (r *Room) BanFor(username, email, ip string) (storage.Ban, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	for _, ban := range r.moderation.bans {
+		if ban.Active(now) && ban.Matches(username, email, ip) {
+			return ban, true
+		}
+	}
+	return storage.Ban{}, false
+}
+
+// GetBans returns the room's active bans, oldest first
+func (r *Room) GetBans() []storage.Ban {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	bans := make([]storage.Ban, 0, len(r.moderation.bans))
+	for _, ban := range r.moderation.bans {
+		if ban.Active(now) {
+			bans = append(bans, ban)
+		}
+	}
+	return bans
+}
+
+// MutedUntil reports whether a user is muted in the room and until when; a
+// zero time means until unmuted
+func (r *Room) MutedUntil(username string) (time.Time, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	for _, mute := range r.moderation.mutes {
+		if mute.Active(now) && strings.EqualFold(mute.Username, username) {
+			return mute.Until, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// updateModeration changes a room's bans and mutes, dropping expired ones,
+// and saves them, restoring the previous lists if they can't be saved
+func (m *Manager) updateModeration(room *Room, update func(mod *moderation)) error {
+	room.mu.Lock()
+	previous := room.moderation
+	now := time.Now()
+	mod := moderation{
+		bans: slices.DeleteFunc(slices.Clone(previous.bans), func(ban storage.Ban) bool {
+			return !ban.Active(now)
+		}),
+		mutes: slices.DeleteFunc(slices.Clone(previous.mutes), func(mute storage.RoomMute) bool {
+			return !mute.Active(now)
+		}),
+	}
+	update(&mod)
+	room.moderation = mod
+	room.mu.Unlock()
+
+	if err := m.store.SaveRoom(room.Info()); err != nil {
+		room.mu.Lock()
+		room.moderation = previous
+		room.mu.Unlock()
+		return fmt.Errorf("failed to save room: %w", err)
+	}
+	return nil
+}
+
+// Ban keeps the users matching a ban out of a room, replacing any ban of the
+// same target
+func (m *Manager) Ban(room *Room, ban storage.Ban) error {
+	return m.updateModeration(room, func(mod *moderation) {
+		mod.bans = slices.DeleteFunc(mod.bans, func(existing storage.Ban) bool {
+			return strings.EqualFold(existing.Target, ban.Target)
+		})
+		mod.bans = append(mod.bans, ban)
+	})
+}
+
+// Unban lifts the ban of a target from a room. It reports whether the target
+// was banned.
+func (m *Manager) Unban(room *Room, target string) (bool, error) {
+	found := false
+	err := m.updateModeration(room, func(mod *moderation) {
+		mod.bans = slices.DeleteFunc(mod.bans, func(ban storage.Ban) bool {
+			if strings.EqualFold(ban.Target, target) {
+				found = true
+				return true
+			}
+			return false
+		})
+	})
+	return found, err
+}
+
+// Mute stops a user from talking in a room, replacing any earlier mute
+func (m *Manager) Mute(room *Room, mute storage.RoomMute) error {
+	return m.updateModeration(room, func(mod *moderation) {
+		mod.mutes = slices.DeleteFunc(mod.mutes, func(existing storage.RoomMute) bool {
+			return strings.EqualFold(existing.Username, mute.Username)
+		})
+		mod.mutes = append(mod.mutes, mute)
+	})
+}
+
+// Unmute lets a muted user talk in a room again. It reports whether the user
+// was muted.
+func (m *Manager) Unmute(room *Room, username string) (bool, error) {
+	found := false
+	err := m.updateModeration(room, func(mod *moderation) {
+		mod.mutes = slices.DeleteFunc(mod.mutes, func(mute storage.RoomMute) bool {
+			if strings.EqualFold(mute.Username, username) {
+				found = true
+				return true
+			}
+			return false
+		})
+	})
+	return found, err
+}
@@ -0,0 +1,78 @@
+package room
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/storage"
+)
+
+func TestBanFor(t *testing.T) {
+	now := time.Now()
+	bans := []storage.Ban{
+		{Target: "Mallory", By: "alice", At: now},
+		{Target: "eve@example.com", By: "alice", At: now},
+		{Target: "192.0.2.7", By: "alice", At: now},
+		{Target: "trent", By: "alice", At: now.Add(-2 * time.Hour), Until: now.Add(-time.Hour)},
+		{Target: "oscar", By: "alice", At: now, Until: now.Add(time.Hour)},
+	}
+
+	tests := []struct {
+		name       string
+		username   string
+		email      string
+		ip         string
+		wantTarget string
+	}{
+		{name: "username", username: "mallory", wantTarget: "Mallory"},
+		{name: "email", username: "eve", email: "EVE@example.com", wantTarget: "eve@example.com"},
+		{name: "IP", username: "dave", ip: "192.0.2.7", wantTarget: "192.0.2.7"},
+		{name: "other IP", username: "dave", ip: "192.0.2.8"},
+		{name: "expired", username: "trent"},
+		{name: "temporary", username: "oscar", wantTarget: "oscar"},
+		{name: "not banned", username: "dave", email: "dave@example.com"},
+		{name: "empty email does not match", username: "dave", email: ""},
+	}
+
+	r := NewRoom("#r", TypePrivate, storage.NewMemoryStore())
+	r.moderation.bans = bans
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ban, banned := r.BanFor(tt.username, tt.email, tt.ip)
+			if banned != (tt.wantTarget != "") {
+				t.Fatalf("BanFor(%q, %q, %q) banned = %v, want %v", tt.username, tt.email, tt.ip, banned, tt.wantTarget != "")
+			}
+			if banned && ban.Target != tt.wantTarget {
+				t.Errorf("BanFor(%q) matched %q, want %q", tt.username, ban.Target, tt.wantTarget)
+			}
+		})
+	}
+}
+
+func TestBanReplacesAndUnban(t *testing.T) {
+	m := newTestManager(t)
+	r, err := m.CreateRoom("#r", "alice")
+	if err != nil {
+		t.Fatalf("CreateRoom: %v", err)
+	}
+
+	if err := m.Ban(r, storage.Ban{Target: "mallory", Until: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+	if err := m.Ban(r, storage.Ban{Target: "MALLORY"}); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+	if bans := r.GetBans(); len(bans) != 1 || !bans[0].Until.IsZero() {
+		t.Fatalf("GetBans = %+v, want one permanent ban", bans)
+	}
+
+	if found, err := m.Unban(r, "Mallory"); err != nil || !found {
+		t.Fatalf("Unban = %v, %v, want true", found, err)
+	}
+	if found, _ := m.Unban(r, "mallory"); found {
+		t.Error("Unban found a ban that was already lifted")
+	}
+	if _, banned := r.BanFor("mallory", "", ""); banned {
+		t.Error("mallory is still banned after Unban")
+	}
+}
@@ -0,0 +1,116 @@
+package room
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Role is a user's standing in a room. Higher roles may do everything lower
+// ones may.
+type Role int
+
+const (
+	// RoleGuest can chat but not invite anyone
+	RoleGuest Role = iota
+	// RoleMember is the role of everyone without another one
+	RoleMember
+	// RoleModerator can change the topic, invite to invite-only rooms and
+	// remove users
+	RoleModerator
+	// RoleOwner can change every setting of the room and appoint moderators.
+	// Each room has at most one owner.
+	RoleOwner
+)
+
+// String returns the role's name
+func (r Role) String() string {
+	switch r {
+	case RoleGuest:
+		return "guest"
+	case RoleModerator:
+		return "moderator"
+	case RoleOwner:
+		return "owner"
+	default:
+		return "member"
+	}
+}
+
+// ParseRole parses a role name. The owner role can't be granted, only
+// transferred, so it is not accepted.
+func ParseRole(name string) (Role, error) {
+	switch strings.ToLower(name) {
+	case "guest":
+		return RoleGuest, nil
+	case "member":
+		return RoleMember, nil
+	case "moderator", "mod", "op":
+		return RoleModerator, nil
+	}
+	return RoleMember, fmt.Errorf("unknown role '%s' (use moderator, member or guest)", name)
+}
+
+// GetOwner returns the room's owner, or "" if it has none
+func (r *Room) GetOwner() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.owner
+}
+
+// RoleOf returns a user's role in the room
+func (r *Room) RoleOf(username string) Role {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.roleOf(username)
+}
+
+// roleOf returns a user's role in the room. The caller must hold the lock.
+func (r *Room) roleOf(username string) Role {
+	if r.owner != "" && strings.EqualFold(r.owner, username) {
+		return RoleOwner
+	}
+	if role, ok := r.roles[strings.ToLower(username)]; ok {
+		return role
+	}
+	return RoleMember
+}
+
+// GetRoles returns the users with a role other than member, by lowercase
+// username, including the owner
+func (r *Room) GetRoles() map[string]Role {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	roles := make(map[string]Role, len(r.roles)+1)
+	for username, role := range r.roles {
+		roles[username] = role
+	}
+	if r.owner != "" {
+		roles[strings.ToLower(r.owner)] = RoleOwner
+	}
+	return roles
+}
+
+// rolesInfo returns the stored form of the room's roles. The caller must
+// hold the lock.
+func (r *Room) rolesInfo() map[string]string {
+	if len(r.roles) == 0 {
+		return nil
+	}
+	roles := make(map[string]string, len(r.roles))
+	for username, role := range r.roles {
+		roles[username] = role.String()
+	}
+	return roles
+}
+
+// restoreRoles restores roles from their stored form
+func restoreRoles(stored map[string]string) map[string]Role {
+	roles := make(map[string]Role, len(stored))
+	for username, name := range stored {
+		if role, err := ParseRole(name); err == nil && role != RoleMember {
+			roles[strings.ToLower(username)] = role
+		}
+	}
+	return roles
+}
@@ -1,11 +1,16 @@
 package room
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/mullayam/go-tcp-chat/internal/protocol"
 	"github.com/mullayam/go-tcp-chat/internal/session"
+	"github.com/mullayam/go-tcp-chat/internal/storage"
 )
 
 // Type represents the type of room
@@ -16,50 +21,261 @@ const (
 	TypePublic Type = iota
 	// TypePrivate represents a private room
 	TypePrivate
+	// TypeGroup represents an unlisted group conversation that only its
+	// participants can join
+	TypeGroup
 )
 
-// HistoryItem represents a stored message
-type HistoryItem struct {
-	Content   string
-	Timestamp time.Time
+// GroupPrefix starts the names of group conversations
+const GroupPrefix = "&"
+
+// Topic is a room's topic and who last set it
+type Topic struct {
+	Text  string
+	SetBy string
+	SetAt time.Time
 }
 
 // Room represents a chat room
 type Room struct {
-	Name    string
-	Type    Type
-	members map[string]*session.Session
-	history []HistoryItem // Store recent messages
-	mu      sync.RWMutex
+	Name      string
+	Type      Type
+	CreatedBy string
+	CreatedAt time.Time
+	members   map[string]*session.Session
+	history   storage.Store      // Message history backend
+	retention *storage.Retention // nil uses the server default
+	replay    *storage.Replay    // nil uses the server default
+
+	topic       Topic
+	description string
+	tags        []string
+	access      accessSettings
+	owner       string
+	roles       map[string]Role // key: lowercase username; members have no entry
+	moderation  moderation
+
+	participants []string // group conversations only
+	closed       bool     // dropped by the manager; nobody may join any more
+	mu           sync.RWMutex
+
+	// sendMu serialises storing and delivering messages, so members receive
+	// them in history order, and keeps joins from missing or repeating any
+	sendMu sync.Mutex
 }
 
-// NewRoom creates a new room
-func NewRoom(name string, roomType Type) *Room {
+// NewRoom creates a new room whose history is kept in the given store
+func NewRoom(name string, roomType Type, history storage.Store) *Room {
 	return &Room{
-		Name:    name,
-		Type:    roomType,
-		members: make(map[string]*session.Session),
-		history: make([]HistoryItem, 0),
+		Name:      name,
+		Type:      roomType,
+		CreatedAt: time.Now(),
+		members:   make(map[string]*session.Session),
+		roles:     make(map[string]Role),
+		history:   history,
 	}
 }
 
-// AddMember adds a member to the room and sends history
-func (r *Room) AddMember(session *session.Session) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// newRoomFromInfo restores a room from its stored description
+func newRoomFromInfo(info *storage.RoomInfo, history storage.Store) *Room {
+	roomType := TypePublic
+	switch {
+	case info.Group:
+		roomType = TypeGroup
+	case info.Private:
+		roomType = TypePrivate
+	}
+	r := NewRoom(info.Name, roomType, history)
+	r.participants = info.Participants
+	r.CreatedBy = info.CreatedBy
+	r.owner = info.Owner
+	if r.owner == "" {
+		r.owner = info.CreatedBy
+	}
+	r.roles = restoreRoles(info.Roles)
+	r.CreatedAt = info.CreatedAt
+	r.retention = info.Retention
+	r.replay = info.Replay
+	r.topic = Topic{Text: info.Topic, SetBy: info.TopicSetBy, SetAt: info.TopicSetAt}
+	r.description = info.Description
+	r.tags = info.Tags
+	r.access = accessSettings{
+		inviteOnly: info.InviteOnly,
+		hidden:     info.Hidden,
+		keyHash:    info.KeyHash,
+		allowList:  info.AllowList,
+		invited:    info.Invited,
+	}
+	r.moderation = moderation{bans: info.Bans, mutes: info.Mutes}
+	return r
+}
+
+// Info returns the room's description for storage
+func (r *Room) Info() *storage.RoomInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &storage.RoomInfo{
+		Name:         r.Name,
+		Private:      r.Type == TypePrivate,
+		Group:        r.Type == TypeGroup,
+		Participants: r.participants,
+		CreatedBy:    r.CreatedBy,
+		Owner:        r.owner,
+		Roles:        r.rolesInfo(),
+		CreatedAt:    r.CreatedAt,
+		Retention:    r.retention,
+		Replay:       r.replay,
+		Topic:        r.topic.Text,
+		TopicSetBy:   r.topic.SetBy,
+		TopicSetAt:   r.topic.SetAt,
+		Description:  r.description,
+		Tags:         r.tags,
+		InviteOnly:   r.access.inviteOnly,
+		Hidden:       r.access.hidden,
+		KeyHash:      r.access.keyHash,
+		AllowList:    r.access.allowList,
+		Invited:      r.access.invited,
+		Bans:         r.moderation.bans,
+		Mutes:        r.moderation.mutes,
+	}
+}
+
+// GetTopic returns the room's topic; its Text is empty if none is set
+func (r *Room) GetTopic() Topic {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.topic
+}
+
+// GetDescription returns the room's description
+func (r *Room) GetDescription() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.description
+}
+
+// GetTags returns the room's tags
+func (r *Room) GetTags() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.tags...)
+}
+
+// GetRetention returns the room's retention override, or nil if it uses the
+// server default
+func (r *Room) GetRetention() *storage.Retention {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.retention
+}
+
+// GetReplay returns the room's replay policy override, or nil if it uses the
+// server default
+func (r *Room) GetReplay() *storage.Replay {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.replay
+}
 
-	r.cleanupHistory() // Lazy cleanup before adding member
+// GetParticipants returns the participants of a group conversation
+func (r *Room) GetParticipants() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.participants...)
+}
 
-	// Replay history to the new member
-	if len(r.history) > 0 {
-		_ = session.Send(protocol.NewSystemMessage("--- History (last 5 min) ---").Format())
-		for _, item := range r.history {
-			_ = session.Send(item.Content)
+// IsParticipant reports whether a user belongs to a group conversation
+func (r *Room) IsParticipant(username string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.isParticipant(username)
+}
+
+// isParticipant reports whether a user belongs to a group conversation. The
+// caller must hold the lock.
+func (r *Room) isParticipant(username string) bool {
+	for _, participant := range r.participants {
+		if strings.EqualFold(participant, username) {
+			return true
 		}
-		_ = session.Send(protocol.NewSystemMessage("----------------------------").Format())
 	}
+	return false
+}
+
+// AddMember adds a member to the room and replays history to it according
+// to replay. No message is sent to the room in between, so the member sees
+// each message exactly once, after the replayed ones. It fails if the
+// manager closed the room meanwhile.
+func (r *Room) AddMember(session *session.Session, replay storage.Replay) error {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+
+	if r.isClosed() {
+		return errClosed
+	}
+	r.replayTo(session, replay)
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return errClosed
+	}
 	r.members[session.GetUsername()] = session
+	return nil
+}
+
+// errClosed is returned when joining a room the manager has dropped
+var errClosed = errors.New("the room was closed")
+
+// isClosed reports whether the manager dropped the room
+func (r *Room) isClosed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.closed
+}
+
+// close marks the room as dropped by the manager
+func (r *Room) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+}
+
+// closeIfUnused closes the room if it has no members and nothing worth
+// keeping: no roles, bans, mutes, access settings, topic, description, tags
+// or history policies. It reports whether the room was closed.
+func (r *Room) closeIfUnused() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.members) > 0 || len(r.roles) > 0 ||
+		len(r.moderation.bans) > 0 || len(r.moderation.mutes) > 0 ||
+		r.access.inviteOnly || r.access.hidden || r.access.keyHash != "" ||
+		len(r.access.allowList) > 0 || len(r.access.invited) > 0 ||
+		r.topic.Text != "" || r.description != "" || len(r.tags) > 0 ||
+		r.retention != nil || r.replay != nil {
+		return false
+	}
+	r.closed = true
+	return true
+}
+
+// replayTo sends the history selected by replay, marked as replayed
+func (r *Room) replayTo(session *session.Session, replay storage.Replay) {
+	history, err := replay.Load(r.history, r.Name)
+	if err != nil {
+		log.Printf("Failed to load history for %s: %v", r.Name, err)
+		return
+	}
+	if len(history) == 0 {
+		return
+	}
+
+	_ = session.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("--- History (%d messages) ---", len(history))))
+	for _, message := range history {
+		_ = session.SendMessage(message.Replayed())
+	}
+	_ = session.SendMessage(protocol.NewSystemMessage("--- End of history ---"))
 }
 
 // RemoveMember removes a member from the room
@@ -96,69 +312,43 @@ func (r *Room) GetMemberCount() int {
 	return len(r.members)
 }
 
-// Broadcast sends a message to all members in the room
+// Broadcast sends a message to all members in the room. Messages are
+// stored and delivered one at a time, so every member sees a room's messages
+// in history order with increasing IDs.
 func (r *Room) Broadcast(message *protocol.Message, excludeUsername string) {
-	r.mu.Lock() // Upgraded to Lock for history modification
-	defer r.mu.Unlock()
+	if message.Room == "" {
+		message.Room = r.Name
+	}
 
-	formattedMsg := message.Format()
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
 
-	// Store in history
-	r.addToHistory(formattedMsg)
+	// The message may have waited for the room; stamp it with its place
+	message.ID = protocol.NextID()
+
+	// Store in history outside the member lock so slow storage doesn't stall
+	// joins and leaves
+	r.addToHistory(message)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
 	for username, member := range r.members {
 		if username != excludeUsername {
-			_ = member.Send(formattedMsg)
+			_ = member.SendMessage(message)
 		}
 	}
 }
 
 // BroadcastToAll sends a message to all members including the sender
 func (r *Room) BroadcastToAll(message *protocol.Message) {
-	r.mu.Lock() // Upgraded to Lock for history modification
-	defer r.mu.Unlock()
-
-	formattedMsg := message.Format()
-
-	// Store in history
-	r.addToHistory(formattedMsg)
-
-	for _, member := range r.members {
-		_ = member.Send(formattedMsg)
-	}
+	r.Broadcast(message, "")
 }
 
-// addToHistory adds a message to history and performs cleanup
-func (r *Room) addToHistory(content string) {
-	r.history = append(r.history, HistoryItem{
-		Content:   content,
-		Timestamp: time.Now(),
-	})
-	r.cleanupHistory()
-}
-
-// cleanupHistory removes messages older than 5 minutes
-// Caller must hold the lock
-func (r *Room) cleanupHistory() {
-	cutoff := time.Now().Add(-5 * time.Minute)
-
-	if len(r.history) > 0 {
-		if r.history[len(r.history)-1].Timestamp.Before(cutoff) {
-			// All items are old so clear everything
-			r.history = make([]HistoryItem, 0)
-			return
-		}
-
-		if r.history[0].Timestamp.Before(cutoff) {
-			// Prune old messages
-			newHistory := make([]HistoryItem, 0, len(r.history))
-			for _, item := range r.history {
-				if item.Timestamp.After(cutoff) {
-					newHistory = append(newHistory, item)
-				}
-			}
-			r.history = newHistory
-		}
+// addToHistory stores a message in the room's history
+func (r *Room) addToHistory(message *protocol.Message) {
+	if err := r.history.AppendMessage(message); err != nil {
+		log.Printf("Failed to store message in %s: %v", r.Name, err)
 	}
 }
 
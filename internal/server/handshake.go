@@ -0,0 +1,169 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/mullayam/go-tcp-chat/internal/auth"
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+	"github.com/mullayam/go-tcp-chat/internal/session"
+)
+
+// resumedError interrupts the authentication flow when the client presented
+// a valid resume token
+type resumedError struct {
+	claims *auth.ResumeClaims
+}
+
+func (e *resumedError) Error() string {
+	return "session resumed"
+}
+
+// negotiate handles protocol negotiation lines. HELLO, CAP (modelled on
+// IRCv3 capability negotiation) and RESUME are only recognised before
+// authentication so they can never swallow chat text; /format is allowed at
+// any point of the connection. It reports whether the line was consumed; a
+// valid RESUME is reported as a *resumedError instead.
+//
+// Plain telnet clients never send any of these and see no difference.
+func (s *TCPServer) negotiate(sess *session.Session, line string) (bool, error) {
+	parts := strings.Fields(line)
+	if len(parts) == 0 {
+		return false, nil
+	}
+
+	if sess.GetState() != session.StateAuthenticated {
+		switch parts[0] {
+		case "HELLO":
+			s.handleHello(sess, parts)
+			return true, nil
+		case "CAP":
+			s.handleCap(sess, line, parts)
+			return true, nil
+		case "RESUME":
+			return true, s.handleResume(sess, parts)
+		}
+	}
+
+	if strings.ToLower(parts[0]) == "/format" {
+		s.handleFormat(sess, parts)
+		return true, nil
+	}
+	return false, nil
+}
+
+// handleHello answers a client HELLO with the protocol version and capabilities
+func (s *TCPServer) handleHello(sess *session.Session, parts []string) {
+	if len(parts) > 1 {
+		log.Printf("Client %s identified as %s", sess.IP, strings.Join(parts[1:], " "))
+	}
+	sess.Send(protocol.FormatHello(s.capabilities(sess)))
+}
+
+// capabilities returns the capabilities a session can enable: those its
+// transport can carry, without resume when the server issues no tokens
+func (s *TCPServer) capabilities(sess *session.Session) []string {
+	caps := protocol.Capabilities(sess.IsStream())
+	if s.tokens == nil {
+		caps = slices.DeleteFunc(caps, func(c string) bool { return c == protocol.CapResume })
+	}
+	return caps
+}
+
+// handleCap implements CAP LS, CAP LIST, CAP REQ and CAP END
+func (s *TCPServer) handleCap(sess *session.Session, line string, parts []string) {
+	if len(parts) < 2 {
+		sess.Send(protocol.FormatCapabilityReply("NAK", nil))
+		return
+	}
+
+	switch strings.ToUpper(parts[1]) {
+	case "LS":
+		sess.Send(protocol.FormatCapabilityReply("LS", s.capabilities(sess)))
+	case "LIST":
+		sess.Send(protocol.FormatCapabilityReply("LIST", sess.Capabilities()))
+	case "REQ":
+		// Everything after "CAP REQ" is the requested list
+		list := strings.TrimSpace(line[strings.Index(strings.ToUpper(line), "REQ")+3:])
+		s.handleCapReq(sess, protocol.ParseCapabilityList(list))
+	case "END":
+		// Negotiation never blocks the connection, so there is nothing to do
+	default:
+		sess.Send(protocol.FormatCapabilityReply("NAK", parts[1:]))
+	}
+}
+
+// handleCapReq applies a capability request atomically: either every
+// requested change is acknowledged or the whole request is rejected.
+// Capabilities the connection can't use (deflate on WebSocket, resume without
+// a token service) are rejected like unknown ones.
+func (s *TCPServer) handleCapReq(sess *session.Session, requested []string) {
+	if len(requested) == 0 {
+		sess.Send(protocol.FormatCapabilityReply("NAK", nil))
+		return
+	}
+
+	available := s.capabilities(sess)
+	for _, c := range requested {
+		name := strings.TrimPrefix(c, "-")
+		disable := name != c
+		if !slices.Contains(available, name) || (disable && name == protocol.CapDeflate) {
+			sess.Send(protocol.FormatCapabilityReply("NAK", requested))
+			return
+		}
+	}
+
+	// The acknowledgement itself must go out before compression starts
+	sess.Send(protocol.FormatCapabilityReply("ACK", requested))
+
+	for _, c := range requested {
+		name := strings.TrimPrefix(c, "-")
+		if name == protocol.CapDeflate {
+			if err := sess.EnableCompression(); err != nil {
+				log.Printf("Failed to enable compression for %s: %v", sess.IP, err)
+			}
+			continue
+		}
+		sess.SetCapability(name, name == c)
+	}
+}
+
+// handleResume verifies a resume token. Rejected tokens are answered with
+// RESUME FAIL and authentication carries on as normal.
+func (s *TCPServer) handleResume(sess *session.Session, parts []string) error {
+	if s.tokens == nil {
+		sess.Send(protocol.FormatResumeFailure("resume is not enabled"))
+		return nil
+	}
+	if len(parts) < 2 {
+		sess.Send(protocol.FormatResumeFailure("missing token"))
+		return nil
+	}
+
+	claims, err := s.tokens.Verify(parts[1])
+	if err != nil {
+		log.Printf("Rejected resume token from %s: %v", sess.IP, err)
+		sess.Send(protocol.FormatResumeFailure(err.Error()))
+		return nil
+	}
+	return &resumedError{claims: claims}
+}
+
+// handleFormat switches between the text and JSON wire formats
+func (s *TCPServer) handleFormat(sess *session.Session, parts []string) {
+	if len(parts) < 2 {
+		sess.SendMessage(protocol.NewCommandMessage(fmt.Sprintf("Current format: %s", sess.GetEncoding())))
+		return
+	}
+
+	enc, err := protocol.ParseEncoding(parts[1])
+	if err != nil {
+		sess.SendMessage(protocol.NewErrorMessage(err.Error()))
+		return
+	}
+
+	sess.SetEncoding(enc)
+	sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Format set to %s", enc)))
+}
@@ -0,0 +1,870 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/auth"
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+	"github.com/mullayam/go-tcp-chat/internal/room"
+	"github.com/mullayam/go-tcp-chat/internal/session"
+)
+
+// IRC numeric replies used by the front-end (RFC 2812)
+const (
+	rplWelcome          = "001"
+	rplYourHost         = "002"
+	rplCreated          = "003"
+	rplMyInfo           = "004"
+	rplListStart        = "321"
+	rplList             = "322"
+	rplListEnd          = "323"
+	rplChannelModeIs    = "324"
+	rplNoTopic          = "331"
+	rplTopic            = "332"
+	rplTopicWhoTime     = "333"
+	rplEndOfWho         = "315"
+	rplNamReply         = "353"
+	rplEndOfNames       = "366"
+	errNoSuchNick       = "401"
+	errNoSuchChannel    = "403"
+	errCannotSendToChan = "404"
+	errNoTextToSend     = "412"
+	errUnknownCommand   = "421"
+	errNoMotd           = "422"
+	errNoNicknameGiven  = "431"
+	errErroneusNickname = "432"
+	errNicknameInUse    = "433"
+	errNotOnChannel     = "442"
+	errNotRegistered    = "451"
+	errNeedMoreParams   = "461"
+	errAlreadyRegistred = "462"
+)
+
+// ircAuthTarget is the pseudo-user that authentication answers are sent to
+const ircAuthTarget = "*auth"
+
+// errIRCQuit is returned when the client sends QUIT
+var errIRCQuit = errors.New("irc client quit")
+
+// IRCServer is a front-end speaking a subset of RFC 1459/2812. IRC users are
+// mapped onto regular sessions, so they share rooms (channels), private
+// messages and usernames (nicks) with every other transport.
+type IRCServer struct {
+	port       string
+	serverName string
+	core       *TCPServer
+	tlsConfig  *tls.Config
+	listener   net.Listener
+	started    time.Time
+}
+
+// NewIRCServer creates a new IRC front-end backed by the TCP server's managers
+func NewIRCServer(port, serverName string, tlsConfig *tls.Config, core *TCPServer) *IRCServer {
+	return &IRCServer{
+		port:       port,
+		serverName: serverName,
+		core:       core,
+		tlsConfig:  tlsConfig,
+	}
+}
+
+// Start starts the IRC listener
+func (s *IRCServer) Start() error {
+	listener, err := net.Listen("tcp", ":"+s.port)
+	if err != nil {
+		return fmt.Errorf("failed to start IRC server: %w", err)
+	}
+
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+		log.Printf("IRC front-end started on port %s (TLS)", s.port)
+	} else {
+		log.Printf("IRC front-end started on port %s", s.port)
+	}
+	s.listener = listener
+	s.started = time.Now()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Printf("Failed to accept IRC connection: %v", err)
+			continue
+		}
+
+		go s.handleConnection(conn)
+	}
+}
+
+// Stop stops the IRC listener
+func (s *IRCServer) Stop() error {
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// ircMessage is a parsed IRC protocol line
+type ircMessage struct {
+	Command string
+	Params  []string
+}
+
+// param returns the i-th parameter or an empty string
+func (m *ircMessage) param(i int) string {
+	if i < len(m.Params) {
+		return m.Params[i]
+	}
+	return ""
+}
+
+// parseIRCLine parses "[:prefix] COMMAND [params] [:trailing]"
+func parseIRCLine(line string) *ircMessage {
+	line = strings.TrimRight(line, "\r\n")
+
+	// Drop message tags and the (client supplied, untrusted) prefix
+	if strings.HasPrefix(line, "@") {
+		if idx := strings.Index(line, " "); idx != -1 {
+			line = strings.TrimLeft(line[idx+1:], " ")
+		}
+	}
+	if strings.HasPrefix(line, ":") {
+		if idx := strings.Index(line, " "); idx != -1 {
+			line = strings.TrimLeft(line[idx+1:], " ")
+		} else {
+			return nil
+		}
+	}
+
+	var trailing *string
+	if idx := strings.Index(line, " :"); idx != -1 {
+		t := line[idx+2:]
+		trailing = &t
+		line = line[:idx]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	msg := &ircMessage{
+		Command: strings.ToUpper(fields[0]),
+		Params:  fields[1:],
+	}
+	if trailing != nil {
+		msg.Params = append(msg.Params, *trailing)
+	}
+	return msg
+}
+
+// ircClient holds the state of one IRC connection
+type ircClient struct {
+	srv  *IRCServer
+	sess *session.Session
+	nick string
+	user string
+	pass string
+}
+
+// handleConnection handles a new IRC connection
+func (s *IRCServer) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	ip := s.core.extractIP(conn.RemoteAddr().String())
+	log.Printf("New IRC connection from %s", ip)
+
+	peerEmail, err := verifiedEmail(conn)
+	if err != nil {
+		log.Printf("Rejected IRC connection from %s: %v", ip, err)
+		return
+	}
+
+	if err := s.core.checkBan("", "", ip); err != nil {
+		fmt.Fprintf(conn, "ERROR :%s\r\n", err.Error())
+		log.Printf("Rejected IRC connection from %s: %v", ip, err)
+		return
+	}
+
+	sess, err := s.core.sessionMgr.AddSession(conn, ip)
+	if err != nil {
+		fmt.Fprintf(conn, "ERROR :%s\r\n", err.Error())
+		log.Printf("Rejected IRC connection from %s: %v", ip, err)
+		return
+	}
+	defer s.core.cleanup(sess)
+
+	c := &ircClient{srv: s, sess: sess}
+	sess.SetEncoder(c.encode)
+
+	err = c.register(peerEmail)
+	if err == nil {
+		err = s.core.checkBan(c.sess.GetUsername(), c.sess.GetEmail(), ip)
+	}
+	if err != nil {
+		if err != errIRCQuit && err != io.EOF {
+			c.sendRaw(fmt.Sprintf("ERROR :Closing link: %v", err))
+			log.Printf("IRC registration failed for %s: %v", ip, err)
+		}
+		return
+	}
+
+	log.Printf("IRC user %s authenticated from %s", c.nick, ip)
+
+	c.welcome()
+	c.joinDefaultRoom()
+	if err := s.core.handler.DeliverInbox(c.sess); err != nil {
+		log.Printf("Failed to deliver inbox of %s: %v", c.nick, err)
+	}
+
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Error reading from IRC user %s: %v", c.nick, err)
+			}
+			return
+		}
+		if err := c.handle(msg); err != nil {
+			if err == errIRCQuit {
+				c.sendRaw("ERROR :Closing link: Goodbye!")
+				return
+			}
+			log.Printf("Error handling IRC command from %s: %v", c.nick, err)
+		}
+	}
+}
+
+// readMessage reads the next non-empty IRC line
+func (c *ircClient) readMessage() (*ircMessage, error) {
+	for {
+		line, err := c.sess.Reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if msg := parseIRCLine(line); msg != nil {
+			return msg, nil
+		}
+	}
+}
+
+// register waits for NICK/USER and runs the configured authenticator.
+// Authentication answers are sent as private messages to *auth; PASS can be
+// used to answer the first prompt (the email address) up front.
+func (c *ircClient) register(peerEmail string) error {
+	// Wait for NICK and USER
+	for c.nick == "" || c.user == "" {
+		msg, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		if handled, err := c.handlePreRegistration(msg); handled || err != nil {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		c.sendNumeric(errNotRegistered, "You have not registered")
+	}
+
+	// Verify the email address unless the transport already proved it
+	email := peerEmail
+	if email != "" {
+		c.notice(fmt.Sprintf("Authenticated as %s by client certificate.", email))
+	} else {
+		var err error
+		if email, err = c.verifyEmail(); err != nil {
+			return err
+		}
+	}
+	c.sess.SetEmail(email)
+
+	// Returning users always get their registered nick
+	known, err := c.srv.core.restoreAccount(c.sess, email)
+	if err != nil {
+		return err
+	}
+	if known {
+		if c.nick != c.sess.GetUsername() {
+			c.notice(fmt.Sprintf("Your registered nickname is %s.", c.sess.GetUsername()))
+			c.nick = c.sess.GetUsername()
+		}
+		c.sess.SetState(session.StateAuthenticated)
+		return nil
+	}
+
+	// Claim the nick, registering it to this email
+	for {
+		err := c.srv.core.sessionMgr.ValidateUsername(c.nick)
+		if err == nil {
+			if err = c.srv.core.claimUsername(c.sess, c.nick); err == nil {
+				break
+			}
+			c.sendNumeric(errNicknameInUse, c.nick, "Nickname is already in use")
+		} else {
+			c.sendNumeric(errErroneusNickname, c.nick, err.Error())
+		}
+
+		if err := c.awaitNick(); err != nil {
+			return err
+		}
+	}
+
+	c.sess.SetState(session.StateAuthenticated)
+	return nil
+}
+
+// verifyEmail runs the configured authenticator over NOTICE / PRIVMSG *auth
+func (c *ircClient) verifyEmail() (string, error) {
+	c.notice(fmt.Sprintf("Please authenticate: answer prompts with /msg %s <answer>", ircAuthTarget))
+	return c.srv.core.authenticator.Authenticate(&auth.Request{
+		Prompter: c,
+		IP:       c.sess.IP,
+	})
+}
+
+// Prompt implements auth.Prompter. A server password (PASS) answers the first prompt.
+func (c *ircClient) Prompt(text string) (string, error) {
+	if c.pass != "" {
+		answer := c.pass
+		c.pass = ""
+		return answer, nil
+	}
+	return c.prompt(text)
+}
+
+// Notify implements auth.Prompter
+func (c *ircClient) Notify(text string) error {
+	c.notice(text)
+	return nil
+}
+
+// prompt sends a NOTICE and waits for the answer sent to *auth
+func (c *ircClient) prompt(text string) (string, error) {
+	c.notice(text)
+	for {
+		msg, err := c.readMessage()
+		if err != nil {
+			return "", err
+		}
+		if msg.Command == "PRIVMSG" && strings.EqualFold(msg.param(0), ircAuthTarget) {
+			if answer := strings.TrimSpace(msg.param(1)); answer != "" {
+				return answer, nil
+			}
+			continue
+		}
+		if handled, err := c.handlePreRegistration(msg); handled || err != nil {
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		c.sendNumeric(errNotRegistered, "You have not registered")
+	}
+}
+
+// awaitNick waits for the client to pick another nick
+func (c *ircClient) awaitNick() error {
+	current := c.nick
+	for c.nick == current {
+		msg, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		if handled, err := c.handlePreRegistration(msg); handled || err != nil {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		c.sendNumeric(errNotRegistered, "You have not registered")
+	}
+	return nil
+}
+
+// handlePreRegistration handles the commands allowed before registration completes
+func (c *ircClient) handlePreRegistration(msg *ircMessage) (bool, error) {
+	switch msg.Command {
+	case "PASS":
+		if c.nick != "" && c.user != "" {
+			c.sendNumeric(errAlreadyRegistred, "You may not reregister")
+		} else {
+			c.pass = msg.param(0)
+		}
+	case "NICK":
+		if msg.param(0) == "" {
+			c.sendNumeric(errNoNicknameGiven, "No nickname given")
+		} else {
+			c.nick = msg.param(0)
+		}
+	case "USER":
+		if len(msg.Params) < 4 {
+			c.sendNumeric(errNeedMoreParams, "USER", "Not enough parameters")
+		} else {
+			c.user = msg.param(0)
+		}
+	case "CAP":
+		// No IRCv3 capabilities are offered; answer so clients stop waiting
+		switch strings.ToUpper(msg.param(0)) {
+		case "LS":
+			c.sendRaw(fmt.Sprintf(":%s CAP * LS :", c.srv.serverName))
+		case "REQ":
+			c.sendRaw(fmt.Sprintf(":%s CAP * NAK :%s", c.srv.serverName, msg.param(1)))
+		}
+	case "PING":
+		c.sendRaw(fmt.Sprintf(":%s PONG %s :%s", c.srv.serverName, c.srv.serverName, msg.param(0)))
+	case "PONG":
+	case "QUIT":
+		return true, errIRCQuit
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// welcome sends the registration burst
+func (c *ircClient) welcome() {
+	c.sendNumeric(rplWelcome, fmt.Sprintf("Welcome to TCP Chat Server, %s!%s@%s", c.nick, c.user, c.sess.IP))
+	c.sendNumeric(rplYourHost, fmt.Sprintf("Your host is %s, running %s", c.srv.serverName, protocol.ProtocolName))
+	c.sendNumeric(rplCreated, fmt.Sprintf("This server was created %s", c.srv.started.Format(time.RFC1123)))
+	c.sendNumeric(rplMyInfo, c.srv.serverName, protocol.ProtocolName, "i", "nt")
+	c.sendNumeric(errNoMotd, "MOTD File is missing")
+}
+
+// joinDefaultRoom puts the user in the default room, like TCP users
+func (c *ircClient) joinDefaultRoom() {
+	core := c.srv.core
+	defaultRoom := core.roomMgr.GetDefaultRoom()
+
+	// Echo the JOIN first so replayed history lands in the channel window
+	c.sendFromSelf("JOIN", protocol.DefaultRoom)
+	if err := core.roomMgr.JoinRoom(protocol.DefaultRoom, c.sess, "", nil); err != nil {
+		log.Printf("Failed to join IRC user to %s: %v", protocol.DefaultRoom, err)
+	}
+	c.sendTopic(protocol.DefaultRoom)
+	c.sendNames(protocol.DefaultRoom)
+	defaultRoom.Broadcast(protocol.NewSystemMessage(fmt.Sprintf("%s joined the room", c.nick)), c.nick)
+}
+
+// handle handles a command from a registered client
+func (c *ircClient) handle(msg *ircMessage) error {
+	core := c.srv.core
+
+	switch msg.Command {
+	case "PING":
+		c.sendRaw(fmt.Sprintf(":%s PONG %s :%s", c.srv.serverName, c.srv.serverName, msg.param(0)))
+	case "PONG":
+	case "QUIT":
+		return errIRCQuit
+	case "PASS", "USER":
+		c.sendNumeric(errAlreadyRegistred, "You may not reregister")
+	case "NICK":
+		c.sendNumeric(errErroneusNickname, msg.param(0), "Nick changes are not supported")
+	case "JOIN":
+		if msg.param(0) == "" {
+			c.sendNumeric(errNeedMoreParams, "JOIN", "Not enough parameters")
+			return nil
+		}
+		if msg.param(0) == "0" {
+			// JOIN 0 parts every channel; users keep the default room
+			for _, name := range c.sess.GetRooms() {
+				if name != protocol.DefaultRoom {
+					if err := c.part(name); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+		keys := strings.Split(msg.param(1), ",")
+		for i, name := range strings.Split(msg.param(0), ",") {
+			key := ""
+			if i < len(keys) {
+				key = keys[i]
+			}
+			if err := c.join(name, key); err != nil {
+				return err
+			}
+		}
+	case "PART":
+		if msg.param(0) == "" {
+			c.sendNumeric(errNeedMoreParams, "PART", "Not enough parameters")
+			return nil
+		}
+		for _, name := range strings.Split(msg.param(0), ",") {
+			if err := c.part(name); err != nil {
+				return err
+			}
+		}
+	case "PRIVMSG":
+		return c.privmsg(msg)
+	case "NOTICE":
+		c.relayNotice(msg)
+	case "NAMES":
+		names := msg.param(0)
+		if names == "" {
+			names = strings.Join(c.sess.GetRooms(), ",")
+		}
+		for _, name := range strings.Split(names, ",") {
+			c.sendNames(name)
+		}
+	case "LIST":
+		c.sendList()
+	case "TOPIC":
+		if msg.param(0) == "" {
+			c.sendNumeric(errNeedMoreParams, "TOPIC", "Not enough parameters")
+			return nil
+		}
+		if len(msg.Params) < 2 {
+			c.sendTopic(msg.param(0))
+			return nil
+		}
+		return c.setTopic(msg.param(0), msg.param(1))
+	case "MODE":
+		target := msg.param(0)
+		// MODE #chan +o/-o nick appoints or removes a moderator
+		if mode := msg.param(1); strings.HasPrefix(target, "#") && (mode == "+o" || mode == "-o") {
+			if msg.param(2) == "" {
+				c.sendNumeric(errNeedMoreParams, "MODE", "Not enough parameters")
+				return nil
+			}
+			command := "/op "
+			if mode == "-o" {
+				command = "/deop "
+			}
+			return core.handler.HandleCommand(c.sess, command+msg.param(2)+" "+target)
+		}
+		if strings.HasPrefix(target, "#") {
+			if r, exists := core.roomMgr.GetRoom(target); exists {
+				c.sendNumeric(rplChannelModeIs, target, channelModes(r.GetAccess()))
+			} else {
+				c.sendNumeric(errNoSuchChannel, target, "No such channel")
+			}
+		}
+	case "INVITE":
+		if len(msg.Params) < 2 {
+			c.sendNumeric(errNeedMoreParams, "INVITE", "Not enough parameters")
+			return nil
+		}
+		return core.handler.HandleCommand(c.sess, "/invite "+msg.param(0)+" "+msg.param(1))
+	case "KICK":
+		if len(msg.Params) < 2 {
+			c.sendNumeric(errNeedMoreParams, "KICK", "Not enough parameters")
+			return nil
+		}
+		return c.kick(msg.param(0), msg.param(1), msg.param(2))
+	case "WHO":
+		c.sendNumeric(rplEndOfWho, msg.param(0), "End of WHO list")
+	default:
+		c.sendNumeric(errUnknownCommand, msg.Command, "Unknown command")
+	}
+	return nil
+}
+
+// join adds the user to a channel, keeping the channels already joined
+func (c *ircClient) join(name, key string) error {
+	if !strings.HasPrefix(name, "#") {
+		c.sendNumeric(errNoSuchChannel, name, "No such channel")
+		return nil
+	}
+	if c.sess.InRoom(name) {
+		return nil
+	}
+
+	core := c.srv.core
+	if _, err := core.roomMgr.CreateRoom(name, c.nick); err != nil {
+		c.notice(err.Error())
+		return nil
+	}
+	r, err := core.roomMgr.Admit(name, c.sess, key)
+	if err != nil {
+		c.notice(fmt.Sprintf("Cannot join %s: %v.", name, err))
+		return nil
+	}
+
+	// Echo the JOIN first so replayed history lands in the channel window
+	c.sendFromSelf("JOIN", name)
+	if err := core.roomMgr.Enter(r, c.sess, nil); err != nil {
+		c.sendFromSelf("PART", name)
+		c.notice(fmt.Sprintf("Cannot join %s: %v.", name, err))
+		return nil
+	}
+	c.sess.SetPrivateChat("")
+	c.sendTopic(name)
+	c.sendNames(name)
+	r.Broadcast(protocol.NewSystemMessage(fmt.Sprintf("%s joined the room", c.nick)), c.nick)
+	return nil
+}
+
+// part leaves a channel. Parting the last channel returns the user to the
+// default room.
+func (c *ircClient) part(name string) error {
+	if name == "" || !c.sess.InRoom(name) {
+		c.sendNumeric(errNotOnChannel, name, "You're not on that channel")
+		return nil
+	}
+	rooms := c.sess.GetRooms()
+	if name == protocol.DefaultRoom && len(rooms) == 1 {
+		c.notice(fmt.Sprintf("You cannot leave %s.", protocol.DefaultRoom))
+		return nil
+	}
+
+	// Return to the default room before leaving the last channel, so its
+	// JOIN goes out ahead of the replayed history
+	if len(rooms) == 1 {
+		c.joinDefaultRoom()
+	}
+	if err := c.srv.core.handler.HandleCommand(c.sess, "/leave "+name); err != nil {
+		return err
+	}
+	c.sendFromSelf("PART", name)
+	return nil
+}
+
+// privmsg sends a channel or private message
+func (c *ircClient) privmsg(msg *ircMessage) error {
+	target, text := msg.param(0), msg.param(1)
+	if target == "" || text == "" {
+		c.sendNumeric(errNoTextToSend, "No text to send")
+		return nil
+	}
+
+	// CTCP ACTION (/me) is rendered as an emote
+	if strings.HasPrefix(text, "\x01ACTION ") {
+		text = "* " + c.nick + " " + strings.TrimSuffix(strings.TrimPrefix(text, "\x01ACTION "), "\x01")
+	} else if strings.HasPrefix(text, "\x01") {
+		// Other CTCP requests are not supported
+		return nil
+	}
+
+	if strings.HasPrefix(target, "#") {
+		if !c.sess.InRoom(target) {
+			c.sendNumeric(errCannotSendToChan, target, "Cannot send to channel")
+			return nil
+		}
+		return c.srv.core.router.RouteChatToRoom(c.sess, target, text)
+	}
+
+	if err := c.srv.core.handler.SendPrivateMessage(c.sess, target, text); err != nil {
+		c.sendNumeric(errNoSuchNick, target, "No such nick/channel")
+	}
+	return nil
+}
+
+// relayNotice delivers a NOTICE like a PRIVMSG but drops it silently when it
+// can't be delivered: servers must never answer a NOTICE automatically, which
+// is what keeps bots from replying to each other in loops
+func (c *ircClient) relayNotice(msg *ircMessage) {
+	target, text := msg.param(0), msg.param(1)
+	if target == "" || text == "" || strings.HasPrefix(text, "\x01") {
+		return
+	}
+
+	if strings.HasPrefix(target, "#") {
+		c.srv.core.router.DeliverToRoom(c.sess, target, text)
+		return
+	}
+	if _, online := c.srv.core.sessionMgr.GetSessionByUsername(target); online {
+		c.srv.core.handler.SendPrivateMessage(c.sess, target, text)
+	}
+}
+
+// kick removes a user from a joined channel
+func (c *ircClient) kick(name, nick, reason string) error {
+	r, exists := c.srv.core.roomMgr.GetRoom(name)
+	if !exists || !c.sess.InRoom(name) {
+		c.sendNumeric(errNotOnChannel, name, "You're not on that channel")
+		return nil
+	}
+	if err := c.srv.core.handler.Kick(c.sess, r, nick, reason); err != nil {
+		c.notice(fmt.Sprintf("Cannot kick %s: %v.", nick, err))
+	}
+	return nil
+}
+
+// sendTopic sends the topic of a channel and who set it
+func (c *ircClient) sendTopic(name string) {
+	r, exists := c.srv.core.roomMgr.GetRoom(name)
+	if !exists {
+		c.sendNumeric(errNoSuchChannel, name, "No such channel")
+		return
+	}
+	topic := r.GetTopic()
+	if topic.Text == "" {
+		c.sendNumeric(rplNoTopic, name, "No topic is set")
+		return
+	}
+	c.sendNumeric(rplTopic, name, topic.Text)
+	c.sendNumeric(rplTopicWhoTime, name, topic.SetBy, fmt.Sprintf("%d", topic.SetAt.Unix()))
+}
+
+// setTopic changes the topic of a joined channel
+func (c *ircClient) setTopic(name, text string) error {
+	r, exists := c.srv.core.roomMgr.GetRoom(name)
+	if !exists || !c.sess.InRoom(name) {
+		c.sendNumeric(errNotOnChannel, name, "You're not on that channel")
+		return nil
+	}
+	if err := c.srv.core.handler.ChangeTopic(c.sess, r, text); err != nil {
+		c.notice(fmt.Sprintf("Cannot change the topic: %v.", err))
+	}
+	return nil
+}
+
+// sendNames sends the member list of a channel
+func (c *ircClient) sendNames(name string) {
+	if r, exists := c.srv.core.roomMgr.GetRoom(name); exists {
+		names := r.GetMemberNames()
+		sort.Strings(names)
+		// Owners and moderators show up as channel operators
+		for i, nick := range names {
+			if r.RoleOf(nick) >= room.RoleModerator {
+				names[i] = "@" + nick
+			}
+		}
+		c.sendNumeric(rplNamReply, "=", name, strings.Join(names, " "))
+	}
+	c.sendNumeric(rplEndOfNames, name, "End of NAMES list")
+}
+
+// sendList sends the channel list
+func (c *ircClient) sendList() {
+	core := c.srv.core
+	names := core.roomMgr.GetAllRoomNames()
+	sort.Strings(names)
+
+	c.sendNumeric(rplListStart, "Channel", "Users  Name")
+	for _, name := range names {
+		r, exists := core.roomMgr.GetRoom(name)
+		roomType, memberCount, _ := core.roomMgr.GetRoomInfo(name)
+		if !exists || !r.VisibleTo(c.nick) {
+			continue
+		}
+		c.sendNumeric(rplList, name, fmt.Sprintf("%d", memberCount), strings.TrimSpace(fmt.Sprintf("[%s] %s", roomType, r.GetTopic().Text)))
+	}
+	c.sendNumeric(rplListEnd, "End of LIST")
+}
+
+// channelModes maps a room's access settings onto IRC channel modes
+func channelModes(access room.Access) string {
+	modes := "+nt"
+	if access.InviteOnly {
+		modes += "i"
+	}
+	if access.Keyed {
+		modes += "k"
+	}
+	if access.Hidden {
+		modes += "s"
+	}
+	return modes
+}
+
+// encode maps chat server messages onto IRC lines
+func (c *ircClient) encode(msg *protocol.Message) string {
+	if msg.Replay {
+		// Without server-time support, show when replayed history was sent
+		replayed := *msg
+		replayed.Content = fmt.Sprintf("[%s] %s", msg.ShortTime(), msg.Content)
+		msg = &replayed
+	}
+
+	switch msg.Type {
+	case protocol.MessageTypeChat:
+		// IRC clients echo their own messages locally
+		if msg.From == c.nick {
+			return ""
+		}
+		if msg.Room != "" && msg.From != "" {
+			return c.formatLines(c.userPrefix(msg.From), "PRIVMSG", msg.Room, msg.Content)
+		}
+		return c.formatLines(c.srv.serverName, "NOTICE", c.target(msg), msg.Content)
+	case protocol.MessageTypePrivate:
+		return c.formatLines(c.userPrefix(msg.From), "PRIVMSG", c.nickOrStar(), msg.Content)
+	case protocol.MessageTypeError:
+		return c.formatLines(c.srv.serverName, "NOTICE", c.nickOrStar(), "ERROR: "+msg.Content)
+	case protocol.MessageTypeSystem:
+		// Moderators removing the user from a channel show up as a KICK
+		if msg.Removed && msg.Room != "" {
+			prefix := c.srv.serverName
+			if msg.From != "" {
+				prefix = c.userPrefix(msg.From)
+			}
+			return fmt.Sprintf(":%s KICK %s %s :%s\r\n", prefix, msg.Room, c.nick, msg.Content)
+		}
+		return c.formatLines(c.srv.serverName, "NOTICE", c.target(msg), "*** "+msg.Content)
+	default:
+		return c.formatLines(c.srv.serverName, "NOTICE", c.nickOrStar(), msg.Content)
+	}
+}
+
+// target returns the channel a message belongs to, or the user's nick
+func (c *ircClient) target(msg *protocol.Message) string {
+	if msg.Room != "" {
+		return msg.Room
+	}
+	return c.nickOrStar()
+}
+
+// formatLines formats one IRC line per line of content
+func (c *ircClient) formatLines(prefix, command, target, content string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fmt.Fprintf(&b, ":%s %s %s :%s\r\n", prefix, command, target, line)
+	}
+	return b.String()
+}
+
+// userPrefix returns the nick!user@host prefix of a user
+func (c *ircClient) userPrefix(nick string) string {
+	return fmt.Sprintf("%s!%s@%s", nick, nick, c.srv.serverName)
+}
+
+// nickOrStar returns the client's nick, or "*" before one is known
+func (c *ircClient) nickOrStar() string {
+	if c.nick == "" {
+		return "*"
+	}
+	return c.nick
+}
+
+// notice sends a server NOTICE to the client
+func (c *ircClient) notice(text string) {
+	c.sendRaw(fmt.Sprintf(":%s NOTICE %s :%s", c.srv.serverName, c.nickOrStar(), text))
+}
+
+// sendFromSelf sends a command with the client's own prefix (e.g. JOIN echoes)
+func (c *ircClient) sendFromSelf(command, channel string) {
+	c.sendRaw(fmt.Sprintf(":%s %s :%s", c.userPrefix(c.nick), command, channel))
+}
+
+// sendNumeric sends a numeric reply; the last parameter is sent as trailing
+func (c *ircClient) sendNumeric(numeric string, params ...string) {
+	line := fmt.Sprintf(":%s %s %s", c.srv.serverName, numeric, c.nickOrStar())
+	for i, p := range params {
+		if i == len(params)-1 {
+			line += " :" + p
+		} else {
+			line += " " + p
+		}
+	}
+	c.sendRaw(line)
+}
+
+// sendRaw sends a raw IRC line
+func (c *ircClient) sendRaw(line string) {
+	_ = c.sess.Send(line + "\r\n")
+}
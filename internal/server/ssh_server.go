@@ -0,0 +1,301 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/auth"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// sshFingerprintExtension carries the client key fingerprint through ssh.Permissions
+const sshFingerprintExtension = "pubkey-fp"
+
+// SSHServer presents the line-oriented chat over SSH sessions. Any public key
+// is accepted at the SSH layer; the first time a key is used the user goes
+// through the email OTP flow, after which the key is bound to that email and
+// later logins skip the OTP step.
+type SSHServer struct {
+	port     string
+	core     *TCPServer
+	keyStore *auth.KeyStore
+	config   *ssh.ServerConfig
+	listener net.Listener
+}
+
+// NewSSHServer creates a new SSH front-end. The host key is loaded from
+// hostKeyFile, or generated and saved there if the file does not exist.
+func NewSSHServer(port, hostKeyFile string, keyStore *auth.KeyStore, core *TCPServer) (*SSHServer, error) {
+	hostKey, err := loadOrCreateHostKey(hostKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return &ssh.Permissions{
+				Extensions: map[string]string{sshFingerprintExtension: ssh.FingerprintSHA256(key)},
+			}, nil
+		},
+		// Users without a key can still log in and authenticate by email OTP
+		KeyboardInteractiveCallback: func(_ ssh.ConnMetadata, _ ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			return &ssh.Permissions{}, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	return &SSHServer{
+		port:     port,
+		core:     core,
+		keyStore: keyStore,
+		config:   config,
+	}, nil
+}
+
+// Start starts the SSH listener
+func (s *SSHServer) Start() error {
+	listener, err := net.Listen("tcp", ":"+s.port)
+	if err != nil {
+		return fmt.Errorf("failed to start SSH server: %w", err)
+	}
+	s.listener = listener
+
+	log.Printf("SSH front-end started on port %s", s.port)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Printf("Failed to accept SSH connection: %v", err)
+			continue
+		}
+
+		go s.handleConnection(conn)
+	}
+}
+
+// Stop stops the SSH listener
+func (s *SSHServer) Stop() error {
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+// handleConnection performs the SSH handshake and serves the first shell session
+func (s *SSHServer) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		log.Printf("SSH handshake failed from %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	defer sshConn.Close()
+
+	go ssh.DiscardRequests(reqs)
+
+	fingerprint := sshConn.Permissions.Extensions[sshFingerprintExtension]
+
+	served := false
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" || served {
+			newChannel.Reject(ssh.UnknownChannelType, "only a single session channel is supported")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			log.Printf("Failed to accept SSH channel: %v", err)
+			return
+		}
+		served = true
+
+		go func() {
+			// Serve the chat once the client asks for a shell
+			if pty, ok := waitForShell(requests); ok {
+				s.core.ServeConn(newSSHConn(channel, sshConn, pty, fingerprint, s.keyStore))
+			}
+			channel.Close()
+			sshConn.Close()
+		}()
+	}
+}
+
+// waitForShell answers channel requests until a shell is requested and
+// reports whether a pty was allocated. Later requests are answered in the
+// background.
+func waitForShell(requests <-chan *ssh.Request) (bool, bool) {
+	pty := false
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			pty = true
+			req.Reply(true, nil)
+		case "shell":
+			req.Reply(true, nil)
+			go func() {
+				for req := range requests {
+					req.Reply(req.Type == "window-change", nil)
+				}
+			}()
+			return pty, true
+		case "env", "window-change":
+			req.Reply(true, nil)
+		default:
+			req.Reply(false, nil)
+		}
+	}
+	return false, false
+}
+
+// loadOrCreateHostKey loads an SSH host key, generating an ed25519 key if missing
+func loadOrCreateHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SSH host key: %w", err)
+		}
+		return signer, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read SSH host key: %w", err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SSH host key: %w", err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "tcp-chat host key")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SSH host key: %w", err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save SSH host key: %w", err)
+	}
+	log.Printf("Generated new SSH host key at %s", path)
+
+	return ssh.NewSignerFromKey(key)
+}
+
+// sshConn adapts an SSH session channel to net.Conn. With a pty the
+// channel is driven through a terminal that provides echo and line editing.
+type sshConn struct {
+	channel     ssh.Channel
+	meta        ssh.ConnMetadata
+	terminal    *term.Terminal
+	fingerprint string
+	keyStore    *auth.KeyStore
+	readBuf     []byte
+	closeOnce   sync.Once
+}
+
+// newSSHConn wraps an SSH session channel
+func newSSHConn(channel ssh.Channel, meta ssh.ConnMetadata, pty bool, fingerprint string, keyStore *auth.KeyStore) *sshConn {
+	c := &sshConn{
+		channel:     channel,
+		meta:        meta,
+		fingerprint: fingerprint,
+		keyStore:    keyStore,
+	}
+	if pty {
+		c.terminal = term.NewTerminal(channel, "")
+	}
+	return c
+}
+
+// VerifiedEmail returns the email bound to the client's public key, if any
+func (c *sshConn) VerifiedEmail() string {
+	if c.fingerprint == "" {
+		return ""
+	}
+	email, _ := c.keyStore.Lookup(c.fingerprint)
+	return email
+}
+
+// BindEmail binds the client's public key to an email verified by OTP
+func (c *sshConn) BindEmail(email string) (bool, error) {
+	if c.fingerprint == "" {
+		return false, nil
+	}
+	return true, c.keyStore.Bind(c.fingerprint, email)
+}
+
+// Read returns input lines, using the terminal line editor when a pty was allocated
+func (c *sshConn) Read(p []byte) (int, error) {
+	if c.terminal == nil {
+		return c.channel.Read(p)
+	}
+
+	for len(c.readBuf) == 0 {
+		line, err := c.terminal.ReadLine()
+		if err != nil {
+			return 0, err
+		}
+		c.readBuf = []byte(line + "\n")
+	}
+
+	n := copy(p, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+// Write writes output, translating newlines for the terminal when a pty was allocated
+func (c *sshConn) Write(p []byte) (int, error) {
+	if c.terminal == nil {
+		return c.channel.Write(p)
+	}
+	return c.terminal.Write(p)
+}
+
+// Close closes the SSH channel
+func (c *sshConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.channel.Close()
+	})
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// LocalAddr returns the local network address
+func (c *sshConn) LocalAddr() net.Addr {
+	return c.meta.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address
+func (c *sshConn) RemoteAddr() net.Addr {
+	return c.meta.RemoteAddr()
+}
+
+// SetDeadline is not supported on SSH channels
+func (c *sshConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+// SetReadDeadline is not supported on SSH channels
+func (c *sshConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline is not supported on SSH channels
+func (c *sshConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -1,30 +1,53 @@
 package server
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
-	"regexp"
 	"strings"
+	"time"
 
+	"github.com/mullayam/go-tcp-chat/internal/account"
+	"github.com/mullayam/go-tcp-chat/internal/admin"
 	"github.com/mullayam/go-tcp-chat/internal/auth"
 	"github.com/mullayam/go-tcp-chat/internal/message"
 	"github.com/mullayam/go-tcp-chat/internal/protocol"
 	"github.com/mullayam/go-tcp-chat/internal/room"
 	"github.com/mullayam/go-tcp-chat/internal/session"
+	"github.com/mullayam/go-tcp-chat/internal/storage"
 )
 
 // TCPServer represents the TCP chat server
 type TCPServer struct {
-	port         string
-	sessionMgr   *session.Manager
-	roomMgr      *room.Manager
-	otpService   *auth.OTPService
-	emailService *auth.EmailService
-	router       *message.Router
-	handler      *message.Handler
-	listener     net.Listener
+	port          string
+	tlsConfig     *tls.Config
+	sessionMgr    *session.Manager
+	roomMgr       *room.Manager
+	accounts      *account.Store
+	bans          *admin.BanList
+	authenticator auth.Authenticator
+	tokens        *auth.ResumeTokenService
+	router        *message.Router
+	handler       *message.Handler
+	listener      net.Listener
+}
+
+// Options holds the optional settings of a TCPServer; the zero value
+// disables each of them
+type Options struct {
+	// InboxLimit caps the private messages queued per offline user
+	InboxLimit int
+	// Bans is the server ban list checked at login and managed with /admin
+	Bans *admin.BanList
+	// Operators are the lowercase emails of the users allowed to run /admin
+	Operators []string
+	// Tokens issues and verifies resume tokens
+	Tokens *auth.ResumeTokenService
+	// TLSConfig makes the server listen with TLS
+	TLSConfig *tls.Config
 }
 
 // NewTCPServer creates a new TCP server
@@ -32,32 +55,65 @@ func NewTCPServer(
 	port string,
 	sessionMgr *session.Manager,
 	roomMgr *room.Manager,
-	otpService *auth.OTPService,
-	emailService *auth.EmailService,
-) *TCPServer {
-	handler := message.NewHandler(sessionMgr, roomMgr)
+	accounts *account.Store,
+	messages *storage.IndexedStore,
+	authenticator auth.Authenticator,
+	opts Options,
+) (*TCPServer, error) {
+	handler := message.NewHandler(sessionMgr, roomMgr, accounts, messages, message.HandlerOptions{
+		InboxLimit: opts.InboxLimit,
+		Bans:       opts.Bans,
+		Operators:  opts.Operators,
+	})
 	router := message.NewRouter(roomMgr, handler)
 
-	return &TCPServer{
-		port:         port,
-		sessionMgr:   sessionMgr,
-		roomMgr:      roomMgr,
-		otpService:   otpService,
-		emailService: emailService,
-		router:       router,
-		handler:      handler,
+	s := &TCPServer{
+		port:          port,
+		tlsConfig:     opts.TLSConfig,
+		sessionMgr:    sessionMgr,
+		roomMgr:       roomMgr,
+		accounts:      accounts,
+		bans:          opts.Bans,
+		authenticator: authenticator,
+		tokens:        opts.Tokens,
+		router:        router,
+		handler:       handler,
+	}
+	handler.SetLogoutHandler(s.logout)
+	err := handler.Commands().Register(message.Command{
+		Name:        "linkkey",
+		Description: "Link your SSH key to your email so later logins skip the OTP step",
+		Args:        message.Args(0, 0),
+		Run: func(_ *message.Handler, sess *session.Session, _ []string) error {
+			return s.linkKey(sess)
+		},
+	})
+	if err != nil {
+		return nil, err
 	}
+	return s, nil
 }
 
-// Start starts the TCP server
+// Commands returns the registry of slash commands, to which code embedding
+// the server may add its own before it starts
+func (s *TCPServer) Commands() *message.Registry {
+	return s.handler.Commands()
+}
+
+// Start starts the TCP server, using TLS when a TLS configuration was given
 func (s *TCPServer) Start() error {
 	listener, err := net.Listen("tcp", ":"+s.port)
 	if err != nil {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
-	s.listener = listener
 
-	log.Printf("TCP Chat Server started on port %s", s.port)
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+		log.Printf("TCP Chat Server started on port %s (TLS)", s.port)
+	} else {
+		log.Printf("TCP Chat Server started on port %s", s.port)
+	}
+	s.listener = listener
 
 	for {
 		conn, err := listener.Accept()
@@ -66,7 +122,7 @@ func (s *TCPServer) Start() error {
 			continue
 		}
 
-		go s.handleConnection(conn)
+		go s.handleConnection(conn, true)
 	}
 }
 
@@ -78,14 +134,36 @@ func (s *TCPServer) Stop() error {
 	return nil
 }
 
-// handleConnection handles a new client connection
-func (s *TCPServer) handleConnection(conn net.Conn) {
+// ServeConn runs the chat protocol over an already accepted connection. It is
+// used by the alternative front-ends (e.g. the WebSocket gateway) and blocks
+// until the connection is closed. Those connections frame their own
+// messages, so deflate is not offered on them.
+func (s *TCPServer) ServeConn(conn net.Conn) {
+	s.handleConnection(conn, false)
+}
+
+// handleConnection handles a new client connection. stream is set for plain
+// TCP connections, which can carry the deflate capability.
+func (s *TCPServer) handleConnection(conn net.Conn, stream bool) {
 	defer conn.Close()
 
 	// Extract IP address (without port)
 	ip := s.extractIP(conn.RemoteAddr().String())
 	log.Printf("New connection from %s", ip)
 
+	// Identity proven by the transport (e.g. a trusted TLS client certificate)
+	peerEmail, err := verifiedEmail(conn)
+	if err != nil {
+		log.Printf("Rejected connection from %s: %v", ip, err)
+		return
+	}
+
+	if err := s.checkBan("", "", ip); err != nil {
+		conn.Write([]byte(protocol.NewErrorMessage(err.Error()).Format()))
+		log.Printf("Rejected connection from %s: %v", ip, err)
+		return
+	}
+
 	// Try to add session (enforces one-connection-per-IP)
 	sess, err := s.sessionMgr.AddSession(conn, ip)
 	if err != nil {
@@ -94,32 +172,50 @@ func (s *TCPServer) handleConnection(conn net.Conn) {
 		return
 	}
 
+	sess.SetStream(stream)
+
 	// Ensure cleanup on disconnect
 	defer s.cleanup(sess)
 
 	// Send welcome message
-	sess.Send(protocol.NewSystemMessage("Welcome to TCP Chat Server!").Format())
-	sess.Send(protocol.NewSystemMessage("Please authenticate to continue.").Format())
-	sess.Send(protocol.NewSystemMessage("Enter your email address below").Format())
+	sess.SendMessage(protocol.NewSystemMessage("Welcome to TCP Chat Server!"))
+	sess.SendMessage(protocol.NewSystemMessage("Please authenticate to continue."))
 
 	// Start authentication flow
-	if err := s.authenticate(sess); err != nil {
-		sess.Send(protocol.NewErrorMessage(fmt.Sprintf("Authentication failed: %v", err)).Format())
+	roomNames, err := s.authenticate(sess, peerEmail)
+	if err == nil {
+		err = s.checkBan(sess.GetUsername(), sess.GetEmail(), ip)
+	}
+	if err != nil {
+		sess.SendMessage(protocol.NewErrorMessage(fmt.Sprintf("Authentication failed: %v", err)))
 		log.Printf("Authentication failed for %s: %v", ip, err)
 		return
 	}
 
-	// Join default room
-	defaultRoom := s.roomMgr.GetDefaultRoom()
-	defaultRoom.AddMember(sess)
-	sess.SetCurrentRoom(protocol.DefaultRoom)
-
-	// Notify user
-	sess.Send(protocol.NewSystemMessage(fmt.Sprintf("You joined %s", protocol.DefaultRoom)).Format())
-	sess.Send(protocol.NewSystemMessage("Type /help for available commands.").Format())
+	// Transports with their own identity (SSH keys) can remember the email,
+	// but only when the user asks for it
+	if _, ok := conn.(emailBinder); ok && sess.Challenged() {
+		sess.SendMessage(protocol.NewSystemMessage("Type /linkkey to link your key to your email; future logins will skip the OTP step."))
+	}
 
-	// Notify room
-	defaultRoom.Broadcast(protocol.NewSystemMessage(fmt.Sprintf("%s joined the room", sess.GetUsername())), sess.GetUsername())
+	// Join the default room, or the rooms a resumed session was in that
+	// still exist; a token never recreates a room, which would make its
+	// holder the owner
+	for _, roomName := range roomNames {
+		room, exists := s.roomMgr.GetRoom(roomName)
+		if !exists || !room.CanJoin(sess.GetUsername(), sess.GetEmail(), sess.IP) {
+			continue
+		}
+		s.joinRoom(sess, room)
+	}
+	if len(sess.GetRooms()) == 0 {
+		s.joinRoom(sess, s.roomMgr.GetDefaultRoom())
+	}
+	sess.SendMessage(protocol.NewSystemMessage("Type /help for available commands."))
+	if err := s.handler.DeliverInbox(sess); err != nil {
+		log.Printf("Failed to deliver inbox of %s: %v", sess.GetUsername(), err)
+	}
+	s.issueResumeToken(sess)
 
 	log.Printf("User %s authenticated from %s", sess.GetUsername(), ip)
 
@@ -127,55 +223,104 @@ func (s *TCPServer) handleConnection(conn net.Conn) {
 	s.handleMessages(sess)
 }
 
-// authenticate handles the authentication flow
-func (s *TCPServer) authenticate(sess *session.Session) error {
-	// Read email (prompt already sent)
-	email, err := s.readNonEmptyLine(sess)
-	if err != nil {
-		return err
-	}
-	sess.Send(protocol.NewSystemMessage("Please wait while we verify your email address...").Format())
-	email = strings.TrimSpace(email)
-	if !s.isValidEmail(email) {
-		return fmt.Errorf("invalid email address")
+// authenticate handles the authentication flow and returns the rooms the
+// user should start in; the last one becomes the current room. If peerEmail
+// is set, the transport has already proven the email address and the
+// configured authenticator is skipped. A valid RESUME at any prompt restores
+// the session from its token instead.
+func (s *TCPServer) authenticate(sess *session.Session, peerEmail string) ([]string, error) {
+	for {
+		err := s.login(sess, peerEmail)
+		var resumed *resumedError
+		if !errors.As(err, &resumed) {
+			return []string{protocol.DefaultRoom}, err
+		}
+
+		if err := s.resume(sess, resumed.claims, peerEmail); err != nil {
+			sess.Send(protocol.FormatResumeFailure(err.Error()))
+			log.Printf("Failed to resume session for %s: %v", resumed.claims.Username, err)
+			continue
+		}
+		return resumedRooms(resumed.claims), nil
 	}
+}
 
-	sess.SetEmail(email)
+// checkBan returns an error if the server bans a user; any of username,
+// email and ip may be empty
+func (s *TCPServer) checkBan(username, email, ip string) error {
+	if s.bans == nil {
+		return nil
+	}
+	ban, banned := s.bans.Match(username, email, ip)
+	if !banned {
+		return nil
+	}
+	if ban.Until.IsZero() {
+		return fmt.Errorf("you are banned from this server")
+	}
+	return fmt.Errorf("you are banned from this server until %s", ban.Until.Local().Format("2006-01-02 15:04"))
+}
 
-	// Generate and send OTP
-	otp, err := s.otpService.Generate(email)
-	if err != nil {
-		return fmt.Errorf("failed to generate OTP: %w", err)
+// resumedRooms returns the rooms restored by resume token claims, ending
+// with the current room. Tokens from before multi-room sessions only carry
+// the current room.
+func resumedRooms(claims *auth.ResumeClaims) []string {
+	rooms := make([]string, 0, len(claims.Rooms)+1)
+	for _, name := range claims.Rooms {
+		if name != claims.Room {
+			rooms = append(rooms, name)
+		}
 	}
+	return append(rooms, claims.Room)
+}
 
-	err = s.emailService.SendOTP(email, otp)
-	if err != nil {
-		s.otpService.Clear(email)
-		return fmt.Errorf("failed to send OTP: %w", err)
+// joinRoom joins the session to a room at login and notifies both sides
+func (s *TCPServer) joinRoom(sess *session.Session, room *room.Room) {
+	if err := s.roomMgr.JoinRoom(room.Name, sess, "", nil); err != nil {
+		log.Printf("Failed to join %s to %s: %v", sess.GetUsername(), room.Name, err)
+		return
 	}
 
-	sess.SetState(session.StateAwaitingOTP)
-	sess.Send(protocol.NewSystemMessage("OTP sent to your email. Please check your inbox.").Format())
+	joined := protocol.NewSystemMessage(fmt.Sprintf("You joined %s", room.Name))
+	joined.Room = room.Name
+	sess.SendMessage(joined)
+	s.handler.SendTopic(sess, room)
+	room.Broadcast(protocol.NewSystemMessage(fmt.Sprintf("%s joined the room", sess.GetUsername())), sess.GetUsername())
+}
 
-	// Request OTP
-	sess.Send(protocol.NewSystemMessage("Enter OTP code:").Format())
-	otpCode, err := s.readNonEmptyLine(sess)
-	if err != nil {
-		return err
+// login runs the interactive authentication flow
+func (s *TCPServer) login(sess *session.Session, peerEmail string) error {
+	email := peerEmail
+	if email != "" {
+		sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Authenticated as %s by %s.", email, credentialName(sess.Conn))))
+	} else {
+		var err error
+		email, err = s.authenticator.Authenticate(&auth.Request{
+			Prompter: &sessionPrompter{server: s, sess: sess},
+			IP:       sess.IP,
+		})
+		if err != nil {
+			return err
+		}
+		if s.authenticator.Name() != "none" {
+			sess.SetChallenged()
+		}
 	}
+	sess.SetEmail(email)
 
-	otpCode = strings.TrimSpace(otpCode)
-
-	// Validate OTP
-	err = s.otpService.Validate(email, otpCode)
+	// Returning users get their registered username back
+	known, err := s.restoreAccount(sess, email)
 	if err != nil {
 		return err
 	}
-
-	sess.Send(protocol.NewSystemMessage("OTP verified successfully!").Format())
+	if known {
+		sess.SetState(session.StateAuthenticated)
+		sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Welcome back, %s!", sess.GetUsername())))
+		return nil
+	}
 
 	// Request username
-	sess.Send(protocol.NewSystemMessage("Enter username (3-16 characters, alphanumeric + underscore): ").Format())
+	sess.SendMessage(protocol.NewSystemMessage("Enter username (3-16 characters, alphanumeric + underscore): "))
 	username, err := s.readNonEmptyLine(sess)
 	if err != nil {
 		return err
@@ -183,23 +328,144 @@ func (s *TCPServer) authenticate(sess *session.Session) error {
 
 	username = strings.TrimSpace(username)
 
-	// Validate username
-	if err := s.sessionMgr.ValidateUsername(username); err != nil {
+	// Register the username to this email for good
+	if err := s.claimUsername(sess, username); err != nil {
 		return err
 	}
 
-	// Register username
-	if err := s.sessionMgr.RegisterUsername(sess, username); err != nil {
+	sess.SetState(session.StateAuthenticated)
+	sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Welcome, %s!", username)))
+	return nil
+}
+
+// restoreAccount registers the username of the account bound to email for
+// the session. It reports false if the email has no account yet.
+func (s *TCPServer) restoreAccount(sess *session.Session, email string) (bool, error) {
+	acct, exists := s.accounts.GetByEmail(email)
+	if !exists {
+		return false, nil
+	}
+	if err := s.sessionMgr.RegisterUsername(sess, acct.Username); err != nil {
+		return true, err
+	}
+	s.touchAccount(sess)
+	return true, nil
+}
+
+// claimUsername creates an account binding username to the session's email
+// and registers it for the session
+func (s *TCPServer) claimUsername(sess *session.Session, username string) error {
+	if err := s.sessionMgr.ValidateUsername(username); err != nil {
 		return err
 	}
+	if _, online := s.sessionMgr.GetSessionByUsername(username); online {
+		return fmt.Errorf("username '%s' is already taken", username)
+	}
+	if _, err := s.accounts.Create(sess.GetEmail(), username); err != nil {
+		return err
+	}
+	return s.sessionMgr.RegisterUsername(sess, username)
+}
+
+// touchAccount records that the session's user was just seen
+func (s *TCPServer) touchAccount(sess *session.Session) {
+	err := s.accounts.Update(sess.GetEmail(), func(acct *account.Account) {
+		acct.LastSeen = time.Now()
+	})
+	if err != nil {
+		log.Printf("Failed to update account for %s: %v", sess.GetUsername(), err)
+	}
+}
 
+// resume restores a session from verified resume token claims
+func (s *TCPServer) resume(sess *session.Session, claims *auth.ResumeClaims, peerEmail string) error {
+	if peerEmail != "" && claims.Email != peerEmail {
+		return fmt.Errorf("token belongs to a different account")
+	}
+	if acct, exists := s.accounts.GetByEmail(claims.Email); !exists || acct.Username != claims.Username {
+		return fmt.Errorf("token does not match a registered account")
+	}
+	if err := s.sessionMgr.RegisterUsername(sess, claims.Username); err != nil {
+		return err
+	}
+	sess.SetEmail(claims.Email)
+	s.touchAccount(sess)
 	sess.SetState(session.StateAuthenticated)
-	sess.Send(protocol.NewSystemMessage(fmt.Sprintf("Welcome, %s!", username)).Format())
+	sess.SendMessage(protocol.NewSystemMessage(fmt.Sprintf("Session resumed. Welcome back, %s!", claims.Username)))
+	return nil
+}
+
+// issueResumeToken hands a fresh resume token to clients that negotiated the
+// resume capability
+func (s *TCPServer) issueResumeToken(sess *session.Session) {
+	if s.tokens == nil || !sess.HasCapability(protocol.CapResume) {
+		return
+	}
+
+	token, err := s.tokens.Issue(sess.GetEmail(), sess.GetUsername(), sess.GetCurrentRoom(), sess.GetRooms())
+	if err != nil {
+		log.Printf("Failed to issue resume token for %s: %v", sess.GetUsername(), err)
+		return
+	}
+	sess.Send(protocol.FormatToken(token))
+}
+
+// linkKey binds the public key of an SSH connection to the user's email.
+// Only users who answered the authenticator's challenge on this connection
+// may link a key, so a resume token can't be turned into a permanent login.
+func (s *TCPServer) linkKey(sess *session.Session) error {
+	binder, ok := sess.Conn.(emailBinder)
+	if !ok {
+		return sess.SendMessage(protocol.NewErrorMessage("Only SSH connections have a key to link."))
+	}
+	if !sess.Challenged() {
+		return sess.SendMessage(protocol.NewErrorMessage("Sign in with the OTP step on this connection to link your key."))
+	}
+
+	bound, err := binder.BindEmail(sess.GetEmail())
+	if err != nil {
+		log.Printf("Failed to bind key for %s: %v", sess.GetUsername(), err)
+		return sess.SendMessage(protocol.NewErrorMessage("Failed to link your key."))
+	}
+	if !bound {
+		return sess.SendMessage(protocol.NewErrorMessage("You did not connect with a public key."))
+	}
+	log.Printf("User %s linked an SSH key to %s", sess.GetUsername(), sess.GetEmail())
+	return sess.SendMessage(protocol.NewSystemMessage("Your key is now linked to your email; future logins will skip the OTP step."))
+}
+
+// logout revokes every resume token of the session's user
+func (s *TCPServer) logout(sess *session.Session) error {
+	if s.tokens == nil {
+		return nil
+	}
+	if err := s.tokens.Revoke(sess.GetEmail()); err != nil {
+		log.Printf("Failed to revoke resume tokens for %s: %v", sess.GetUsername(), err)
+		return fmt.Errorf("failed to revoke saved sessions")
+	}
 	return nil
 }
 
+// sessionPrompter runs authenticator prompts over a session
+type sessionPrompter struct {
+	server *TCPServer
+	sess   *session.Session
+}
+
+// Prompt sends a prompt and reads the user's answer
+func (p *sessionPrompter) Prompt(text string) (string, error) {
+	p.sess.SendMessage(protocol.NewSystemMessage(text))
+	return p.server.readNonEmptyLine(p.sess)
+}
+
+// Notify sends an informational message
+func (p *sessionPrompter) Notify(text string) error {
+	return p.sess.SendMessage(protocol.NewSystemMessage(text))
+}
+
 // handleMessages handles incoming messages from a client
 func (s *TCPServer) handleMessages(sess *session.Session) {
+	rooms := roomState(sess)
 	for {
 		line, err := s.readLine(sess)
 		if err != nil {
@@ -221,9 +487,21 @@ func (s *TCPServer) handleMessages(sess *session.Session) {
 			}
 			log.Printf("Error routing message from %s: %v", sess.GetUsername(), err)
 		}
+
+		// Keep the client's resume token pointing at the rooms it is in
+		if state := roomState(sess); state != rooms {
+			rooms = state
+			s.issueResumeToken(sess)
+		}
 	}
 }
 
+// roomState summarizes the session's rooms so handleMessages can tell when
+// they change
+func roomState(sess *session.Session) string {
+	return sess.GetCurrentRoom() + " " + strings.Join(sess.GetRooms(), ",")
+}
+
 // readNonEmptyLine reads a line and skips empty lines
 func (s *TCPServer) readNonEmptyLine(sess *session.Session) (string, error) {
 	for {
@@ -238,13 +516,23 @@ func (s *TCPServer) readNonEmptyLine(sess *session.Session) (string, error) {
 	}
 }
 
-// readLine reads a line from the session
+// readLine reads a line from the session, handling protocol negotiation lines
 func (s *TCPServer) readLine(sess *session.Session) (string, error) {
-	line, err := sess.Reader.ReadString('\n')
-	if err != nil {
-		return "", err
+	for {
+		line, err := sess.Reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		consumed, err := s.negotiate(sess, line)
+		if err != nil {
+			return "", err
+		}
+		if consumed {
+			continue
+		}
+		return line, nil
 	}
-	return strings.TrimRight(line, "\r\n"), nil
 }
 
 // cleanup cleans up a session on disconnect
@@ -252,11 +540,10 @@ func (s *TCPServer) cleanup(sess *session.Session) {
 	username := sess.GetUsername()
 	ip := sess.IP
 
-	// Leave current room
-	currentRoom := sess.GetCurrentRoom()
-	if currentRoom != "" {
-		s.roomMgr.LeaveRoom(sess)
-		if room, exists := s.roomMgr.GetRoom(currentRoom); exists {
+	// Leave every joined room
+	for _, roomName := range sess.GetRooms() {
+		s.roomMgr.LeaveRoom(sess, roomName)
+		if room, exists := s.roomMgr.GetRoom(roomName); exists {
 			if username != "" {
 				room.Broadcast(protocol.NewSystemMessage(fmt.Sprintf("%s left the room", username)), "")
 			}
@@ -265,6 +552,9 @@ func (s *TCPServer) cleanup(sess *session.Session) {
 
 	// Remove session
 	s.sessionMgr.RemoveSession(sess)
+	if username != "" {
+		s.touchAccount(sess)
+	}
 
 	if username != "" {
 		log.Printf("User %s disconnected from %s", username, ip)
@@ -282,8 +572,10 @@ func (s *TCPServer) extractIP(remoteAddr string) string {
 	return remoteAddr
 }
 
-// isValidEmail validates an email address
-func (s *TCPServer) isValidEmail(email string) bool {
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
-	return emailRegex.MatchString(email)
+// credentialName describes the credential a transport used to prove the email
+func credentialName(conn net.Conn) string {
+	if _, ok := conn.(identityConn); ok {
+		return "key"
+	}
+	return "client certificate"
 }
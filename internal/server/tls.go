@@ -0,0 +1,114 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/auth"
+)
+
+// handshakeTimeout bounds how long a client may take to finish a TLS or SSH handshake
+const handshakeTimeout = 10 * time.Second
+
+// LoadTLSConfig builds the server TLS configuration. When clientCAFile is set,
+// clients may present a certificate signed by that CA; a trusted certificate
+// carrying an email address lets the user skip the email OTP step.
+func LoadTLSConfig(certFile, keyFile, minVersion, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	version, err := parseTLSVersion(minVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   version,
+	}
+
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return cfg, nil
+}
+
+// parseTLSVersion parses a version string such as "1.2" or "1.3"
+func parseTLSVersion(version string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(version), "tls") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "", "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version '%s'", version)
+	}
+}
+
+// identityConn is implemented by transports that can prove the user's email
+// themselves (e.g. SSH keys previously bound to an email)
+type identityConn interface {
+	VerifiedEmail() string
+}
+
+// emailBinder is implemented by transports that can remember the email a
+// user verified by OTP, so later connections skip the OTP step (see /linkkey)
+type emailBinder interface {
+	BindEmail(email string) (bool, error)
+}
+
+// verifiedEmail returns the email address proven by the transport, if any.
+// For TLS connections this is the email of a client certificate that chains
+// to the configured client CA.
+func verifiedEmail(conn net.Conn) (string, error) {
+	if ic, ok := conn.(identityConn); ok {
+		return ic.VerifiedEmail(), nil
+	}
+
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return "", nil
+	}
+
+	// Complete the handshake now so the peer certificates are available
+	tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return "", fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return "", nil
+	}
+
+	leaf := state.PeerCertificates[0]
+	if len(leaf.EmailAddresses) > 0 {
+		return leaf.EmailAddresses[0], nil
+	}
+	if auth.IsValidEmail(leaf.Subject.CommonName) {
+		return leaf.Subject.CommonName, nil
+	}
+	return "", nil
+}
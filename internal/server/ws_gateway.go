@@ -0,0 +1,324 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsPongWait is how long a WebSocket may stay silent, pongs included,
+	// before it is considered dead
+	wsPongWait = 60 * time.Second
+	// wsPingPeriod is how often the gateway pings idle WebSockets; it must
+	// be shorter than wsPongWait
+	wsPingPeriod = wsPongWait * 9 / 10
+	// wsWriteWait bounds the time to send a ping
+	wsWriteWait = 10 * time.Second
+)
+
+// WebSocketGateway bridges browser WebSocket connections into the chat
+// server. Every WebSocket is handed to the TCP server's connection handler,
+// so browser users share sessions, rooms and routing with TCP users.
+//
+// Each incoming text frame is treated as one line of input and each line of
+// output is sent as one text frame. Idle connections are kept open through
+// proxies with pings.
+type WebSocketGateway struct {
+	port           string
+	path           string
+	core           *TCPServer
+	tlsConfig      *tls.Config
+	trustedProxies []*net.IPNet
+	upgrader       websocket.Upgrader
+	server         *http.Server
+}
+
+// NewWebSocketGateway creates a new WebSocket gateway. allowedOrigins lists
+// the Origin headers accepted from browsers ("*" accepts any origin); when it
+// is empty only same-origin requests are accepted. trustedProxies lists the
+// reverse proxy IPs and CIDR ranges whose X-Forwarded-For header is believed.
+func NewWebSocketGateway(port, path string, allowedOrigins, trustedProxies []string, tlsConfig *tls.Config, core *TCPServer) (*WebSocketGateway, error) {
+	proxies, err := parseTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &WebSocketGateway{
+		port:           port,
+		path:           path,
+		core:           core,
+		tlsConfig:      tlsConfig,
+		trustedProxies: proxies,
+	}
+	g.upgrader = websocket.Upgrader{
+		ReadBufferSize:  4096,
+		WriteBufferSize: 4096,
+	}
+	if len(allowedOrigins) > 0 {
+		g.upgrader.CheckOrigin = func(r *http.Request) bool {
+			return originAllowed(r.Header.Get("Origin"), allowedOrigins)
+		}
+	}
+	return g, nil
+}
+
+// parseTrustedProxies parses a list of IP addresses and CIDR ranges
+func parseTrustedProxies(list []string) ([]*net.IPNet, error) {
+	proxies := make([]*net.IPNet, 0, len(list))
+	for _, entry := range list {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy '%s'", entry)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy '%s'", entry)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// Start starts serving WebSocket connections
+func (g *WebSocketGateway) Start() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(g.path, g.handleUpgrade)
+
+	g.server = &http.Server{
+		Addr:              ":" + g.port,
+		Handler:           mux,
+		TLSConfig:         g.tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	listener, err := net.Listen("tcp", g.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start WebSocket gateway: %w", err)
+	}
+
+	if g.tlsConfig != nil {
+		log.Printf("WebSocket gateway started on port %s%s (TLS)", g.port, g.path)
+		err = g.server.ServeTLS(listener, "", "")
+	} else {
+		log.Printf("WebSocket gateway started on port %s%s", g.port, g.path)
+		err = g.server.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Stop stops the WebSocket gateway
+func (g *WebSocketGateway) Stop() error {
+	if g.server != nil {
+		return g.server.Close()
+	}
+	return nil
+}
+
+// handleUpgrade upgrades an HTTP request and hands the connection to the chat server
+func (g *WebSocketGateway) handleUpgrade(w http.ResponseWriter, r *http.Request) {
+	ws, err := g.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	// The HTTP server already runs each request in its own goroutine
+	g.core.ServeConn(newWSConn(ws, g.clientAddr(r)))
+}
+
+// clientAddr returns the address of the browser behind a request. Requests
+// from a trusted proxy are traced back through X-Forwarded-For, from the
+// right, to the first address not added by a trusted proxy; anyone else's
+// header is ignored, since clients can forge it.
+func (g *WebSocketGateway) clientAddr(r *http.Request) net.Addr {
+	addr := g.peerAddr(r)
+	if addr == nil || !g.trusted(addr.IP) {
+		return addr
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		addr = &net.TCPAddr{IP: ip}
+		if !g.trusted(ip) {
+			break
+		}
+	}
+	return addr
+}
+
+// peerAddr returns the address of the socket peer of a request
+func (g *WebSocketGateway) peerAddr(r *http.Request) *net.TCPAddr {
+	addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	return addr
+}
+
+// trusted reports whether an IP belongs to a trusted proxy
+func (g *WebSocketGateway) trusted(ip net.IP) bool {
+	for _, network := range g.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// originAllowed checks an Origin header against the allow-list
+func originAllowed(origin string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == "*" || strings.EqualFold(a, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// wsConn adapts a WebSocket connection to net.Conn using one text frame per line
+type wsConn struct {
+	ws         *websocket.Conn
+	remoteAddr net.Addr // the client, which may sit behind a proxy
+	readBuf    []byte
+	pending    []byte
+	writeMu    sync.Mutex
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// newWSConn wraps a WebSocket connection and starts pinging it. A connection
+// that sends nothing, not even a pong, for wsPongWait is dropped.
+func newWSConn(ws *websocket.Conn, remoteAddr net.Addr) *wsConn {
+	c := &wsConn{ws: ws, remoteAddr: remoteAddr, done: make(chan struct{})}
+	ws.SetReadDeadline(time.Now().Add(wsPongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go c.keepAlive()
+	return c
+}
+
+// keepAlive pings the client until the connection is closed
+func (c *wsConn) keepAlive() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			// A failed ping leaves the read deadline to end the connection
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Read returns the next frame(s) as newline terminated lines
+func (c *wsConn) Read(p []byte) (int, error) {
+	for len(c.readBuf) == 0 {
+		msgType, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.ws.SetReadDeadline(time.Now().Add(wsPongWait))
+		if msgType != websocket.TextMessage && msgType != websocket.BinaryMessage {
+			continue
+		}
+		if len(data) == 0 || data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+		c.readBuf = data
+	}
+
+	n := copy(p, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+// Write sends every complete line as its own text frame
+func (c *wsConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.pending = append(c.pending, p...)
+	for {
+		idx := bytes.IndexByte(c.pending, '\n')
+		if idx == -1 {
+			break
+		}
+		line := c.pending[:idx]
+		if err := c.ws.WriteMessage(websocket.TextMessage, line); err != nil {
+			return 0, err
+		}
+		c.pending = c.pending[idx+1:]
+	}
+	return len(p), nil
+}
+
+// Close stops the pings and closes the WebSocket connection
+func (c *wsConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return c.ws.Close()
+}
+
+// LocalAddr returns the local network address
+func (c *wsConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+// RemoteAddr returns the client's address: the socket peer, or the address
+// a trusted proxy forwarded for
+func (c *wsConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.ws.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
@@ -2,8 +2,13 @@ package session
 
 import (
 	"bufio"
+	"compress/flate"
+	"fmt"
 	"net"
+	"sort"
 	"sync"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
 )
 
 // State represents the authentication state of a session
@@ -18,6 +23,18 @@ const (
 	StateAuthenticated
 )
 
+// String returns the state's name
+func (s State) String() string {
+	switch s {
+	case StateAwaitingOTP:
+		return "awaiting-otp"
+	case StateAuthenticated:
+		return "authenticated"
+	default:
+		return "unauthenticated"
+	}
+}
+
 // Session represents a user session
 type Session struct {
 	Username string
@@ -28,10 +45,29 @@ type Session struct {
 	Writer   *bufio.Writer
 	Reader   *bufio.Reader
 
-	// Current context
+	// Current context: the joined rooms, in join order, and the one plain
+	// lines go to
+	Rooms           []string
 	CurrentRoom     string
 	PrivateChatWith string
 
+	// Protocol capabilities negotiated by the client (see protocol.CapJSON etc.)
+	caps    map[string]bool
+	deflate *flate.Writer
+
+	// stream is set for plain byte-stream transports, the only ones that can
+	// carry DEFLATE; message-framed front-ends (WebSocket, SSH) leave it unset
+	stream bool
+
+	// challenged is set when the user answered the authenticator's challenge
+	// on this connection, rather than resuming a session or being vouched
+	// for by the transport
+	challenged bool
+
+	// Optional encoder overriding the negotiated framing (used by
+	// front-ends that speak a different protocol, e.g. IRC)
+	encoder func(*protocol.Message) string
+
 	mu sync.RWMutex
 }
 
@@ -55,7 +91,147 @@ func (s *Session) Send(message string) error {
 	if err != nil {
 		return err
 	}
-	return s.Writer.Flush()
+	if err := s.Writer.Flush(); err != nil {
+		return err
+	}
+	if s.deflate != nil {
+		return s.deflate.Flush()
+	}
+	return nil
+}
+
+// SendMessage encodes a message using the session's negotiated framing and sends it
+func (s *Session) SendMessage(msg *protocol.Message) error {
+	s.mu.RLock()
+	encoder := s.encoder
+	s.mu.RUnlock()
+	if encoder != nil {
+		// An empty encoding means the front-end does not want this message
+		if line := encoder(msg); line != "" {
+			return s.Send(line)
+		}
+		return nil
+	}
+
+	if s.GetEncoding() == protocol.EncodingJSON {
+		return s.Send(msg.FormatJSON())
+	}
+	return s.Send(msg.FormatTagged(s.GetCurrentRoom(), s.HasCapability(protocol.CapServerTime), s.HasCapability(protocol.CapMessageID)))
+}
+
+// SetEncoder installs an encoder that replaces the negotiated framing
+func (s *Session) SetEncoder(encoder func(*protocol.Message) string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.encoder = encoder
+}
+
+// SetEncoding sets the wire encoding used for outgoing messages
+func (s *Session) SetEncoding(enc protocol.Encoding) {
+	s.SetCapability(protocol.CapJSON, enc == protocol.EncodingJSON)
+}
+
+// GetEncoding gets the wire encoding used for outgoing messages
+func (s *Session) GetEncoding() protocol.Encoding {
+	if s.HasCapability(protocol.CapJSON) {
+		return protocol.EncodingJSON
+	}
+	return protocol.EncodingText
+}
+
+// SetCapability enables or disables a negotiated capability
+func (s *Session) SetCapability(name string, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.caps == nil {
+		s.caps = make(map[string]bool)
+	}
+	if enabled {
+		s.caps[name] = true
+	} else {
+		delete(s.caps, name)
+	}
+}
+
+// HasCapability checks if a capability has been negotiated
+func (s *Session) HasCapability(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.caps[name]
+}
+
+// Capabilities returns the sorted list of negotiated capabilities
+func (s *Session) Capabilities() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	caps := make([]string, 0, len(s.caps))
+	for name := range s.caps {
+		caps = append(caps, name)
+	}
+	sort.Strings(caps)
+	return caps
+}
+
+// SetStream marks the connection as a plain byte stream
+func (s *Session) SetStream(stream bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stream = stream
+}
+
+// IsStream reports whether the connection is a plain byte stream
+func (s *Session) IsStream() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stream
+}
+
+// SetChallenged records that the user passed the authenticator's challenge
+// on this connection
+func (s *Session) SetChallenged() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.challenged = true
+}
+
+// Challenged reports whether the user passed the authenticator's challenge
+// on this connection
+func (s *Session) Challenged() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.challenged
+}
+
+// EnableCompression switches both directions of the connection to DEFLATE.
+// Anything already sent stays uncompressed, so callers must send the
+// acknowledgement first. Must be called from the goroutine reading the session.
+func (s *Session) EnableCompression() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.deflate != nil {
+		return nil
+	}
+	if !s.stream {
+		return fmt.Errorf("compression needs a stream transport")
+	}
+	if err := s.Writer.Flush(); err != nil {
+		return err
+	}
+
+	fw, err := flate.NewWriter(s.Conn, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	s.deflate = fw
+	s.Writer = bufio.NewWriter(fw)
+	s.Reader = bufio.NewReader(flate.NewReader(s.Reader))
+	if s.caps == nil {
+		s.caps = make(map[string]bool)
+	}
+	s.caps[protocol.CapDeflate] = true
+	return nil
 }
 
 // SetState sets the session state
@@ -93,6 +269,13 @@ func (s *Session) SetEmail(email string) {
 	s.Email = email
 }
 
+// GetEmail gets the email
+func (s *Session) GetEmail() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Email
+}
+
 // SetCurrentRoom sets the current room
 func (s *Session) SetCurrentRoom(room string) {
 	s.mu.Lock()
@@ -107,6 +290,56 @@ func (s *Session) GetCurrentRoom() string {
 	return s.CurrentRoom
 }
 
+// AddRoom records that the session joined a room
+func (s *Session) AddRoom(room string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range s.Rooms {
+		if name == room {
+			return
+		}
+	}
+	s.Rooms = append(s.Rooms, room)
+}
+
+// RemoveRoom records that the session left a room. If it was the current
+// room, the most recently joined remaining room becomes current.
+func (s *Session) RemoveRoom(room string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, name := range s.Rooms {
+		if name == room {
+			s.Rooms = append(s.Rooms[:i:i], s.Rooms[i+1:]...)
+			break
+		}
+	}
+	if s.CurrentRoom == room {
+		s.CurrentRoom = ""
+		if len(s.Rooms) > 0 {
+			s.CurrentRoom = s.Rooms[len(s.Rooms)-1]
+		}
+	}
+}
+
+// GetRooms returns the joined rooms in join order
+func (s *Session) GetRooms() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.Rooms...)
+}
+
+// InRoom checks if the session has joined a room
+func (s *Session) InRoom(room string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, name := range s.Rooms {
+		if name == room {
+			return true
+		}
+	}
+	return false
+}
+
 // SetPrivateChat sets the private chat partner
 func (s *Session) SetPrivateChat(username string) {
 	s.mu.Lock()
@@ -0,0 +1,462 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+)
+
+// Bucket names
+var (
+	bucketAccounts  = []byte("accounts")  // lowercase email -> Account JSON
+	bucketUsernames = []byte("usernames") // lowercase username -> lowercase email
+	bucketRooms     = []byte("rooms")     // room name -> RoomInfo JSON
+	bucketHistory   = []byte("history")   // room name -> bucket of message ID -> Message JSON
+	bucketInbox     = []byte("inbox")     // lowercase recipient -> bucket of message ID -> Message JSON
+	bucketBans      = []byte("bans")      // lowercase target -> Ban JSON
+)
+
+// BoltStore keeps everything in an embedded bbolt database file
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (or creates) the database at path
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketAccounts, bucketUsernames, bucketRooms, bucketHistory, bucketInbox, bucketBans} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise database: %w", err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// GetAccount returns the account registered to an email
+func (s *BoltStore) GetAccount(email string) (*Account, error) {
+	var acct *Account
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		acct, err = getAccount(tx, strings.ToLower(email))
+		return err
+	})
+	return acct, err
+}
+
+// GetAccountByUsername returns the account owning a username
+func (s *BoltStore) GetAccountByUsername(username string) (*Account, error) {
+	var acct *Account
+	err := s.db.View(func(tx *bolt.Tx) error {
+		email := tx.Bucket(bucketUsernames).Get([]byte(strings.ToLower(username)))
+		if email == nil {
+			return ErrNotFound
+		}
+		var err error
+		acct, err = getAccount(tx, string(email))
+		return err
+	})
+	return acct, err
+}
+
+// CreateAccount stores a new account
+func (s *BoltStore) CreateAccount(acct *Account) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		email := []byte(strings.ToLower(acct.Email))
+		username := []byte(strings.ToLower(acct.Username))
+		if tx.Bucket(bucketAccounts).Get(email) != nil {
+			return ErrEmailTaken
+		}
+		if tx.Bucket(bucketUsernames).Get(username) != nil {
+			return ErrUsernameTaken
+		}
+		if err := tx.Bucket(bucketUsernames).Put(username, email); err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(bucketAccounts), email, acct)
+	})
+}
+
+// UpdateAccount replaces an existing account
+func (s *BoltStore) UpdateAccount(acct *Account) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		email := []byte(strings.ToLower(acct.Email))
+		if tx.Bucket(bucketAccounts).Get(email) == nil {
+			return ErrNotFound
+		}
+		return putJSON(tx.Bucket(bucketAccounts), email, acct)
+	})
+}
+
+// CountAccounts returns the number of registered accounts
+func (s *BoltStore) CountAccounts() (int, error) {
+	var count int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(bucketAccounts).Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
+// SaveRoom creates or replaces a room
+func (s *BoltStore) SaveRoom(room *RoomInfo) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketRooms), []byte(room.Name), room)
+	})
+}
+
+// DeleteRoom removes a room and its history
+func (s *BoltStore) DeleteRoom(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bucketRooms).Delete([]byte(name)); err != nil {
+			return err
+		}
+		err := tx.Bucket(bucketHistory).DeleteBucket([]byte(name))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// ListRooms returns every stored room, sorted by name
+func (s *BoltStore) ListRooms() ([]*RoomInfo, error) {
+	rooms := make([]*RoomInfo, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketRooms).ForEach(func(_, v []byte) error {
+			var room RoomInfo
+			if err := json.Unmarshal(v, &room); err != nil {
+				return err
+			}
+			rooms = append(rooms, &room)
+			return nil
+		})
+	})
+	return rooms, err
+}
+
+// AppendMessage adds a message to its room's history. Writes are batched
+// so busy rooms don't pay for one fsync per message.
+func (s *BoltStore) AppendMessage(msg *protocol.Message) error {
+	key, err := messageKey(msg.ID)
+	if err != nil {
+		return err
+	}
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(bucketHistory).CreateBucketIfNotExists([]byte(msg.Room))
+		if err != nil {
+			return err
+		}
+		return putJSON(bucket, key, msg)
+	})
+}
+
+// MessagesSince returns a room's messages newer than since, oldest first.
+// Message IDs start from the unix-microsecond send time, so the scan can
+// seek straight to the first candidate.
+func (s *BoltStore) MessagesSince(room string, since time.Time) ([]*protocol.Message, error) {
+	messages := make([]*protocol.Message, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketHistory).Bucket([]byte(room))
+		if bucket == nil {
+			return nil
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.Seek(encodeKey(since.UnixMicro())); k != nil; k, v = c.Next() {
+			var msg protocol.Message
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			if msg.Timestamp.After(since) {
+				messages = append(messages, &msg)
+			}
+		}
+		return nil
+	})
+	return messages, err
+}
+
+// MessagesBefore returns up to limit of a room's newest messages with an ID
+// below beforeID, oldest first
+func (s *BoltStore) MessagesBefore(room, beforeID string, limit int) ([]*protocol.Message, error) {
+	var before []byte
+	if beforeID != "" {
+		var err error
+		if before, err = messageKey(beforeID); err != nil {
+			return nil, err
+		}
+	}
+
+	messages := make([]*protocol.Message, 0, limit)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketHistory).Bucket([]byte(room))
+		if bucket == nil {
+			return nil
+		}
+
+		// Position on the newest message below the bound and walk backwards
+		c := bucket.Cursor()
+		var k, v []byte
+		if before == nil {
+			k, v = c.Last()
+		} else if k, _ = c.Seek(before); k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil && len(messages) < limit; k, v = c.Prev() {
+			var msg protocol.Message
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			messages = append(messages, &msg)
+		}
+		return nil
+	})
+
+	// Collected newest first
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, err
+}
+
+// PruneMessages deletes a room's messages by age and count
+func (s *BoltStore) PruneMessages(room string, keep int, olderThan time.Time) (int, error) {
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketHistory).Bucket([]byte(room))
+		if bucket == nil {
+			return nil
+		}
+
+		// Keys are in send order, so everything to drop is at the front
+		drop := 0
+		if !olderThan.IsZero() {
+			cutoff := encodeKey(olderThan.UnixMicro())
+			c := bucket.Cursor()
+			for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.Next() {
+				drop++
+			}
+		}
+		if total := bucket.Stats().KeyN; keep > 0 && total-drop > keep {
+			drop = total - keep
+		}
+
+		keys := make([][]byte, 0, drop)
+		c := bucket.Cursor()
+		for k, _ := c.First(); k != nil && len(keys) < drop; k, _ = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		deleted = len(keys)
+		return nil
+	})
+	return deleted, err
+}
+
+// ForEachMessage calls fn for every stored message
+func (s *BoltStore) ForEachMessage(fn func(msg *protocol.Message) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		history := tx.Bucket(bucketHistory)
+		return history.ForEachBucket(func(room []byte) error {
+			return history.Bucket(room).ForEach(func(_, v []byte) error {
+				var msg protocol.Message
+				if err := json.Unmarshal(v, &msg); err != nil {
+					return err
+				}
+				return fn(&msg)
+			})
+		})
+	})
+}
+
+// QueueMessage adds a direct message to the inbox of msg.To
+func (s *BoltStore) QueueMessage(msg *protocol.Message) error {
+	key, err := messageKey(msg.ID)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(bucketInbox).CreateBucketIfNotExists([]byte(strings.ToLower(msg.To)))
+		if err != nil {
+			return err
+		}
+		return putJSON(bucket, key, msg)
+	})
+}
+
+// Inbox returns the messages queued for a user, oldest first
+func (s *BoltStore) Inbox(username string) ([]*protocol.Message, error) {
+	messages := make([]*protocol.Message, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketInbox).Bucket([]byte(strings.ToLower(username)))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var msg protocol.Message
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			messages = append(messages, &msg)
+			return nil
+		})
+	})
+	return messages, err
+}
+
+// ClearInbox deletes a user's queued messages up to and including throughID
+func (s *BoltStore) ClearInbox(username, throughID string) error {
+	through, err := messageKey(throughID)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		inbox := tx.Bucket(bucketInbox)
+		name := []byte(strings.ToLower(username))
+		bucket := inbox.Bucket(name)
+		if bucket == nil {
+			return nil
+		}
+
+		keys := make([][]byte, 0)
+		c := bucket.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, through) <= 0; k, _ = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		if k, _ := bucket.Cursor().First(); k == nil {
+			return inbox.DeleteBucket(name)
+		}
+		return nil
+	})
+}
+
+// QueuedBy returns the queued messages sent by a user, oldest first
+func (s *BoltStore) QueuedBy(sender string) ([]*protocol.Message, error) {
+	queued := make([]*protocol.Message, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		inbox := tx.Bucket(bucketInbox)
+		return inbox.ForEachBucket(func(name []byte) error {
+			return inbox.Bucket(name).ForEach(func(_, v []byte) error {
+				var msg protocol.Message
+				if err := json.Unmarshal(v, &msg); err != nil {
+					return err
+				}
+				if strings.EqualFold(msg.From, sender) {
+					queued = append(queued, &msg)
+				}
+				return nil
+			})
+		})
+	})
+	sort.Slice(queued, func(i, j int) bool { return CompareIDs(queued[i].ID, queued[j].ID) < 0 })
+	return queued, err
+}
+
+// SaveBan creates or replaces a server-wide ban
+func (s *BoltStore) SaveBan(ban *Ban) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketBans), []byte(strings.ToLower(ban.Target)), ban)
+	})
+}
+
+// DeleteBan lifts the server-wide ban of a target
+func (s *BoltStore) DeleteBan(target string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketBans).Delete([]byte(strings.ToLower(target)))
+	})
+}
+
+// ListBans returns every server-wide ban
+func (s *BoltStore) ListBans() ([]*Ban, error) {
+	bans := make([]*Ban, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketBans).ForEach(func(_, v []byte) error {
+			var ban Ban
+			if err := json.Unmarshal(v, &ban); err != nil {
+				return err
+			}
+			bans = append(bans, &ban)
+			return nil
+		})
+	})
+	return bans, err
+}
+
+// Persistent reports true: data is kept on disk
+func (s *BoltStore) Persistent() bool {
+	return true
+}
+
+// Close closes the database
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// getAccount loads an account by lowercase email
+func getAccount(tx *bolt.Tx, email string) (*Account, error) {
+	data := tx.Bucket(bucketAccounts).Get([]byte(email))
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	var acct Account
+	if err := json.Unmarshal(data, &acct); err != nil {
+		return nil, err
+	}
+	return &acct, nil
+}
+
+// putJSON stores v as JSON under key
+func putJSON(bucket *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+// messageKey converts a numeric message ID into a sortable key
+func messageKey(id string) ([]byte, error) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message ID '%s'", id)
+	}
+	return encodeKey(n), nil
+}
+
+// encodeKey encodes n big-endian so byte order matches numeric order
+func encodeKey(n int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(n))
+	return key
+}
@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+)
+
+// memoryHistoryLimit bounds the number of messages kept per room
+const memoryHistoryLimit = 1000
+
+// MemoryStore keeps everything in memory; all data is lost on restart
+type MemoryStore struct {
+	accounts  map[string]*Account // key: lowercase email
+	usernames map[string]string   // key: lowercase username, value: lowercase email
+	rooms     map[string]*RoomInfo
+	history   map[string][]*protocol.Message // key: room name
+	inboxes   map[string][]*protocol.Message // key: lowercase recipient
+	bans      map[string]*Ban                // key: lowercase target
+	mu        sync.RWMutex
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts:  make(map[string]*Account),
+		usernames: make(map[string]string),
+		rooms:     make(map[string]*RoomInfo),
+		history:   make(map[string][]*protocol.Message),
+		inboxes:   make(map[string][]*protocol.Message),
+		bans:      make(map[string]*Ban),
+	}
+}
+
+// GetAccount returns the account registered to an email
+func (s *MemoryStore) GetAccount(email string) (*Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	acct, exists := s.accounts[strings.ToLower(email)]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	copied := *acct
+	return &copied, nil
+}
+
+// GetAccountByUsername returns the account owning a username
+func (s *MemoryStore) GetAccountByUsername(username string) (*Account, error) {
+	s.mu.RLock()
+	email, exists := s.usernames[strings.ToLower(username)]
+	s.mu.RUnlock()
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return s.GetAccount(email)
+}
+
+// CreateAccount stores a new account
+func (s *MemoryStore) CreateAccount(acct *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email := strings.ToLower(acct.Email)
+	username := strings.ToLower(acct.Username)
+	if _, exists := s.accounts[email]; exists {
+		return ErrEmailTaken
+	}
+	if _, exists := s.usernames[username]; exists {
+		return ErrUsernameTaken
+	}
+
+	copied := *acct
+	s.accounts[email] = &copied
+	s.usernames[username] = email
+	return nil
+}
+
+// UpdateAccount replaces an existing account
+func (s *MemoryStore) UpdateAccount(acct *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email := strings.ToLower(acct.Email)
+	if _, exists := s.accounts[email]; !exists {
+		return ErrNotFound
+	}
+	copied := *acct
+	s.accounts[email] = &copied
+	return nil
+}
+
+// CountAccounts returns the number of registered accounts
+func (s *MemoryStore) CountAccounts() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.accounts), nil
+}
+
+// SaveRoom creates or replaces a room
+func (s *MemoryStore) SaveRoom(room *RoomInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *room
+	s.rooms[room.Name] = &copied
+	return nil
+}
+
+// DeleteRoom removes a room and its history
+func (s *MemoryStore) DeleteRoom(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.rooms, name)
+	delete(s.history, name)
+	return nil
+}
+
+// ListRooms returns every stored room, sorted by name
+func (s *MemoryStore) ListRooms() ([]*RoomInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rooms := make([]*RoomInfo, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		copied := *room
+		rooms = append(rooms, &copied)
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Name < rooms[j].Name })
+	return rooms, nil
+}
+
+// AppendMessage adds a message to its room's history, dropping the oldest
+// messages beyond memoryHistoryLimit
+func (s *MemoryStore) AppendMessage(msg *protocol.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Concurrent senders may arrive slightly out of order; keep ID order
+	history := s.history[msg.Room]
+	i := sort.Search(len(history), func(i int) bool {
+		return CompareIDs(history[i].ID, msg.ID) > 0
+	})
+	history = append(history, nil)
+	copy(history[i+1:], history[i:])
+	history[i] = msg
+	if len(history) > memoryHistoryLimit {
+		history = history[len(history)-memoryHistoryLimit:]
+	}
+	s.history[msg.Room] = history
+	return nil
+}
+
+// MessagesSince returns a room's messages newer than since, oldest first
+func (s *MemoryStore) MessagesSince(room string, since time.Time) ([]*protocol.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := s.history[room]
+	start := sort.Search(len(history), func(i int) bool {
+		return history[i].Timestamp.After(since)
+	})
+	return append([]*protocol.Message(nil), history[start:]...), nil
+}
+
+// MessagesBefore returns up to limit of a room's newest messages with an ID
+// below beforeID, oldest first
+func (s *MemoryStore) MessagesBefore(room, beforeID string, limit int) ([]*protocol.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := s.history[room]
+	end := len(history)
+	if beforeID != "" {
+		end = sort.Search(len(history), func(i int) bool {
+			return CompareIDs(history[i].ID, beforeID) >= 0
+		})
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	return append([]*protocol.Message(nil), history[start:end]...), nil
+}
+
+// PruneMessages deletes a room's messages by age and count
+func (s *MemoryStore) PruneMessages(room string, keep int, olderThan time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := s.history[room]
+	start := 0
+	if !olderThan.IsZero() {
+		start = sort.Search(len(history), func(i int) bool {
+			return !history[i].Timestamp.Before(olderThan)
+		})
+	}
+	if keep > 0 && len(history)-start > keep {
+		start = len(history) - keep
+	}
+	if start > 0 {
+		s.history[room] = append([]*protocol.Message(nil), history[start:]...)
+	}
+	return start, nil
+}
+
+// ForEachMessage calls fn for every stored message
+func (s *MemoryStore) ForEachMessage(fn func(msg *protocol.Message) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, history := range s.history {
+		for _, msg := range history {
+			if err := fn(msg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// QueueMessage adds a direct message to the inbox of msg.To
+func (s *MemoryStore) QueueMessage(msg *protocol.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recipient := strings.ToLower(msg.To)
+	s.inboxes[recipient] = append(s.inboxes[recipient], msg)
+	return nil
+}
+
+// Inbox returns the messages queued for a user, oldest first
+func (s *MemoryStore) Inbox(username string) ([]*protocol.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*protocol.Message(nil), s.inboxes[strings.ToLower(username)]...), nil
+}
+
+// ClearInbox deletes a user's queued messages up to and including throughID
+func (s *MemoryStore) ClearInbox(username, throughID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recipient := strings.ToLower(username)
+	remaining := make([]*protocol.Message, 0)
+	for _, msg := range s.inboxes[recipient] {
+		if CompareIDs(msg.ID, throughID) > 0 {
+			remaining = append(remaining, msg)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(s.inboxes, recipient)
+	} else {
+		s.inboxes[recipient] = remaining
+	}
+	return nil
+}
+
+// QueuedBy returns the queued messages sent by a user, oldest first
+func (s *MemoryStore) QueuedBy(sender string) ([]*protocol.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	queued := make([]*protocol.Message, 0)
+	for _, inbox := range s.inboxes {
+		for _, msg := range inbox {
+			if strings.EqualFold(msg.From, sender) {
+				queued = append(queued, msg)
+			}
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool { return CompareIDs(queued[i].ID, queued[j].ID) < 0 })
+	return queued, nil
+}
+
+// SaveBan creates or replaces a server-wide ban
+func (s *MemoryStore) SaveBan(ban *Ban) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *ban
+	s.bans[strings.ToLower(ban.Target)] = &copied
+	return nil
+}
+
+// DeleteBan lifts the server-wide ban of a target
+func (s *MemoryStore) DeleteBan(target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.bans, strings.ToLower(target))
+	return nil
+}
+
+// ListBans returns every server-wide ban
+func (s *MemoryStore) ListBans() ([]*Ban, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bans := make([]*Ban, 0, len(s.bans))
+	for _, ban := range s.bans {
+		copied := *ban
+		bans = append(bans, &copied)
+	}
+	return bans, nil
+}
+
+// Persistent reports false: nothing survives a restart
+func (s *MemoryStore) Persistent() bool {
+	return false
+}
+
+// Close is a no-op
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+)
+
+// MaxReplayMessages caps the history replayed by any policy
+const MaxReplayMessages = 500
+
+// Replay limits the history replayed to members joining a room. The zero
+// value replays nothing.
+type Replay struct {
+	// MaxMessages replays at most this many of the newest messages
+	// (0 = no count limit)
+	MaxMessages int `json:"max_messages,omitempty"`
+	// MaxAge only replays messages newer than this (0 = no age limit)
+	MaxAge time.Duration `json:"max_age,omitempty"`
+}
+
+// ParseReplay parses a replay policy: "none", a message count ("50"), an age
+// ("5m", "1d") or both separated by a comma ("50,1h")
+func ParseReplay(spec string) (Replay, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "none" {
+		return Replay{}, nil
+	}
+
+	count, age, err := parseLimits(spec)
+	if err != nil {
+		return Replay{}, fmt.Errorf("invalid replay policy: %w (expected none, a message count like 50, an age like 5m, or both)", err)
+	}
+	return Replay{MaxMessages: count, MaxAge: age}, nil
+}
+
+// None reports whether the policy replays nothing
+func (r Replay) None() bool {
+	return r.MaxMessages <= 0 && r.MaxAge <= 0
+}
+
+// String describes the policy, e.g. "last 50 messages, 1h"
+func (r Replay) String() string {
+	if r.None() {
+		return "none"
+	}
+	return describeLimits(r.MaxMessages, r.MaxAge)
+}
+
+// Load returns the history of a room or ConversationKey selected by the
+// policy, oldest first
+func (r Replay) Load(store Store, key string) ([]*protocol.Message, error) {
+	if r.None() {
+		return nil, nil
+	}
+
+	limit := r.MaxMessages
+	if limit <= 0 || limit > MaxReplayMessages {
+		limit = MaxReplayMessages
+	}
+	history, err := store.MessagesBefore(key, "", limit)
+	if err != nil {
+		return nil, err
+	}
+	if r.MaxAge > 0 {
+		cutoff := time.Now().Add(-r.MaxAge)
+		for len(history) > 0 && history[0].Timestamp.Before(cutoff) {
+			history = history[1:]
+		}
+	}
+	return history, nil
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+)
+
+func TestParseReplay(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Replay
+		wantErr bool
+	}{
+		{spec: "none", want: Replay{}},
+		{spec: " NONE ", want: Replay{}},
+		{spec: "50", want: Replay{MaxMessages: 50}},
+		{spec: "5m", want: Replay{MaxAge: 5 * time.Minute}},
+		{spec: "1d", want: Replay{MaxAge: 24 * time.Hour}},
+		{spec: "50,1h", want: Replay{MaxMessages: 50, MaxAge: time.Hour}},
+		{spec: "", wantErr: true},
+		{spec: "forever", wantErr: true},
+		{spec: "0", wantErr: true},
+		{spec: "0m", wantErr: true},
+		{spec: "50,lots", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseReplay(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseReplay(%q) = %+v, want an error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseReplay(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseReplay(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestReplayLoad(t *testing.T) {
+	store := NewMemoryStore()
+	store.AppendMessage(datedMessage("#r", "old", time.Now().Add(-2*time.Hour)))
+	for _, content := range []string{"one", "two", "three"} {
+		msg := protocol.NewChatMessage("alice", content)
+		msg.Room = "#r"
+		store.AppendMessage(msg)
+	}
+
+	tests := []struct {
+		replay Replay
+		want   []string
+	}{
+		{Replay{}, nil},
+		{Replay{MaxMessages: 2}, []string{"two", "three"}},
+		{Replay{MaxAge: time.Hour}, []string{"one", "two", "three"}},
+		{Replay{MaxMessages: 10, MaxAge: 3 * time.Hour}, []string{"old", "one", "two", "three"}},
+		{Replay{MaxMessages: 1, MaxAge: time.Hour}, []string{"three"}},
+	}
+
+	for _, tt := range tests {
+		history, err := tt.replay.Load(store, "#r")
+		if err != nil {
+			t.Fatalf("%v.Load: %v", tt.replay, err)
+		}
+		if got := contents(history); !equalStrings(got, tt.want) {
+			t.Errorf("%v.Load = %q, want %q", tt.replay, got, tt.want)
+		}
+	}
+}
+
+// contents returns the content of each message
+func contents(messages []*protocol.Message) []string {
+	var out []string
+	for _, msg := range messages {
+		out = append(out, msg.Content)
+	}
+	return out
+}
+
+// equalStrings reports whether two string slices hold the same elements in order
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
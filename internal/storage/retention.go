@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retention limits how much history a room keeps. The zero value keeps
+// everything forever.
+type Retention struct {
+	// MaxMessages keeps only the newest messages (0 = no limit)
+	MaxMessages int `json:"max_messages,omitempty"`
+	// MaxAge drops messages older than this (0 = no limit)
+	MaxAge time.Duration `json:"max_age,omitempty"`
+}
+
+// ParseRetention parses a retention policy: "forever", a message count
+// ("500"), an age ("30d", "12h") or both separated by a comma ("500,30d")
+func ParseRetention(spec string) (Retention, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "" || spec == "forever" {
+		return Retention{}, nil
+	}
+
+	count, age, err := parseLimits(spec)
+	if err != nil {
+		return Retention{}, fmt.Errorf("invalid retention: %w (expected forever, a message count like 500, an age like 30d, or both)", err)
+	}
+	return Retention{MaxMessages: count, MaxAge: age}, nil
+}
+
+// parseLimits parses a message count, an age or both separated by a comma
+func parseLimits(spec string) (int, time.Duration, error) {
+	var count int
+	var age time.Duration
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if n, err := strconv.Atoi(part); err == nil {
+			if n <= 0 {
+				return 0, 0, fmt.Errorf("message count must be positive")
+			}
+			count = n
+			continue
+		}
+
+		d, err := ParseAge(part)
+		if err != nil || d <= 0 {
+			return 0, 0, fmt.Errorf("'%s' is neither a count nor an age", part)
+		}
+		age = d
+	}
+	return count, age, nil
+}
+
+// ParseAge parses a duration, additionally accepting days ("30d")
+func ParseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Forever reports whether the policy keeps everything
+func (r Retention) Forever() bool {
+	return r.MaxMessages <= 0 && r.MaxAge <= 0
+}
+
+// String describes the policy, e.g. "last 500 messages, 30d"
+func (r Retention) String() string {
+	if r.Forever() {
+		return "forever"
+	}
+
+	return describeLimits(r.MaxMessages, r.MaxAge)
+}
+
+// describeLimits describes a message count and age, e.g. "last 500
+// messages, 30d"
+func describeLimits(count int, age time.Duration) string {
+	parts := make([]string, 0, 2)
+	if count > 0 {
+		parts = append(parts, fmt.Sprintf("last %d messages", count))
+	}
+	if age > 0 {
+		parts = append(parts, formatAge(age))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatAge formats an age the way ParseAge accepts it, e.g. "30d" or "5m"
+func formatAge(age time.Duration) string {
+	if age%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", age/(24*time.Hour))
+	}
+	s := age.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Retention
+		wantErr bool
+	}{
+		{spec: "", want: Retention{}},
+		{spec: "forever", want: Retention{}},
+		{spec: " Forever ", want: Retention{}},
+		{spec: "500", want: Retention{MaxMessages: 500}},
+		{spec: "30d", want: Retention{MaxAge: 30 * 24 * time.Hour}},
+		{spec: "12h", want: Retention{MaxAge: 12 * time.Hour}},
+		{spec: "500,30d", want: Retention{MaxMessages: 500, MaxAge: 30 * 24 * time.Hour}},
+		{spec: "30d, 500", want: Retention{MaxMessages: 500, MaxAge: 30 * 24 * time.Hour}},
+		{spec: "0", wantErr: true},
+		{spec: "-5", wantErr: true},
+		{spec: "0d", wantErr: true},
+		{spec: "-1h", wantErr: true},
+		{spec: "soon", wantErr: true},
+		{spec: "500,", wantErr: true},
+		{spec: "none", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRetention(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseRetention(%q) = %+v, want an error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRetention(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRetention(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestRetentionStringRoundTrip(t *testing.T) {
+	tests := []struct {
+		retention Retention
+		want      string
+	}{
+		{Retention{}, "forever"},
+		{Retention{MaxMessages: 500}, "last 500 messages"},
+		{Retention{MaxAge: 30 * 24 * time.Hour}, "30d"},
+		{Retention{MaxAge: 90 * time.Minute}, "1h30m"},
+		{Retention{MaxMessages: 50, MaxAge: 12 * time.Hour}, "last 50 messages, 12h"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.retention.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.retention, got, tt.want)
+		}
+		// Ages are printed the way ParseAge reads them
+		if tt.retention.MaxAge > 0 {
+			age, err := ParseAge(formatAge(tt.retention.MaxAge))
+			if err != nil || age != tt.retention.MaxAge {
+				t.Errorf("ParseAge(formatAge(%v)) = %v, %v", tt.retention.MaxAge, age, err)
+			}
+		}
+	}
+}
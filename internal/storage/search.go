@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+)
+
+// SearchQuery selects messages for IndexedStore.Search
+type SearchQuery struct {
+	// Text is matched word by word; every word must prefix a word of the
+	// message, so "deploy" also finds "deploys"
+	Text string
+	// From limits results to one sender (optional, case-insensitive)
+	From string
+	// Since drops messages sent before this time (optional)
+	Since time.Time
+	// Allowed reports whether messages of a room or ConversationKey may be
+	// returned; nil allows everything
+	Allowed func(key string) bool
+	// Limit caps the number of results (0 = no limit)
+	Limit int
+}
+
+// IndexedStore wraps a Store with an in-memory full-text index over the
+// stored chat and direct messages. System notices are not indexed, but count
+// towards the limits like they do in the backend.
+//
+// The index holds every message it covers with its words, so it costs about
+// as much memory as the messages themselves. It only covers the newest limit
+// messages of each room and conversation; older ones stay in the backend but
+// are no longer found by Search.
+type IndexedStore struct {
+	Store
+
+	messages map[string][]*protocol.Message            // key: room or conversation, in ID order; all types
+	postings map[string]map[*protocol.Message]struct{} // key: word
+	terms    []string                                  // the words of postings, sorted for prefix lookups
+	limit    int                                       // messages indexed per room or conversation; 0 = all
+	mu       sync.RWMutex
+}
+
+// NewIndexedStore indexes the newest limit messages of each room and
+// conversation already kept in backend, and of those stored later. A limit
+// of 0 indexes everything the backend keeps.
+func NewIndexedStore(backend Store, limit int) (*IndexedStore, error) {
+	// Memory backends drop older messages themselves
+	if !backend.Persistent() && (limit == 0 || limit > memoryHistoryLimit) {
+		limit = memoryHistoryLimit
+	}
+
+	s := &IndexedStore{
+		Store:    backend,
+		messages: make(map[string][]*protocol.Message),
+		postings: make(map[string]map[*protocol.Message]struct{}),
+		limit:    limit,
+	}
+
+	err := backend.ForEachMessage(func(msg *protocol.Message) error {
+		s.add(msg)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build search index: %w", err)
+	}
+	return s, nil
+}
+
+// AppendMessage stores and indexes a message
+func (s *IndexedStore) AppendMessage(msg *protocol.Message) error {
+	if err := s.Store.AppendMessage(msg); err != nil {
+		return err
+	}
+	s.add(msg)
+	return nil
+}
+
+// PruneMessages deletes messages from the backend and the index
+func (s *IndexedStore) PruneMessages(room string, keep int, olderThan time.Time) (int, error) {
+	deleted, err := s.Store.PruneMessages(room, keep, olderThan)
+	if err != nil {
+		return deleted, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := s.messages[room]
+	start := 0
+	if !olderThan.IsZero() {
+		start = sort.Search(len(messages), func(i int) bool {
+			return !messages[i].Timestamp.Before(olderThan)
+		})
+	}
+	if keep > 0 && len(messages)-start > keep {
+		start = len(messages) - keep
+	}
+	s.remove(messages[:start])
+	s.messages[room] = append([]*protocol.Message(nil), messages[start:]...)
+	return deleted, nil
+}
+
+// DeleteRoom deletes a room and drops its history from the index
+func (s *IndexedStore) DeleteRoom(name string) error {
+	if err := s.Store.DeleteRoom(name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(s.messages[name])
+	delete(s.messages, name)
+	return nil
+}
+
+// Search returns the messages matching query, newest first
+func (s *IndexedStore) Search(query SearchQuery) []*protocol.Message {
+	words := tokenize(query.Text)
+	if len(words) == 0 {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Intersect the messages matching each word, starting with the first
+	var candidates map[*protocol.Message]struct{}
+	for _, word := range words {
+		matches := s.matching(word)
+		if candidates == nil {
+			candidates = matches
+			continue
+		}
+		for msg := range candidates {
+			if _, ok := matches[msg]; !ok {
+				delete(candidates, msg)
+			}
+		}
+	}
+
+	results := make([]*protocol.Message, 0, len(candidates))
+	for msg := range candidates {
+		if query.From != "" && !strings.EqualFold(msg.From, query.From) {
+			continue
+		}
+		if !query.Since.IsZero() && msg.Timestamp.Before(query.Since) {
+			continue
+		}
+		if query.Allowed != nil && !query.Allowed(msg.Room) {
+			continue
+		}
+		results = append(results, msg)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return CompareIDs(results[i].ID, results[j].ID) > 0
+	})
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+	return results
+}
+
+// matching returns the set of messages containing a word starting with
+// prefix. The caller must hold the lock.
+func (s *IndexedStore) matching(prefix string) map[*protocol.Message]struct{} {
+	matches := make(map[*protocol.Message]struct{})
+	// The words starting with prefix sort together, right from prefix on
+	for i := sort.SearchStrings(s.terms, prefix); i < len(s.terms) && strings.HasPrefix(s.terms[i], prefix); i++ {
+		for msg := range s.postings[s.terms[i]] {
+			matches[msg] = struct{}{}
+		}
+	}
+	return matches
+}
+
+// searchable reports whether a message's words are indexed
+func searchable(msg *protocol.Message) bool {
+	return msg.Type == protocol.MessageTypeChat || msg.Type == protocol.MessageTypePrivate
+}
+
+// add indexes a message. Every message is counted so the index trims
+// exactly what the backend trims; only searchable ones get postings.
+func (s *IndexedStore) add(msg *protocol.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Keep ID order; concurrent senders may arrive slightly out of order
+	messages := s.messages[msg.Room]
+	i := sort.Search(len(messages), func(i int) bool {
+		return CompareIDs(messages[i].ID, msg.ID) > 0
+	})
+	messages = append(messages, nil)
+	copy(messages[i+1:], messages[i:])
+	messages[i] = msg
+
+	s.messages[msg.Room] = messages
+
+	if !searchable(msg) {
+		s.trim(msg.Room)
+		return
+	}
+	for _, word := range tokenize(msg.Content) {
+		if s.postings[word] == nil {
+			s.postings[word] = make(map[*protocol.Message]struct{})
+			i, _ := slices.BinarySearch(s.terms, word)
+			s.terms = slices.Insert(s.terms, i, word)
+		}
+		s.postings[word][msg] = struct{}{}
+	}
+	s.trim(msg.Room)
+}
+
+// trim forgets the oldest messages of a room or conversation beyond the
+// limit. The caller must hold the lock.
+func (s *IndexedStore) trim(key string) {
+	messages := s.messages[key]
+	if s.limit > 0 && len(messages) > s.limit {
+		dropped := len(messages) - s.limit
+		s.remove(messages[:dropped])
+		s.messages[key] = append([]*protocol.Message(nil), messages[dropped:]...)
+	}
+}
+
+// remove drops messages from the postings. The caller must hold the lock.
+func (s *IndexedStore) remove(messages []*protocol.Message) {
+	for _, msg := range messages {
+		if !searchable(msg) {
+			continue
+		}
+		for _, word := range tokenize(msg.Content) {
+			delete(s.postings[word], msg)
+			if len(s.postings[word]) == 0 {
+				delete(s.postings, word)
+				if i, found := slices.BinarySearch(s.terms, word); found {
+					s.terms = slices.Delete(s.terms, i, i+1)
+				}
+			}
+		}
+	}
+}
+
+// tokenize splits text into unique lowercase words of letters and digits
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]bool, len(fields))
+	words := fields[:0]
+	for _, word := range fields {
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
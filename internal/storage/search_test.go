@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+)
+
+// newTestIndex returns an index over a fresh bolt store, which keeps every
+// message, so limit is the only bound
+func newTestIndex(t *testing.T, limit int) *IndexedStore {
+	t.Helper()
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "chat.db"))
+	if err != nil {
+		t.Fatalf("NewBoltStore: %v", err)
+	}
+	t.Cleanup(func() { bolt.Close() })
+	index, err := NewIndexedStore(bolt, limit)
+	if err != nil {
+		t.Fatalf("NewIndexedStore: %v", err)
+	}
+	return index
+}
+
+// appendChat stores a chat message from a user in a room
+func appendChat(t *testing.T, store Store, room, from, content string) *protocol.Message {
+	t.Helper()
+	msg := protocol.NewChatMessage(from, content)
+	msg.Room = room
+	if err := store.AppendMessage(msg); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	return msg
+}
+
+func TestIndexedStoreSearch(t *testing.T) {
+	index := newTestIndex(t, 0)
+	appendChat(t, index, "#ops", "alice", "Deploy starts now")
+	appendChat(t, index, "#ops", "bob", "the deploys are slow")
+	appendChat(t, index, "#dev", "alice", "deployment of the API failed")
+	appendChat(t, index, "#dev", "carol", "lunch?")
+	dm := protocol.NewPrivateMessage("bob", "alice", "deploy later, ok?")
+	dm.Room = ConversationKey("bob", "alice")
+	if err := index.AppendMessage(dm); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	notice := protocol.NewSystemMessage("alice deployed nothing")
+	notice.Room = "#ops"
+	if err := index.AppendMessage(notice); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  []string
+	}{
+		{name: "prefix", query: SearchQuery{Text: "dep"}, want: []string{
+			"deploy later, ok?", "deployment of the API failed", "the deploys are slow", "Deploy starts now",
+		}},
+		{name: "whole word", query: SearchQuery{Text: "DEPLOYMENT"}, want: []string{"deployment of the API failed"}},
+		{name: "every word", query: SearchQuery{Text: "deploy api"}, want: []string{"deployment of the API failed"}},
+		{name: "no match", query: SearchQuery{Text: "deploy lunch"}},
+		{name: "punctuation only", query: SearchQuery{Text: "?!"}},
+		{name: "from", query: SearchQuery{Text: "deploy", From: "ALICE"}, want: []string{
+			"deployment of the API failed", "Deploy starts now",
+		}},
+		{name: "allowed rooms", query: SearchQuery{Text: "deploy", Allowed: func(key string) bool { return key == "#ops" }}, want: []string{
+			"the deploys are slow", "Deploy starts now",
+		}},
+		{name: "limit keeps the newest", query: SearchQuery{Text: "deploy", Limit: 2}, want: []string{
+			"deploy later, ok?", "deployment of the API failed",
+		}},
+		{name: "since", query: SearchQuery{Text: "deploy", Since: time.Now().Add(time.Hour)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contents(index.Search(tt.query)); !equalStrings(got, tt.want) {
+				t.Errorf("Search(%+v) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexedStoreLimit(t *testing.T) {
+	index := newTestIndex(t, 3)
+	appendChat(t, index, "#ops", "alice", "deploy one")
+	appendChat(t, index, "#ops", "alice", "deploy two")
+	appendChat(t, index, "#dev", "alice", "deploy elsewhere")
+	// Notices aren't searchable but take a place like in the backend
+	notice := protocol.NewSystemMessage("deploy notice")
+	notice.Room = "#ops"
+	if err := index.AppendMessage(notice); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	appendChat(t, index, "#ops", "alice", "deploy three")
+
+	want := []string{"deploy three", "deploy elsewhere", "deploy two"}
+	if got := contents(index.Search(SearchQuery{Text: "deploy"})); !equalStrings(got, want) {
+		t.Errorf("Search = %q, want %q", got, want)
+	}
+	if got := index.Search(SearchQuery{Text: "one"}); len(got) != 0 {
+		t.Errorf("a message beyond the limit is still found: %q", contents(got))
+	}
+}
+
+func TestIndexedStoreRebuild(t *testing.T) {
+	memory := NewMemoryStore()
+	appendChat(t, memory, "#ops", "alice", "stored before the index")
+	index, err := NewIndexedStore(memory, 0)
+	if err != nil {
+		t.Fatalf("NewIndexedStore: %v", err)
+	}
+	if got := contents(index.Search(SearchQuery{Text: "before"})); !equalStrings(got, []string{"stored before the index"}) {
+		t.Errorf("Search = %q, want the message stored before the index", got)
+	}
+}
+
+func TestIndexedStorePruneAndDelete(t *testing.T) {
+	index := newTestIndex(t, 0)
+	if err := index.AppendMessage(datedMessage("#ops", "deploy old", time.Now().Add(-48*time.Hour))); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	appendChat(t, index, "#ops", "alice", "deploy middle")
+	appendChat(t, index, "#ops", "alice", "deploy new")
+	appendChat(t, index, "#dev", "alice", "deploy dev")
+
+	if _, err := index.PruneMessages("#ops", 0, time.Now().Add(-24*time.Hour)); err != nil {
+		t.Fatalf("PruneMessages: %v", err)
+	}
+	want := []string{"deploy dev", "deploy new", "deploy middle"}
+	if got := contents(index.Search(SearchQuery{Text: "deploy"})); !equalStrings(got, want) {
+		t.Errorf("after pruning by age, Search = %q, want %q", got, want)
+	}
+
+	if _, err := index.PruneMessages("#ops", 1, time.Time{}); err != nil {
+		t.Fatalf("PruneMessages: %v", err)
+	}
+	want = []string{"deploy dev", "deploy new"}
+	if got := contents(index.Search(SearchQuery{Text: "deploy"})); !equalStrings(got, want) {
+		t.Errorf("after pruning by count, Search = %q, want %q", got, want)
+	}
+
+	if err := index.DeleteRoom("#dev"); err != nil {
+		t.Fatalf("DeleteRoom: %v", err)
+	}
+	want = []string{"deploy new"}
+	if got := contents(index.Search(SearchQuery{Text: "deploy"})); !equalStrings(got, want) {
+		t.Errorf("after DeleteRoom, Search = %q, want %q", got, want)
+	}
+	if got := index.Search(SearchQuery{Text: "dev"}); len(got) != 0 {
+		t.Errorf("words of a deleted room are still found: %q", contents(got))
+	}
+}
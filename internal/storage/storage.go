@@ -0,0 +1,208 @@
+// Package storage defines the persistence backend for accounts, rooms and
+// message history, with an in-memory and an embedded on-disk implementation.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+)
+
+// Errors returned by backends
+var (
+	// ErrNotFound is returned when a record does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrEmailTaken is returned when an email already has an account
+	ErrEmailTaken = errors.New("email already has an account")
+	// ErrUsernameTaken is returned when a username belongs to another account
+	ErrUsernameTaken = errors.New("username belongs to another account")
+)
+
+// Account is a registered user. Emails and usernames are unique
+// case-insensitively.
+type Account struct {
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	DisplayName string    `json:"display_name,omitempty"`
+	Bio         string    `json:"bio,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// RoomInfo is the persisted description of a room
+type RoomInfo struct {
+	Name    string `json:"name"`
+	Private bool   `json:"private"`
+	// Group marks group conversations, which only Participants may join
+	Group        bool      `json:"group,omitempty"`
+	Participants []string  `json:"participants,omitempty"`
+	CreatedBy    string    `json:"created_by,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Owner defaults to CreatedBy for rooms saved before ownership existed
+	Owner string `json:"owner,omitempty"`
+	// Roles maps lowercase usernames to "moderator" or "guest"
+	Roles map[string]string `json:"roles,omitempty"`
+	// Topic was last set by TopicSetBy at TopicSetAt
+	Topic       string    `json:"topic,omitempty"`
+	TopicSetBy  string    `json:"topic_set_by,omitempty"`
+	TopicSetAt  time.Time `json:"topic_set_at,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	// Access control: see room.Room.CheckAccess
+	InviteOnly bool     `json:"invite_only,omitempty"`
+	Hidden     bool     `json:"hidden,omitempty"`
+	KeyHash    string   `json:"key_hash,omitempty"` // bcrypt hash of the room key
+	AllowList  []string `json:"allow_list,omitempty"`
+	Invited    []string `json:"invited,omitempty"`
+	// Moderation: see room.Room.BanFor and room.Room.MutedUntil
+	Bans  []Ban      `json:"bans,omitempty"`
+	Mutes []RoomMute `json:"mutes,omitempty"`
+	// Retention overrides the server's history retention; nil uses the default
+	Retention *Retention `json:"retention,omitempty"`
+	// Replay overrides the server's history replay policy; nil uses the default
+	Replay *Replay `json:"replay,omitempty"`
+}
+
+// Ban keeps the users matching Target, a username, email or IP address,
+// out of a room or the whole server
+type Ban struct {
+	Target string    `json:"target"`
+	By     string    `json:"by"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+	Until  time.Time `json:"until,omitempty"` // zero for a permanent ban
+}
+
+// Active reports whether the ban is still in force at now
+func (b Ban) Active(now time.Time) bool {
+	return b.Until.IsZero() || now.Before(b.Until)
+}
+
+// Matches reports whether the ban's target matches a user
+func (b Ban) Matches(username, email, ip string) bool {
+	return strings.EqualFold(b.Target, username) ||
+		(email != "" && strings.EqualFold(b.Target, email)) ||
+		(ip != "" && b.Target == ip)
+}
+
+// RoomMute stops a user from talking in a room
+type RoomMute struct {
+	Username string    `json:"username"`
+	By       string    `json:"by"`
+	At       time.Time `json:"at"`
+	Until    time.Time `json:"until,omitempty"` // zero until unmuted
+}
+
+// Active reports whether the mute is still in force at now
+func (m RoomMute) Active(now time.Time) bool {
+	return m.Until.IsZero() || now.Before(m.Until)
+}
+
+// Store is a storage backend
+type Store interface {
+	// GetAccount returns the account registered to an email
+	GetAccount(email string) (*Account, error)
+	// GetAccountByUsername returns the account owning a username
+	GetAccountByUsername(username string) (*Account, error)
+	// CreateAccount stores a new account, failing with ErrEmailTaken or
+	// ErrUsernameTaken if either is already registered
+	CreateAccount(acct *Account) error
+	// UpdateAccount replaces an existing account (matched by email)
+	UpdateAccount(acct *Account) error
+	// CountAccounts returns the number of registered accounts
+	CountAccounts() (int, error)
+
+	// SaveRoom creates or replaces a room
+	SaveRoom(room *RoomInfo) error
+	// DeleteRoom removes a room and its history
+	DeleteRoom(name string) error
+	// ListRooms returns every stored room
+	ListRooms() ([]*RoomInfo, error)
+
+	// AppendMessage adds a message to the history of msg.Room, which is a
+	// room name or a ConversationKey
+	AppendMessage(msg *protocol.Message) error
+	// MessagesSince returns a room's messages newer than since, oldest first
+	MessagesSince(room string, since time.Time) ([]*protocol.Message, error)
+	// MessagesBefore returns up to limit of a room's newest messages with an
+	// ID below beforeID (no bound if beforeID is empty), oldest first
+	MessagesBefore(room, beforeID string, limit int) ([]*protocol.Message, error)
+	// PruneMessages deletes a room's messages older than olderThan (unless
+	// zero) and all but the newest keep messages (unless keep <= 0). It
+	// returns the number of deleted messages.
+	PruneMessages(room string, keep int, olderThan time.Time) (int, error)
+	// ForEachMessage calls fn for every stored message, stopping at the
+	// first error
+	ForEachMessage(fn func(msg *protocol.Message) error) error
+
+	// QueueMessage adds a direct message to the inbox of msg.To
+	QueueMessage(msg *protocol.Message) error
+	// Inbox returns the messages queued for a user, oldest first
+	Inbox(username string) ([]*protocol.Message, error)
+	// ClearInbox deletes a user's queued messages up to and including the
+	// message throughID
+	ClearInbox(username, throughID string) error
+	// QueuedBy returns the queued messages sent by a user, oldest first
+	QueuedBy(sender string) ([]*protocol.Message, error)
+
+	// SaveBan creates or replaces a server-wide ban (matched by target)
+	SaveBan(ban *Ban) error
+	// DeleteBan lifts the server-wide ban of a target
+	DeleteBan(target string) error
+	// ListBans returns every server-wide ban
+	ListBans() ([]*Ban, error)
+
+	// Persistent reports whether stored data survives a restart
+	Persistent() bool
+	// Close releases the backend's resources
+	Close() error
+}
+
+// Open creates the backend selected by name ("memory" or "bolt"). path is
+// the database file used by on-disk backends.
+func Open(backend, path string) (Store, error) {
+	switch backend {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "bolt":
+		return NewBoltStore(path)
+	default:
+		return nil, fmt.Errorf("unknown storage backend '%s' (expected memory or bolt)", backend)
+	}
+}
+
+// ConversationKey returns the history key under which the direct messages
+// between two users are stored, e.g. "@alice,bob". It is the same for both
+// users and can't collide with room names, which start with '#'.
+func ConversationKey(a, b string) string {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if b < a {
+		a, b = b, a
+	}
+	return "@" + a + "," + b
+}
+
+// ConversationMembers returns the two users of a ConversationKey, or false if
+// key names a room
+func ConversationMembers(key string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(key, "@")
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, ",")
+}
+
+// CompareIDs compares two message IDs numerically, returning -1, 0 or 1.
+// IDs are decimal integers without leading zeros.
+func CompareIDs(a, b string) int {
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
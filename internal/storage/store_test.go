@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mullayam/go-tcp-chat/internal/protocol"
+)
+
+// backends returns a constructor for a fresh store of each backend; every
+// backend must pass the same contract tests
+func backends() map[string]func(t *testing.T) Store {
+	return map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemoryStore() },
+		"bolt": func(t *testing.T) Store {
+			store, err := NewBoltStore(filepath.Join(t.TempDir(), "chat.db"))
+			if err != nil {
+				t.Fatalf("NewBoltStore: %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+	}
+}
+
+// datedMessage returns a chat message in room sent at the given time. IDs
+// start from the send time, so the ID is dated too.
+func datedMessage(room, content string, at time.Time) *protocol.Message {
+	msg := protocol.NewChatMessage("alice", content)
+	msg.ID = strconv.FormatInt(at.UnixMicro(), 10)
+	msg.Room = room
+	msg.Timestamp = at
+	return msg
+}
+
+// forEachBackend runs a contract test against a fresh store of each backend
+func forEachBackend(t *testing.T, test func(t *testing.T, store Store)) {
+	for name, open := range backends() {
+		t.Run(name, func(t *testing.T) { test(t, open(t)) })
+	}
+}
+
+func TestStoreAccounts(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		alice := &Account{Username: "alice", Email: "alice@example.com", CreatedAt: time.Now()}
+		if err := store.CreateAccount(alice); err != nil {
+			t.Fatalf("CreateAccount: %v", err)
+		}
+
+		tests := []struct {
+			name    string
+			account *Account
+			wantErr error
+		}{
+			{name: "email taken", account: &Account{Username: "alice2", Email: "ALICE@example.com"}, wantErr: ErrEmailTaken},
+			{name: "username taken", account: &Account{Username: "Alice", Email: "other@example.com"}, wantErr: ErrUsernameTaken},
+			{name: "new", account: &Account{Username: "bob", Email: "bob@example.com"}},
+		}
+		for _, tt := range tests {
+			if err := store.CreateAccount(tt.account); !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: CreateAccount = %v, want %v", tt.name, err, tt.wantErr)
+			}
+		}
+
+		if acct, err := store.GetAccountByUsername("ALICE"); err != nil || acct.Email != alice.Email {
+			t.Errorf("GetAccountByUsername = %+v, %v, want alice", acct, err)
+		}
+		if _, err := store.GetAccount("nobody@example.com"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetAccount of an unknown email = %v, want ErrNotFound", err)
+		}
+		if err := store.UpdateAccount(&Account{Username: "carol", Email: "carol@example.com"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("UpdateAccount of an unknown account = %v, want ErrNotFound", err)
+		}
+
+		alice.Bio = "hi"
+		if err := store.UpdateAccount(alice); err != nil {
+			t.Fatalf("UpdateAccount: %v", err)
+		}
+		if acct, err := store.GetAccount(alice.Email); err != nil || acct.Bio != "hi" {
+			t.Errorf("GetAccount after UpdateAccount = %+v, %v", acct, err)
+		}
+		if count, err := store.CountAccounts(); err != nil || count != 2 {
+			t.Errorf("CountAccounts = %d, %v, want 2", count, err)
+		}
+	})
+}
+
+func TestStoreRooms(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		for _, name := range []string{"#b", "#a"} {
+			if err := store.SaveRoom(&RoomInfo{Name: name, Private: true, Owner: "alice"}); err != nil {
+				t.Fatalf("SaveRoom: %v", err)
+			}
+		}
+		// Saving again replaces the room
+		if err := store.SaveRoom(&RoomInfo{Name: "#a", Private: true, Topic: "hello"}); err != nil {
+			t.Fatalf("SaveRoom: %v", err)
+		}
+		appendChat(t, store, "#a", "alice", "goes with the room")
+
+		rooms, err := store.ListRooms()
+		if err != nil {
+			t.Fatalf("ListRooms: %v", err)
+		}
+		sort.Slice(rooms, func(i, j int) bool { return rooms[i].Name < rooms[j].Name })
+		if len(rooms) != 2 || rooms[0].Name != "#a" || rooms[0].Topic != "hello" || rooms[0].Owner != "" || rooms[1].Name != "#b" {
+			t.Fatalf("ListRooms = %+v, want #a with the new topic and #b", rooms)
+		}
+
+		if err := store.DeleteRoom("#a"); err != nil {
+			t.Fatalf("DeleteRoom: %v", err)
+		}
+		if rooms, _ := store.ListRooms(); len(rooms) != 1 || rooms[0].Name != "#b" {
+			t.Errorf("ListRooms after DeleteRoom = %+v, want only #b", rooms)
+		}
+		if history, _ := store.MessagesBefore("#a", "", 10); len(history) != 0 {
+			t.Errorf("DeleteRoom kept the history: %q", contents(history))
+		}
+	})
+}
+
+func TestStoreHistory(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		var ids []string
+		for i, content := range []string{"one", "two", "three", "four"} {
+			msg := datedMessage("#r", content, time.Now().Add(time.Duration(i-4)*time.Hour))
+			if err := store.AppendMessage(msg); err != nil {
+				t.Fatalf("AppendMessage: %v", err)
+			}
+			ids = append(ids, msg.ID)
+		}
+		appendChat(t, store, "#other", "bob", "elsewhere")
+
+		before := []struct {
+			beforeID string
+			limit    int
+			want     []string
+		}{
+			{"", 2, []string{"three", "four"}},
+			{"", 10, []string{"one", "two", "three", "four"}},
+			{ids[2], 10, []string{"one", "two"}},
+			{ids[2], 1, []string{"two"}},
+			{ids[0], 10, nil},
+		}
+		for _, tt := range before {
+			history, err := store.MessagesBefore("#r", tt.beforeID, tt.limit)
+			if err != nil {
+				t.Fatalf("MessagesBefore: %v", err)
+			}
+			if got := contents(history); !equalStrings(got, tt.want) {
+				t.Errorf("MessagesBefore(%q, %d) = %q, want %q", tt.beforeID, tt.limit, got, tt.want)
+			}
+		}
+
+		history, err := store.MessagesSince("#r", time.Now().Add(-150*time.Minute))
+		if err != nil {
+			t.Fatalf("MessagesSince: %v", err)
+		}
+		if got, want := contents(history), []string{"three", "four"}; !equalStrings(got, want) {
+			t.Errorf("MessagesSince = %q, want %q", got, want)
+		}
+
+		count := 0
+		if err := store.ForEachMessage(func(*protocol.Message) error { count++; return nil }); err != nil || count != 5 {
+			t.Errorf("ForEachMessage visited %d messages (%v), want 5", count, err)
+		}
+	})
+}
+
+func TestStorePruneMessages(t *testing.T) {
+	tests := []struct {
+		name        string
+		keep        int
+		olderThan   time.Duration // before now; 0 for no age bound
+		wantDeleted int
+		want        []string
+	}{
+		{name: "nothing", want: []string{"one", "two", "three", "four"}},
+		{name: "keep", keep: 3, wantDeleted: 1, want: []string{"two", "three", "four"}},
+		{name: "keep more than stored", keep: 10, want: []string{"one", "two", "three", "four"}},
+		{name: "older than", olderThan: 150 * time.Minute, wantDeleted: 2, want: []string{"three", "four"}},
+		{name: "both", keep: 1, olderThan: 150 * time.Minute, wantDeleted: 3, want: []string{"four"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, store Store) {
+				for i, content := range []string{"one", "two", "three", "four"} {
+					msg := datedMessage("#r", content, time.Now().Add(time.Duration(i-4)*time.Hour))
+					if err := store.AppendMessage(msg); err != nil {
+						t.Fatalf("AppendMessage: %v", err)
+					}
+				}
+				appendChat(t, store, "#other", "bob", "untouched")
+
+				var olderThan time.Time
+				if tt.olderThan > 0 {
+					olderThan = time.Now().Add(-tt.olderThan)
+				}
+				deleted, err := store.PruneMessages("#r", tt.keep, olderThan)
+				if err != nil {
+					t.Fatalf("PruneMessages: %v", err)
+				}
+				if deleted != tt.wantDeleted {
+					t.Errorf("PruneMessages deleted %d, want %d", deleted, tt.wantDeleted)
+				}
+				history, _ := store.MessagesBefore("#r", "", 10)
+				if got := contents(history); !equalStrings(got, tt.want) {
+					t.Errorf("history = %q, want %q", got, tt.want)
+				}
+				if other, _ := store.MessagesBefore("#other", "", 10); len(other) != 1 {
+					t.Errorf("pruning #r changed #other: %q", contents(other))
+				}
+			})
+		})
+	}
+}
+
+func TestStoreInbox(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		var ids []string
+		for _, content := range []string{"one", "two", "three"} {
+			msg := protocol.NewPrivateMessage("alice", "Bob", content)
+			if err := store.QueueMessage(msg); err != nil {
+				t.Fatalf("QueueMessage: %v", err)
+			}
+			ids = append(ids, msg.ID)
+		}
+		if err := store.QueueMessage(protocol.NewPrivateMessage("carol", "dave", "other")); err != nil {
+			t.Fatalf("QueueMessage: %v", err)
+		}
+
+		inbox, err := store.Inbox("bob")
+		if err != nil {
+			t.Fatalf("Inbox: %v", err)
+		}
+		if got, want := contents(inbox), []string{"one", "two", "three"}; !equalStrings(got, want) {
+			t.Errorf("Inbox = %q, want %q", got, want)
+		}
+		if queued, _ := store.QueuedBy("ALICE"); len(queued) != 3 {
+			t.Errorf("QueuedBy = %q, want alice's 3 messages", contents(queued))
+		}
+
+		if err := store.ClearInbox("bob", ids[1]); err != nil {
+			t.Fatalf("ClearInbox: %v", err)
+		}
+		inbox, _ = store.Inbox("bob")
+		if got, want := contents(inbox), []string{"three"}; !equalStrings(got, want) {
+			t.Errorf("Inbox after ClearInbox = %q, want %q", got, want)
+		}
+		if inbox, _ := store.Inbox("dave"); len(inbox) != 1 {
+			t.Errorf("ClearInbox touched another inbox: %q", contents(inbox))
+		}
+	})
+}
+
+func TestStoreBans(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store Store) {
+		if err := store.SaveBan(&Ban{Target: "mallory", By: "alice", Until: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatalf("SaveBan: %v", err)
+		}
+		// Saving the same target again replaces the ban
+		if err := store.SaveBan(&Ban{Target: "Mallory", By: "bob"}); err != nil {
+			t.Fatalf("SaveBan: %v", err)
+		}
+		if err := store.SaveBan(&Ban{Target: "192.0.2.7", By: "alice"}); err != nil {
+			t.Fatalf("SaveBan: %v", err)
+		}
+
+		bans, err := store.ListBans()
+		if err != nil {
+			t.Fatalf("ListBans: %v", err)
+		}
+		if len(bans) != 2 {
+			t.Fatalf("ListBans returned %d bans, want 2", len(bans))
+		}
+		for _, ban := range bans {
+			if ban.Target != "192.0.2.7" && (ban.By != "bob" || !ban.Until.IsZero()) {
+				t.Errorf("ban %+v was not replaced", ban)
+			}
+		}
+
+		if err := store.DeleteBan("MALLORY"); err != nil {
+			t.Fatalf("DeleteBan: %v", err)
+		}
+		if bans, _ := store.ListBans(); len(bans) != 1 || bans[0].Target != "192.0.2.7" {
+			t.Errorf("ListBans after DeleteBan = %+v, want only the IP ban", bans)
+		}
+	})
+}
+
+func TestStorePersistent(t *testing.T) {
+	want := map[string]bool{"memory": false, "bolt": true}
+	for name, open := range backends() {
+		if got := open(t).Persistent(); got != want[name] {
+			t.Errorf("%s Persistent() = %v, want %v", name, got, want[name])
+		}
+	}
+}